@@ -4,12 +4,102 @@ import (
 	"bytes"
 	"errors"
 	"net"
+	"time"
 
 	"pan/core"
 )
 
-// Accept ...
-func Accept(app core.App[Context], network Net) {
+// rateLimitSweepInterval is the interval the full token buckets are removed.
+const rateLimitSweepInterval = time.Minute
+
+const (
+	defaultAcceptRate     = 10
+	defaultAcceptBurst    = 20
+	defaultAcceptCapacity = 4096
+	defaultAcceptWorkers  = 16
+	defaultAcceptQueue    = 64
+)
+
+type acceptConfig struct {
+	rate     float64
+	burst    int
+	capacity int
+	workers  int
+	queue    int
+}
+
+type AcceptWithFn func(cfg *acceptConfig)
+
+// AcceptWithRateLimit limits the packets of every source address with a token
+// bucket, the rate is packets per second. A non-positive rate or burst is the
+// default one.
+func AcceptWithRateLimit(rate float64, burst int) AcceptWithFn {
+	return func(cfg *acceptConfig) {
+		cfg.rate = rate
+		cfg.burst = burst
+	}
+}
+
+// AcceptWithRateLimitCapacity sets the max source addresses which are rate
+// limited at the same time, the least recently seen one is forgotten.
+func AcceptWithRateLimitCapacity(capacity int) AcceptWithFn {
+	return func(cfg *acceptConfig) {
+		cfg.capacity = capacity
+	}
+}
+
+// AcceptWithWorkers runs the app in a pool of workers, packets are dropped
+// when the queue is full. Non-positive workers are the default ones and the
+// queue holds one packet at least.
+func AcceptWithWorkers(workers int, queue int) AcceptWithFn {
+	return func(cfg *acceptConfig) {
+		cfg.workers = workers
+		cfg.queue = queue
+	}
+}
+
+// Accept reads the packets until the network is closed. Every source
+// address is rate limited, and the app runs in a bounded pool of workers, so
+// a flood of packets can not exhaust goroutines and sockets.
+func Accept(app core.App[Context], network Net, withFns ...AcceptWithFn) {
+
+	cfg := new(acceptConfig)
+	cfg.rate = defaultAcceptRate
+	cfg.burst = defaultAcceptBurst
+	cfg.capacity = defaultAcceptCapacity
+	cfg.workers = defaultAcceptWorkers
+	cfg.queue = defaultAcceptQueue
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+
+	// the bad values would drop every packet or panic
+	if cfg.rate <= 0 {
+		cfg.rate = defaultAcceptRate
+	}
+	if cfg.burst <= 0 {
+		cfg.burst = defaultAcceptBurst
+	}
+	if cfg.workers <= 0 {
+		cfg.workers = defaultAcceptWorkers
+	}
+	cfg.queue = max(cfg.queue, 1)
+
+	limiter := newRateLimiter(cfg.rate, cfg.burst, cfg.capacity)
+	done := make(chan struct{})
+	defer close(done)
+	go limiter.sweepEvery(rateLimitSweepInterval, done)
+
+	ctxs := make(chan Context, cfg.queue)
+	defer close(ctxs)
+	for i := 0; i < cfg.workers; i++ {
+		go func() {
+			for ctx := range ctxs {
+				runRecovered(app, ctx)
+			}
+		}()
+	}
+
 	var addr []byte
 	var payload []byte
 	bufferSize := -1
@@ -44,8 +134,13 @@ func Accept(app core.App[Context], network Net) {
 
 		method, body, err := core.ParsePacket(packet, 0)
 		if err == nil {
-			ctx := NewContext(method, body, srcAddr, network)
-			go app.Run(ctx)
+			if limiter.Allow(sourceHost(srcAddr)) {
+				select {
+				case ctxs <- NewContext(method, body, srcAddr, network):
+				default:
+					// every worker is busy and the queue is full
+				}
+			}
 			if len(payload) > size {
 				payload = payload[size:]
 				continue
@@ -59,6 +154,14 @@ func Accept(app core.App[Context], network Net) {
 
 }
 
+// runRecovered runs the app, a panic of a packet does not stop the worker.
+func runRecovered(app core.App[Context], ctx Context) {
+	defer func() {
+		_ = recover()
+	}()
+	_ = app.Run(ctx)
+}
+
 // Dispatch ...
 func Dispatch(method, body []byte, network Net) (err error) {
 	s, m, b := core.MarshalPacket(method, body)
@@ -66,3 +169,13 @@ func Dispatch(method, body []byte, network Net) (err error) {
 	err = network.Write(payload)
 	return
 }
+
+// sourceHost is the host of the addr, the port is ignored so a source can not
+// escape the rate limit by changing it.
+func sourceHost(addr []byte) string {
+	host, _, err := net.SplitHostPort(string(addr))
+	if err != nil {
+		return string(addr)
+	}
+	return host
+}
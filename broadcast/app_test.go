@@ -6,7 +6,9 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"pan/broadcast"
 	"pan/core"
@@ -23,6 +25,30 @@ func RunNext(args mock.Arguments) {
 	next()
 }
 
+// acceptRuns accepts the packets from one address and returns how many of
+// them are run by the app.
+func acceptRuns(t *testing.T, packets int, withFns ...broadcast.AcceptWithFn) func() int32 {
+
+	s, m, b := core.MarshalPacket([]byte("method-1"), []byte("body"))
+	packet := broadcast.MarshalPacket(s, m, b)
+
+	mockNet := new(mocked.MockNet)
+	mockNet.On("Read", mock.Anything).Times(packets).Return(packet, []byte("127.0.0.1:9000"), nil)
+	mockNet.On("Read", mock.Anything).Once().Return(nil, nil, net.ErrClosed)
+
+	var runs atomic.Int32
+	app := new(coreMocked.MockApp[broadcast.Context])
+	app.On("Run", mock.Anything).Maybe().Return(nil).Run(func(args mock.Arguments) {
+		runs.Add(1)
+	})
+
+	assert.NotPanics(t, func() {
+		broadcast.Accept(app, mockNet, withFns...)
+	}, "Accept should not panic")
+	mockNet.AssertExpectations(t)
+	return runs.Load
+}
+
 // TestApp ...
 func TestApp(t *testing.T) {
 
@@ -78,4 +104,172 @@ func TestApp(t *testing.T) {
 
 	})
 
+	t.Run("Accept with rate limit", func(t *testing.T) {
+
+		method := []byte("method-1")
+		s, m, b := core.MarshalPacket(method, []byte("body"))
+		packet := broadcast.MarshalPacket(s, m, b)
+		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+		otherPortAddr := []byte(net.JoinHostPort("127.0.0.1", "9001"))
+		otherAddr := []byte(net.JoinHostPort("127.0.0.2", "9000"))
+
+		mockNet := new(mocked.MockNet)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, addr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, otherPortAddr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, otherAddr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(nil, nil, net.ErrClosed)
+
+		app := new(coreMocked.MockApp[broadcast.Context])
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		addrs := make(chan []byte, 2)
+		app.On("Run", mock.Anything).Twice().Return(nil).Run(func(args mock.Arguments) {
+			addrs <- args.Get(0).(broadcast.Context).Addr()
+			wg.Done()
+		})
+
+		broadcast.Accept(app, mockNet, broadcast.AcceptWithRateLimit(0.001, 1))
+		wg.Wait()
+		close(addrs)
+
+		runAddrs := make([][]byte, 0)
+		for runAddr := range addrs {
+			runAddrs = append(runAddrs, runAddr)
+		}
+		assert.ElementsMatch(t, [][]byte{addr, otherAddr}, runAddrs, "Other port of same host should be limited")
+		mockNet.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Accept with rate limit capacity", func(t *testing.T) {
+
+		method := []byte("method-1")
+		s, m, b := core.MarshalPacket(method, []byte("body"))
+		packet := broadcast.MarshalPacket(s, m, b)
+		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+		otherAddr := []byte(net.JoinHostPort("127.0.0.2", "9000"))
+
+		// the bucket of addr is evicted by otherAddr, so addr gets a new one
+		mockNet := new(mocked.MockNet)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, addr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, otherAddr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, addr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(nil, nil, net.ErrClosed)
+
+		app := new(coreMocked.MockApp[broadcast.Context])
+		wg := sync.WaitGroup{}
+		wg.Add(3)
+		app.On("Run", mock.Anything).Times(3).Return(nil).Run(func(args mock.Arguments) {
+			wg.Done()
+		})
+
+		broadcast.Accept(app, mockNet, broadcast.AcceptWithRateLimit(0, 1), broadcast.AcceptWithRateLimitCapacity(1), broadcast.AcceptWithWorkers(1, 4))
+		wg.Wait()
+
+		mockNet.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Accept recovers panic of app", func(t *testing.T) {
+
+		method := []byte("method-1")
+		s, m, b := core.MarshalPacket(method, []byte("body"))
+		packet := broadcast.MarshalPacket(s, m, b)
+		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+
+		mockNet := new(mocked.MockNet)
+		mockNet.On("Read", mock.Anything).Twice().Return(packet, addr, nil)
+		mockNet.On("Read", mock.Anything).Once().Return(nil, nil, net.ErrClosed)
+
+		app := new(coreMocked.MockApp[broadcast.Context])
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		app.On("Run", mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
+			wg.Done()
+			panic("app panic")
+		})
+		app.On("Run", mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
+			wg.Done()
+		})
+
+		broadcast.Accept(app, mockNet, broadcast.AcceptWithWorkers(1, 4))
+		wg.Wait()
+
+		mockNet.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Accept without workers", func(t *testing.T) {
+
+		runs := acceptRuns(t, 1, broadcast.AcceptWithWorkers(0, 1))
+		assert.Eventually(t, func() bool {
+			return runs() == 1
+		}, time.Second, time.Millisecond, "Packet should be run by default workers")
+	})
+
+	t.Run("Accept with negative queue", func(t *testing.T) {
+
+		runs := acceptRuns(t, 1, broadcast.AcceptWithWorkers(1, -1))
+		assert.Eventually(t, func() bool {
+			return runs() == 1
+		}, time.Second, time.Millisecond, "Packet should be queued")
+	})
+
+	t.Run("Accept with non-positive burst", func(t *testing.T) {
+
+		runs := acceptRuns(t, 1, broadcast.AcceptWithRateLimit(1, 0))
+		assert.Eventually(t, func() bool {
+			return runs() == 1
+		}, time.Second, time.Millisecond, "Packet should be allowed by default burst")
+	})
+
+	t.Run("Accept with non-positive rate", func(t *testing.T) {
+
+		// a negative rate would drain the bucket of the second packet
+		runs := acceptRuns(t, 2, broadcast.AcceptWithRateLimit(-1, 2))
+		assert.Eventually(t, func() bool {
+			return runs() == 2
+		}, time.Second, time.Millisecond, "Packets should be allowed by default rate")
+	})
+
+	t.Run("Accept with full workers", func(t *testing.T) {
+
+		method := []byte("method-1")
+		s, m, b := core.MarshalPacket(method, []byte("body"))
+		packet := broadcast.MarshalPacket(s, m, b)
+
+		mockNet := new(mocked.MockNet)
+		once := sync.Once{}
+		running := make(chan struct{})
+		release := make(chan struct{})
+		mockNet.On("Read", mock.Anything).Once().Return(packet, []byte("127.0.0.1:9000"), nil)
+		mockNet.On("Read", mock.Anything).Once().Return(packet, []byte("127.0.0.2:9000"), nil).Run(func(args mock.Arguments) {
+			<-running
+		})
+		mockNet.On("Read", mock.Anything).Once().Return(packet, []byte("127.0.0.3:9000"), nil)
+		mockNet.On("Read", mock.Anything).Once().Return(nil, nil, net.ErrClosed)
+
+		app := new(coreMocked.MockApp[broadcast.Context])
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		app.On("Run", mock.Anything).Twice().Return(nil).Run(func(args mock.Arguments) {
+			once.Do(func() {
+				close(running)
+			})
+			<-release
+			wg.Done()
+		})
+
+		broadcast.Accept(app, mockNet, broadcast.AcceptWithWorkers(1, 1))
+		close(release)
+		wg.Wait()
+
+		mockNet.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
 }
@@ -0,0 +1,108 @@
+package broadcast
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+type compositeRead struct {
+	payload []byte
+	srcAddr []byte
+	err     error
+}
+
+type compositeSt struct {
+	nets  []Net
+	reads chan *compositeRead
+	once  *sync.Once
+	done  chan struct{}
+}
+
+// Read returns the next datagram of any net. The size is only a hint, each
+// net reads whole datagrams with its own buffer size. It returns
+// net.ErrClosed after every net is closed.
+func (c *compositeSt) Read(size int) (payload []byte, srcAddr []byte, err error) {
+
+	c.once.Do(c.start)
+
+	read, ok := <-c.reads
+	if !ok {
+		err = net.ErrClosed
+		return
+	}
+	payload, srcAddr, err = read.payload, read.srcAddr, read.err
+	return
+}
+
+// start reads every net until it is closed.
+func (c *compositeSt) start() {
+
+	wg := new(sync.WaitGroup)
+	for _, n := range c.nets {
+		wg.Add(1)
+		go func(n Net) {
+			defer wg.Done()
+			for {
+				payload, srcAddr, err := n.Read(-1)
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				select {
+				case c.reads <- &compositeRead{payload: payload, srcAddr: srcAddr, err: err}:
+				case <-c.done:
+					return
+				}
+			}
+		}(n)
+	}
+
+	go func() {
+		wg.Wait()
+		close(c.reads)
+	}()
+}
+
+// Write sends the payload through every net, it fails only when all of them
+// fail.
+func (c *compositeSt) Write(payload []byte) (err error) {
+
+	errs := make([]error, 0)
+	for _, n := range c.nets {
+		writeErr := n.Write(payload)
+		if writeErr != nil {
+			errs = append(errs, writeErr)
+		}
+	}
+	if len(errs) == len(c.nets) {
+		err = errors.Join(errs...)
+	}
+	return
+}
+
+// Close ...
+func (c *compositeSt) Close() error {
+
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+
+	errs := make([]error, 0)
+	for _, n := range c.nets {
+		errs = append(errs, n.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// NewComposite fans writes out to the nets and merges their reads, so
+// discovery keeps working when one transport is filtered.
+func NewComposite(nets ...Net) Net {
+	c := new(compositeSt)
+	c.nets = nets
+	c.reads = make(chan *compositeRead)
+	c.once = new(sync.Once)
+	c.done = make(chan struct{})
+	return c
+}
@@ -0,0 +1,90 @@
+package broadcast_test
+
+import (
+	"errors"
+	"net"
+	"pan/broadcast"
+	"testing"
+
+	mocked "pan/mocks/pan/broadcast"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newCompositeNet reads the payloads once, then blocks until closed.
+func newCompositeNet(closed chan struct{}, payloads ...[]byte) *mocked.MockNet {
+	n := new(mocked.MockNet)
+	for _, payload := range payloads {
+		n.On("Read", -1).Once().Return(payload, []byte("127.0.0.1:9100"), nil)
+	}
+	n.On("Read", -1).Return(nil, nil, net.ErrClosed).Run(func(args mock.Arguments) {
+		<-closed
+	})
+	return n
+}
+
+// TestComposite ...
+func TestComposite(t *testing.T) {
+
+	t.Run("Read merges nets", func(t *testing.T) {
+
+		closed := make(chan struct{})
+		first := newCompositeNet(closed, []byte("first"))
+		first.On("Close").Once().Return(nil).Run(func(args mock.Arguments) {
+			close(closed)
+		})
+		second := newCompositeNet(closed, []byte("second"))
+		second.On("Close").Once().Return(nil)
+
+		composite := broadcast.NewComposite(first, second)
+
+		payloads := make([][]byte, 0)
+		for i := 0; i < 2; i++ {
+			payload, _, err := composite.Read(-1)
+			assert.Nil(t, err, "Error should be nil")
+			payloads = append(payloads, payload)
+		}
+		assert.ElementsMatch(t, [][]byte{[]byte("first"), []byte("second")}, payloads, "Payloads should be merged")
+
+		err := composite.Close()
+		assert.Nil(t, err, "Error should be nil")
+
+		_, _, err = composite.Read(-1)
+		assert.ErrorIs(t, err, net.ErrClosed, "Error should be closed")
+		first.AssertExpectations(t)
+		second.AssertExpectations(t)
+	})
+
+	t.Run("Write fans out", func(t *testing.T) {
+
+		filtered := errors.New("filtered")
+		first := new(mocked.MockNet)
+		first.On("Write", []byte("payload")).Once().Return(filtered)
+		second := new(mocked.MockNet)
+		second.On("Write", []byte("payload")).Once().Return(nil)
+
+		err := broadcast.NewComposite(first, second).Write([]byte("payload"))
+
+		assert.Nil(t, err, "Error should be nil when one net writes")
+		first.AssertExpectations(t)
+		second.AssertExpectations(t)
+	})
+
+	t.Run("Write fails on every net", func(t *testing.T) {
+
+		filtered := errors.New("filtered")
+		first := new(mocked.MockNet)
+		first.On("Write", []byte("payload")).Once().Return(filtered)
+		second := new(mocked.MockNet)
+		second.On("Write", []byte("payload")).Once().Return(net.ErrClosed)
+
+		err := broadcast.NewComposite(first, second).Write([]byte("payload"))
+
+		assert.ErrorIs(t, err, filtered, "Error should be joined")
+		assert.ErrorIs(t, err, net.ErrClosed, "Error should be joined")
+		first.AssertExpectations(t)
+		second.AssertExpectations(t)
+	})
+
+}
@@ -6,6 +6,7 @@ import (
 
 type Context interface {
 	core.Context
+	Param(name string) string
 	Body() []byte
 	Addr() []byte
 	Net() Net
@@ -16,6 +17,7 @@ type contextStruct struct {
 	body   []byte
 	addr   []byte
 	n      Net
+	params core.Params
 }
 
 // Method ...
@@ -23,6 +25,16 @@ func (c *contextStruct) Method() []byte {
 	return c.method
 }
 
+// Param ...
+func (c *contextStruct) Param(name string) string {
+	return c.params[name]
+}
+
+// SetParams ...
+func (c *contextStruct) SetParams(params core.Params) {
+	c.params = params
+}
+
 // Body ...
 func (c *contextStruct) Body() []byte {
 	return c.body
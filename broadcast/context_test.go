@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"net"
 	"pan/broadcast"
+	"pan/core"
 	mocked "pan/mocks/pan/broadcast"
 	"testing"
 
@@ -29,4 +30,23 @@ func TestContext(t *testing.T) {
 		assert.Equal(t, mockNet, ctx.Net(), "Broadcast should be same")
 	})
 
+	t.Run("Params", func(t *testing.T) {
+
+		method := []byte("peer/abc/alive")
+		mockNet := new(mocked.MockNet)
+		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+
+		router := core.NewRouter[broadcast.Context]()
+		router.Route("peer/:id/alive", func(ctx broadcast.Context, next core.Next) error {
+			return next()
+		})
+
+		ctx := broadcast.NewContext(method, nil, addr, mockNet)
+		err := router.Handle(ctx, func() error { return nil })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "abc", ctx.Param("id"), "Param should be set by router")
+		assert.Equal(t, "", ctx.Param("name"), "Unknown param should be empty")
+	})
+
 }
@@ -2,6 +2,7 @@ package broadcast
 
 import (
 	"bytes"
+	"context"
 	"math"
 	"pan/core"
 	"time"
@@ -13,59 +14,57 @@ type Controller struct {
 }
 
 // Handle ...
-func (ctrl *Controller) Handle(ctx Context, next core.Next) {
+func (ctrl *Controller) Handle(ctx Context, next core.Next) error {
 	method := ctx.Method()
 	if bytes.Equal([]byte("alive"), method) {
-		ctrl.Alive(ctx, next)
-		return
+		return ctrl.Alive(ctx, next)
 	}
 
 	if bytes.Equal([]byte("dead"), method) {
-		ctrl.Dead(ctx, next)
-		return
+		return ctrl.Dead(ctx, next)
 	}
-	next()
+	return next()
 }
 
 // BroadcastAlive ...
-func (ctrl *Controller) BroadcastAlive() {
+func (ctrl *Controller) BroadcastAlive() error {
+	return ctrl.broadcastAlive(context.Background(), 5)
+}
+
+// broadcastAlive ...
+func (ctrl *Controller) broadcastAlive(ctx context.Context, times int) (err error) {
 	payload, err := ctrl.service.GenerateAliveMessage()
 	if err != nil {
-		panic(err)
-	}
-	err = dispatch([]byte("alive"), payload, ctrl.network, 5)
-	if err != nil {
-		panic(err)
+		return
 	}
+	err = dispatch(ctx, []byte("alive"), payload, ctrl.network, times)
+	return
 }
 
-// Alive ...
-func (ctrl *Controller) Alive(ctx Context, next core.Next) {
-	err := ctrl.service.RecvAliveMessage(ctx.Addr(), ctx.Body())
-	if err != nil {
-		panic(err)
-	}
+// Alive returns the error of the received alive, a peer that can not be
+// reached returns ErrUnreachablePeer and a forged one ErrInvalidMessage.
+func (ctrl *Controller) Alive(ctx Context, next core.Next) error {
+	return ctrl.service.RecvAliveMessage(ctx.Addr(), ctx.Body())
 }
 
 // BroadcastDead ...
-func (ctrl *Controller) BroadcastDead() {
+func (ctrl *Controller) BroadcastDead() error {
+	return ctrl.broadcastDead(context.Background(), 2)
+}
+
+// broadcastDead ...
+func (ctrl *Controller) broadcastDead(ctx context.Context, times int) (err error) {
 	payload, err := ctrl.service.GenerateDeadMessage()
 	if err != nil {
-		panic(err)
-	}
-	err = dispatch([]byte("dead"), payload, ctrl.network, 2)
-	if err != nil {
-		panic(err)
+		return
 	}
-
+	err = dispatch(ctx, []byte("dead"), payload, ctrl.network, times)
+	return
 }
 
 // Dead ...
-func (ctrl *Controller) Dead(ctx Context, next core.Next) {
-	err := ctrl.service.RecvDeadMessage(ctx.Addr(), ctx.Body())
-	if err != nil {
-		panic(err)
-	}
+func (ctrl *Controller) Dead(ctx Context, next core.Next) error {
+	return ctrl.service.RecvDeadMessage(ctx.Addr(), ctx.Body())
 }
 
 // NewController ...
@@ -76,16 +75,21 @@ func NewController(service *Service, network Net) *Controller {
 	return ctrl
 }
 
-// dispatch ...
-func dispatch(method, body []byte, n Net, times int) (err error) {
+// dispatch sends the message times with 1.5x backoff, it stops early when
+// the context is done.
+func dispatch(ctx context.Context, method, body []byte, n Net, times int) (err error) {
 	for i := 0; i < times; i++ {
 		err = Dispatch(method, body, n)
-		if err != nil {
+		if err != nil || i == times-1 {
 			break
 		}
 		num := 1500 * math.Pow(1.5, float64(i))
 		ms := int64(num)
-		time.Sleep(time.Millisecond * time.Duration(ms))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond * time.Duration(ms)):
+		}
 	}
 	return
 }
@@ -15,7 +15,6 @@ import (
 	"pan/peer"
 	"testing"
 
-	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/protobuf/proto"
@@ -35,7 +34,8 @@ func TestController(t *testing.T) {
 
 		repo := new(mocked.MockRepo)
 		pr := new(peerMocked.MockPeer)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 
 		network := new(mocked.MockNet)
 		payloadMatcher := mock.MatchedBy(func(p []byte) bool {
@@ -58,7 +58,8 @@ func TestController(t *testing.T) {
 		network.On("Write", payloadMatcher).Return(nil).Times(5)
 
 		ctrl := broadcast.NewController(service, network)
-		ctrl.BroadcastAlive()
+		err := ctrl.BroadcastAlive()
+		assert.Nil(t, err, "Error should be nil")
 
 		repo.AssertExpectations(t)
 		network.AssertExpectations(t)
@@ -74,7 +75,8 @@ func TestController(t *testing.T) {
 
 		repo := new(mocked.MockRepo)
 		pr := new(peerMocked.MockPeer)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 
 		network := new(mocked.MockNet)
 		payloadMatcher := mock.MatchedBy(func(p []byte) bool {
@@ -98,12 +100,8 @@ func TestController(t *testing.T) {
 		network.On("Write", payloadMatcher).Return(terr).Once()
 
 		ctrl := broadcast.NewController(service, network)
-		defer func() {
-			if err := recover(); err != nil {
-				assert.Equal(t, terr, err, "Error should be same")
-			}
-		}()
-		ctrl.BroadcastAlive()
+		err := ctrl.BroadcastAlive()
+		assert.ErrorIs(t, err, terr, "Error should be same")
 
 		repo.AssertExpectations(t)
 		network.AssertExpectations(t)
@@ -126,7 +124,8 @@ func TestController(t *testing.T) {
 
 		repo := new(mocked.MockRepo)
 		pr := new(peerMocked.MockPeer)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 
 		network := new(mocked.MockNet)
 		payloadMatcher := mock.MatchedBy(func(p []byte) bool {
@@ -149,7 +148,8 @@ func TestController(t *testing.T) {
 		network.On("Write", payloadMatcher).Return(nil).Times(2)
 
 		ctrl := broadcast.NewController(service, network)
-		ctrl.BroadcastDead()
+		err := ctrl.BroadcastDead()
+		assert.Nil(t, err, "Error should be nil")
 
 		repo.AssertExpectations(t)
 		network.AssertExpectations(t)
@@ -172,7 +172,8 @@ func TestController(t *testing.T) {
 
 		repo := new(mocked.MockRepo)
 		pr := new(peerMocked.MockPeer)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 
 		network := new(mocked.MockNet)
 		payloadMatcher := mock.MatchedBy(func(p []byte) bool {
@@ -197,12 +198,8 @@ func TestController(t *testing.T) {
 		network.On("Write", payloadMatcher).Return(terr).Once()
 
 		ctrl := broadcast.NewController(service, network)
-		defer func() {
-			if err := recover(); err != nil {
-				assert.Equal(t, terr, err, "Error should be same")
-			}
-		}()
-		ctrl.BroadcastDead()
+		err := ctrl.BroadcastDead()
+		assert.ErrorIs(t, err, terr, "Error should be same")
 
 		repo.AssertExpectations(t)
 		network.AssertExpectations(t)
@@ -218,11 +215,12 @@ func TestController(t *testing.T) {
 
 		repo := new(mocked.MockRepo)
 		pr := new(peerMocked.MockPeer)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, cert := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 		network := new(mocked.MockNet)
 		node := new(peerMocked.MockNode)
+		node.On("Certificate").Once().Return(cert)
 
-		peerId := peer.PeerId(uuid.New())
 		ip := "127.0.0.1"
 		addr := []byte(net.JoinHostPort(ip, "9000"))
 		method := []byte("alive")
@@ -245,13 +243,13 @@ func TestController(t *testing.T) {
 		}
 		quicAddr := peer.MarshalQUICAddr(udpAddr)
 
-		repo.On("FindOneWithAddrAndSeq", []byte(addr), msg.Seq).Once().Return(nil, nil)
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
 		var rd *broadcast.Record
 		repo.On("Save", mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
 			rd = args.Get(0).(*broadcast.Record)
 		})
 		pr.On("Connect", uint8(quicServeInfo.Type[0]), quicAddr).Once().Return(node, nil)
-		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peerId, nil)
+		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peer.PeerId(msg.PeerId), nil)
 
 		ctx := new(mocked.MockContext)
 		ctx.On("Method").Once().Return(method)
@@ -259,10 +257,11 @@ func TestController(t *testing.T) {
 		ctx.On("Body").Once().Return(body)
 
 		ctrl := broadcast.NewController(service, network)
-		ctrl.Handle(ctx, func() error {
+		err = ctrl.Handle(ctx, func() error {
 			assert.Fail(t, "Next should not be called")
 			return nil
 		})
+		assert.Nil(t, err, "Error should be nil")
 
 		assert.NotNil(t, rd, "Record should not be nil")
 		assert.Equal(t, rd.Seq, msg.Seq, "Seq should be same")
@@ -277,6 +276,46 @@ func TestController(t *testing.T) {
 
 	})
 
+	t.Run("Handle Alive with unreachable peer", func(t *testing.T) {
+
+		quicServeInfo := new(broadcast.ServeInfo)
+		quicServeInfo.Port = int32(9000)
+		quicServeInfo.Type = []byte{peer.QUICNodeType}
+
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+		network := new(mocked.MockNet)
+
+		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+		body, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		connErr := errors.New("Connect Error")
+		repo.On("FindOneWithPeerId", mock.Anything).Once().Return(nil, nil)
+		pr.On("Connect", peer.QUICNodeType, mock.Anything).Once().Return(nil, connErr)
+
+		ctx := new(mocked.MockContext)
+		ctx.On("Method").Once().Return([]byte("alive"))
+		ctx.On("Addr").Once().Return(addr)
+		ctx.On("Body").Once().Return(body)
+
+		ctrl := broadcast.NewController(service, network)
+		err = ctrl.Handle(ctx, func() error {
+			assert.Fail(t, "Next should not be called")
+			return nil
+		})
+
+		assert.ErrorIs(t, err, broadcast.ErrUnreachablePeer, "Error should be unreachable peer")
+		assert.ErrorIs(t, err, connErr, "Error should be connect error")
+		repo.AssertExpectations(t)
+		ctx.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
 	t.Run("Handle Dead", func(t *testing.T) {
 
 		quicServeInfo := new(broadcast.ServeInfo)
@@ -288,7 +327,8 @@ func TestController(t *testing.T) {
 
 		pr := new(peerMocked.MockPeer)
 		repo := new(mocked.MockRepo)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, cert := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 		network := new(mocked.MockNet)
 
 		method := []byte("dead")
@@ -303,10 +343,12 @@ func TestController(t *testing.T) {
 			t.Fatal(err)
 		}
 		rd := new(broadcast.Record)
+		rd.PeerId = msg.PeerId
 		rd.Seq = msg.Seq
 		rd.Token = msg.Token
+		rd.PublicKey, _ = core.ExtractPublicKeyFromCert(cert)
 
-		repo.On("FindOneWithAddrAndSeq", []byte(addr), msg.Seq).Return(rd, nil).Once()
+		repo.On("FindOneWithPeerId", msg.PeerId).Return(rd, nil).Once()
 		repo.On("Save", rd).Return(nil).Once()
 
 		ctx := new(mocked.MockContext)
@@ -315,10 +357,11 @@ func TestController(t *testing.T) {
 		ctx.On("Body").Once().Return(body)
 
 		ctrl := broadcast.NewController(service, network)
-		ctrl.Handle(ctx, func() error {
+		err = ctrl.Handle(ctx, func() error {
 			assert.Fail(t, "Next should not be called")
 			return nil
 		})
+		assert.Nil(t, err, "Error should be nil")
 
 		assert.Greater(t, rd.DeathTime, int64(0), "DeathTime should be set")
 
@@ -337,7 +380,8 @@ func TestController(t *testing.T) {
 
 		pr := new(peerMocked.MockPeer)
 		repo := new(mocked.MockRepo)
-		service := broadcast.NewService(repo, pr, quicServeInfo)
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
 		network := new(mocked.MockNet)
 
 		method := []byte("others")
@@ -0,0 +1,187 @@
+package broadcast
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket for every key, the least recently used
+// bucket is evicted when it is full.
+type rateLimiter struct {
+	rate     float64
+	burst    float64
+	capacity int
+	buckets  map[string]*list.Element
+	order    *list.List
+	lock     *sync.Mutex
+}
+
+// Allow takes a token of the key, it is false when the bucket is empty.
+func (l *rateLimiter) Allow(key string) bool {
+
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var bucket *tokenBucket
+	elem, ok := l.buckets[key]
+	if ok {
+		bucket = elem.Value.(*tokenBucket)
+		l.order.MoveToBack(elem)
+	} else {
+		for l.order.Len() >= l.capacity {
+			oldest := l.order.Front()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*tokenBucket).key)
+		}
+		bucket = new(tokenBucket)
+		bucket.key = key
+		bucket.tokens = l.burst
+		bucket.last = now
+		l.buckets[key] = l.order.PushBack(bucket)
+	}
+
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// sweep removes the buckets which are full again, they are same as new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for elem := l.order.Front(); elem != nil; {
+		next := elem.Next()
+		bucket := elem.Value.(*tokenBucket)
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			l.order.Remove(elem)
+			delete(l.buckets, bucket.key)
+		}
+		elem = next
+	}
+}
+
+// sweepEvery sweeps the buckets on every interval until done is closed.
+func (l *rateLimiter) sweepEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			l.sweep(now)
+		case <-done:
+			return
+		}
+	}
+}
+
+// newRateLimiter ...
+func newRateLimiter(rate float64, burst int, capacity int) *rateLimiter {
+	l := new(rateLimiter)
+	l.rate = rate
+	l.burst = float64(burst)
+	l.capacity = max(capacity, 1)
+	l.buckets = make(map[string]*list.Element)
+	l.order = list.New()
+	l.lock = new(sync.Mutex)
+	return l
+}
+
+type seenEntry struct {
+	key       string
+	expiredAt time.Time
+}
+
+// seenCache remembers keys for a while, the oldest keys are evicted when it
+// is full.
+type seenCache struct {
+	ttl      time.Duration
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	lock     *sync.Mutex
+}
+
+// Has reports whether the key is seen and not expired.
+func (c *seenCache) Has(key string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	return ok && time.Now().Before(elem.Value.(*seenEntry).expiredAt)
+}
+
+// Add marks the key as seen, it is false when the key is seen already.
+func (c *seenCache) Add(key string) bool {
+
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && now.Before(elem.Value.(*seenEntry).expiredAt) {
+		return false
+	}
+	if ok {
+		c.order.Remove(elem)
+	}
+
+	for c.order.Len() >= c.capacity {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*seenEntry).key)
+	}
+
+	entry := new(seenEntry)
+	entry.key = key
+	entry.expiredAt = now.Add(c.ttl)
+	c.entries[key] = c.order.PushBack(entry)
+	return true
+}
+
+// Forget removes the key, so it is handled again.
+func (c *seenCache) Forget(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// newSeenCache ...
+func newSeenCache(ttl time.Duration, capacity int) *seenCache {
+	c := new(seenCache)
+	c.ttl = ttl
+	c.capacity = capacity
+	c.entries = make(map[string]*list.Element)
+	c.order = list.New()
+	c.lock = new(sync.Mutex)
+	return c
+}
+
+// seenKey is the key of a message in seen cache.
+func seenKey(method []byte, addr []byte, seq int64, token []byte) string {
+	key := appendSignField(nil, method)
+	key = appendSignField(key, addr)
+	key = binary.BigEndian.AppendUint64(key, uint64(seq))
+	key = append(key, token...)
+	return string(key)
+}
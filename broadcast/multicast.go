@@ -2,14 +2,44 @@ package broadcast
 
 import (
 	"errors"
+	"slices"
+	"sync"
+	"time"
 
 	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
+var ErrNoInterface = errors.New("No Interface")
+
+// multicastGroup is implemented by ipv4.PacketConn and ipv6.PacketConn.
+type multicastGroup interface {
+	JoinGroup(ifi *net.Interface, group net.Addr) error
+	LeaveGroup(ifi *net.Interface, group net.Addr) error
+	SetMulticastInterface(ifi *net.Interface) error
+}
+
+// Multicast is a Net which sends to a multicast group.
+type Multicast interface {
+	Net
+	Interfaces() []string
+}
+
 type multicastSt struct {
-	serve      *net.UDPConn
-	dialer     *net.UDPConn
-	bufferSize int
+	serve       *net.UDPConn
+	dialer      *net.UDPConn
+	bufferSize  int
+	addr        *net.UDPAddr
+	names       []string
+	all         bool
+	joined      map[string]*net.Interface
+	serveGroup  multicastGroup
+	dialerGroup multicastGroup
+	rw          *sync.RWMutex
+	writeLock   *sync.Mutex
+	done        chan struct{}
 }
 
 // Read ...
@@ -35,32 +65,153 @@ func (b *multicastSt) Read(size int) (payload []byte, srcAddr []byte, err error)
 	return
 }
 
-// Write ...
+// Write sends the payload by the default interface, or by every joined
+// interface when interfaces are chosen.
 func (b *multicastSt) Write(payload []byte) (err error) {
 
-	size, err := b.dialer.Write(payload)
+	if len(b.names) == 0 && !b.all {
+		return writeUDP(b.dialer, payload, []*net.UDPAddr{b.addr})
+	}
+
+	b.rw.RLock()
+	ifis := make([]*net.Interface, 0, len(b.joined))
+	for _, ifi := range b.joined {
+		ifis = append(ifis, ifi)
+	}
+	b.rw.RUnlock()
 
-	if err != nil {
+	if len(ifis) == 0 {
+		err = ErrNoInterface
 		return
 	}
-	if size < len(payload) {
-		err = &NetWriteError{writenSize: size}
-	}
 
+	b.writeLock.Lock()
+	defer b.writeLock.Unlock()
+
+	errs := make([]error, 0)
+	for _, ifi := range ifis {
+		setErr := b.dialerGroup.SetMulticastInterface(ifi)
+		if setErr != nil {
+			errs = append(errs, setErr)
+			continue
+		}
+		addr := *b.addr
+		if addr.IP.To4() == nil {
+			addr.Zone = ifi.Name
+		}
+		errs = append(errs, writeUDP(b.dialer, payload, []*net.UDPAddr{&addr}))
+	}
+	err = errors.Join(errs...)
 	return
 }
 
 // Close ...
 func (b *multicastSt) Close() error {
+	if b.done != nil {
+		select {
+		case <-b.done:
+		default:
+			close(b.done)
+		}
+	}
 	serr := b.serve.Close()
 	derr := b.dialer.Close()
 	return errors.Join(serr, derr)
 }
 
+// Interfaces returns the names of joined interfaces.
+func (b *multicastSt) Interfaces() (names []string) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+	if b.all {
+		for name := range b.joined {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return
+	}
+	for _, name := range b.names {
+		if _, ok := b.joined[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// syncInterfaces joins the chosen interfaces which are up, and leaves the
+// ones which are gone or down. Without chosen interfaces an IPv6 group is
+// joined on every multicast interface.
+func (b *multicastSt) syncInterfaces() {
+
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	names := b.names
+	if b.all {
+		names = make([]string, 0, len(ifis))
+		for _, ifi := range ifis {
+			if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+				names = append(names, ifi.Name)
+			}
+		}
+		for name := range b.joined {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		var current *net.Interface
+		for i := range ifis {
+			ifi := &ifis[i]
+			if ifi.Name == name && ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+				current = ifi
+				break
+			}
+		}
+
+		joined, ok := b.joined[name]
+		if ok && (current == nil || current.Index != joined.Index) {
+			// the interface may be gone, so the error is expected
+			_ = b.serveGroup.LeaveGroup(joined, b.addr)
+			delete(b.joined, name)
+			ok = false
+		}
+		if !ok && current != nil {
+			if b.serveGroup.JoinGroup(current, b.addr) == nil {
+				b.joined[name] = current
+			}
+		}
+	}
+}
+
+// watchInterfaces ...
+func (b *multicastSt) watchInterfaces(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.syncInterfaces()
+		}
+	}
+}
+
+const defaultMulticastWatchInterval = 5 * time.Second
+
 type newMulticastConfig struct {
-	addr       *net.UDPAddr
-	ifi        *net.Interface
-	bufferSize int
+	addr          *net.UDPAddr
+	names         []string
+	watchInterval time.Duration
+	bufferSize    int
 }
 
 // defaultMulticastConf ...
@@ -73,6 +224,7 @@ func defaultMulticastConfig() (*newMulticastConfig, error) {
 
 	cfg := new(newMulticastConfig)
 	cfg.addr = addr
+	cfg.watchInterval = defaultMulticastWatchInterval
 	cfg.bufferSize = 64 * 1024 * 1024
 	return cfg, nil
 }
@@ -86,7 +238,32 @@ func NewMulticastWithAddr(addr *net.UDPAddr) NewMulticastWithFn {
 	}
 }
 
-func NewMulticast(withFns ...NewMulticastWithFn) (Net, error) {
+// NewMulticastWithIPv6 uses the link-local group [ff02::120]:9100. A link
+// local group needs an interface, so without NewMulticastWithInterfaces it
+// is joined on every multicast interface.
+func NewMulticastWithIPv6() NewMulticastWithFn {
+	return func(cfg *newMulticastConfig) {
+		cfg.addr = &net.UDPAddr{IP: net.ParseIP("ff02::120"), Port: 9100}
+	}
+}
+
+// NewMulticastWithInterfaces chooses interfaces by name. They are joined and
+// left when they come and go.
+func NewMulticastWithInterfaces(names ...string) NewMulticastWithFn {
+	return func(cfg *newMulticastConfig) {
+		cfg.names = names
+	}
+}
+
+// NewMulticastWithWatchInterval sets how often the chosen interfaces are
+// checked, a non-positive interval is the default one.
+func NewMulticastWithWatchInterval(interval time.Duration) NewMulticastWithFn {
+	return func(cfg *newMulticastConfig) {
+		cfg.watchInterval = interval
+	}
+}
+
+func NewMulticast(withFns ...NewMulticastWithFn) (Multicast, error) {
 
 	cfg, err := defaultMulticastConfig()
 	if err != nil {
@@ -96,13 +273,22 @@ func NewMulticast(withFns ...NewMulticastWithFn) (Net, error) {
 	for _, withFn := range withFns {
 		withFn(cfg)
 	}
+	if cfg.watchInterval <= 0 {
+		cfg.watchInterval = defaultMulticastWatchInterval
+	}
 
-	serve, err := net.ListenMulticastUDP(cfg.addr.Network(), cfg.ifi, cfg.addr)
+	network := "udp6"
+	if cfg.addr.IP.To4() != nil {
+		network = "udp4"
+	}
+
+	serve, err := net.ListenMulticastUDP(network, nil, cfg.addr)
 	if err != nil {
 		return nil, err
 	}
-	dialer, err := net.DialUDP(cfg.addr.Network(), nil, cfg.addr)
+	dialer, err := net.ListenUDP(network, nil)
 	if err != nil {
+		serve.Close()
 		return nil, err
 	}
 
@@ -110,5 +296,27 @@ func NewMulticast(withFns ...NewMulticastWithFn) (Net, error) {
 	n.dialer = dialer
 	n.serve = serve
 	n.bufferSize = cfg.bufferSize
+	n.addr = cfg.addr
+	n.names = cfg.names
+	n.all = network == "udp6" && len(cfg.names) == 0
+	n.joined = make(map[string]*net.Interface)
+	n.rw = new(sync.RWMutex)
+	n.writeLock = new(sync.Mutex)
+
+	if network == "udp4" {
+		n.serveGroup = ipv4.NewPacketConn(serve)
+		n.dialerGroup = ipv4.NewPacketConn(dialer)
+	} else {
+		n.serveGroup = ipv6.NewPacketConn(serve)
+		n.dialerGroup = ipv6.NewPacketConn(dialer)
+	}
+
+	if len(cfg.names) > 0 || n.all {
+		// only the chosen interfaces receive, so the default one is left
+		_ = n.serveGroup.LeaveGroup(nil, cfg.addr)
+		n.syncInterfaces()
+		n.done = make(chan struct{})
+		go n.watchInterfaces(cfg.watchInterval)
+	}
 	return n, nil
 }
@@ -3,8 +3,10 @@ package broadcast_test
 import (
 	"net"
 	"pan/broadcast"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,4 +60,121 @@ func TestMulticast(t *testing.T) {
 		assert.Contains(t, ips, ip, "IP should be local")
 	})
 
+	t.Run("write and read with interfaces", func(t *testing.T) {
+
+		ifi := multicastInterface(t)
+		buf := []byte("content buffer")
+
+		serve, err := broadcast.NewMulticast(
+			broadcast.NewMulticastWithAddr(&net.UDPAddr{IP: net.IPv4(224, 0, 0, 121), Port: 9120}),
+			broadcast.NewMulticastWithInterfaces(ifi.Name, "missing0"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		assert.Equal(t, []string{ifi.Name}, serve.Interfaces(), "Only existing interface should be joined")
+
+		err = serve.Write(buf)
+		assert.Nil(t, err, "Error should be nil")
+
+		msg, _, err := serve.Read(-1)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, buf, msg, "Buffer should be same")
+	})
+
+	t.Run("write and read with IPv6", func(t *testing.T) {
+
+		ifi := multicastInterface(t)
+		buf := []byte("content buffer")
+
+		serve, err := broadcast.NewMulticast(
+			broadcast.NewMulticastWithIPv6(),
+			broadcast.NewMulticastWithInterfaces(ifi.Name),
+		)
+		if err != nil {
+			t.Skip("IPv6 multicast is not available: ", err)
+		}
+		defer serve.Close()
+
+		if len(serve.Interfaces()) == 0 {
+			t.Skip("IPv6 multicast is not available on ", ifi.Name)
+		}
+
+		err = serve.Write(buf)
+		assert.Nil(t, err, "Error should be nil")
+
+		msg, addr, err := serve.Read(-1)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, buf, msg, "Buffer should be same")
+
+		host, _, err := net.SplitHostPort(string(addr))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Nil(t, net.ParseIP(strings.Split(host, "%")[0]).To4(), "Source should be IPv6")
+	})
+
+	t.Run("IPv6 without interfaces", func(t *testing.T) {
+
+		ifi := multicastInterface(t)
+
+		serve, err := broadcast.NewMulticast(broadcast.NewMulticastWithIPv6())
+		if err != nil {
+			t.Skip("IPv6 multicast is not available: ", err)
+		}
+		defer serve.Close()
+
+		if len(serve.Interfaces()) == 0 {
+			t.Skip("IPv6 multicast is not available on ", ifi.Name)
+		}
+		assert.Contains(t, serve.Interfaces(), ifi.Name, "Multicast interface should be joined")
+	})
+
+	t.Run("watch with non-positive interval", func(t *testing.T) {
+
+		serve, err := broadcast.NewMulticast(
+			broadcast.NewMulticastWithAddr(&net.UDPAddr{IP: net.IPv4(224, 0, 0, 123), Port: 9122}),
+			broadcast.NewMulticastWithInterfaces("missing0"),
+			broadcast.NewMulticastWithWatchInterval(0),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the watcher would panic at once on a non-positive ticker
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, serve.Close(), "Error should be nil")
+	})
+
+	t.Run("write without interfaces", func(t *testing.T) {
+
+		serve, err := broadcast.NewMulticast(
+			broadcast.NewMulticastWithAddr(&net.UDPAddr{IP: net.IPv4(224, 0, 0, 122), Port: 9121}),
+			broadcast.NewMulticastWithInterfaces("missing0"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		assert.Empty(t, serve.Interfaces(), "No interface should be joined")
+		assert.ErrorIs(t, serve.Write([]byte("content buffer")), broadcast.ErrNoInterface, "Error should be no interface")
+	})
+
+}
+
+// multicastInterface returns the first interface which supports multicast.
+func multicastInterface(t *testing.T) *net.Interface {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ifis {
+		flags := ifis[i].Flags
+		if flags&net.FlagUp != 0 && flags&net.FlagMulticast != 0 && flags&net.FlagLoopback == 0 {
+			return &ifis[i]
+		}
+	}
+	t.Skip("No multicast interface")
+	return nil
 }
@@ -1,5 +1,10 @@
 package broadcast
 
+import (
+	"errors"
+	"net"
+)
+
 type Net interface {
 	Read(int) ([]byte, []byte, error)
 	Write([]byte) error
@@ -14,3 +19,33 @@ type NetWriteError struct {
 func (e *NetWriteError) Error() string {
 	return "Truncate Write"
 }
+
+// readUDP reads one datagram from the conn, size <= 0 uses the bufferSize.
+func readUDP(conn *net.UDPConn, size int, bufferSize int) (payload []byte, srcAddr []byte, err error) {
+	if size <= 0 {
+		size = bufferSize
+	}
+	buff := make([]byte, size)
+	byteLen, addr, err := conn.ReadFromUDP(buff)
+	if err != nil {
+		return
+	}
+	payload = buff[:byteLen]
+	srcAddr = []byte(addr.String())
+	return
+}
+
+// writeUDP writes the payload to every addr, the errors are joined.
+func writeUDP(conn *net.UDPConn, payload []byte, addrs []*net.UDPAddr) (err error) {
+	errs := make([]error, 0)
+	for _, addr := range addrs {
+		size, writeErr := conn.WriteToUDP(payload, addr)
+		if writeErr != nil {
+			errs = append(errs, writeErr)
+		} else if size < len(payload) {
+			errs = append(errs, &NetWriteError{writenSize: size})
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
@@ -0,0 +1,184 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"pan/peer"
+	"sync"
+	"time"
+)
+
+// DefaultPresenceTTL is the ttl of NewPresence without a positive one.
+const DefaultPresenceTTL = 5 * time.Minute
+
+type presenceEntry struct {
+	seq    int64
+	token  []byte
+	seenAt time.Time
+	online bool
+}
+
+// Presence joins the discovery records with the peer state. Alive records
+// mark peers online, verified deaths mark them offline and close their
+// nodes, and peers which stop sending alives are expired after the ttl.
+type Presence struct {
+	pr      peer.Peer
+	routes  peer.RouteStore
+	ttl     time.Duration
+	entries map[peer.PeerId]*presenceEntry
+	rw      *sync.RWMutex
+}
+
+// UseRouteStore removes the routes of the expired peers from routes, so
+// Peer.Open does not dial the addrs they left.
+func (p *Presence) UseRouteStore(routes peer.RouteStore) {
+	p.rw.Lock()
+	p.routes = routes
+	p.rw.Unlock()
+}
+
+// Alive marks the PeerId of the record online.
+func (p *Presence) Alive(rd *Record) {
+	if len(rd.PeerId) != len(peer.PeerId{}) {
+		return
+	}
+	peerId := peer.PeerId(rd.PeerId)
+
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	entry, ok := p.entries[peerId]
+	if ok && entry.seq > rd.Seq {
+		return
+	}
+	if !ok {
+		entry = new(presenceEntry)
+		p.entries[peerId] = entry
+	}
+	entry.seq = rd.Seq
+	entry.token = rd.Token
+	entry.seenAt = time.Now()
+	entry.online = true
+}
+
+// Dead marks the PeerId of the record offline and closes its nodes. A death
+// of an older seq is ignored, the peer is restarted since.
+func (p *Presence) Dead(rd *Record) {
+	if len(rd.PeerId) != len(peer.PeerId{}) {
+		return
+	}
+	peerId := peer.PeerId(rd.PeerId)
+
+	p.rw.Lock()
+	entry, ok := p.entries[peerId]
+	if ok && (entry.seq > rd.Seq || (entry.seq == rd.Seq && !bytes.Equal(entry.token, rd.Token))) {
+		p.rw.Unlock()
+		return
+	}
+	if !ok {
+		entry = new(presenceEntry)
+		p.entries[peerId] = entry
+	}
+	entry.seq = rd.Seq
+	entry.token = rd.Token
+	entry.seenAt = time.Now()
+	entry.online = false
+	p.rw.Unlock()
+
+	// the nodes are gone with the peer, so errors of closing are expected
+	_ = p.pr.Disconnect(peerId)
+}
+
+// Stat is the state of the peer, a connected peer is always online.
+func (p *Presence) Stat(peerId peer.PeerId) peer.PeerState {
+
+	state := p.pr.Stat(peerId)
+	if state == peer.OnlinePeerState {
+		return state
+	}
+
+	p.rw.RLock()
+	entry, ok := p.entries[peerId]
+	online := ok && entry.online && time.Since(entry.seenAt) < p.ttl
+	p.rw.RUnlock()
+
+	if !ok {
+		return state
+	}
+	if online {
+		return peer.OnlinePeerState
+	}
+	return peer.OfflinePeerState
+}
+
+// Online returns the PeerIds which are online.
+func (p *Presence) Online() (peerIds []peer.PeerId) {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	for peerId, entry := range p.entries {
+		if entry.online && time.Since(entry.seenAt) < p.ttl {
+			peerIds = append(peerIds, peerId)
+		}
+	}
+	return
+}
+
+// Expire marks the peers offline which sent no alive within the ttl, and
+// returns them. A connected peer keeps its nodes and routes, the routes of
+// the other expired peers are removed.
+func (p *Presence) Expire() (peerIds []peer.PeerId) {
+	p.rw.Lock()
+	routes := p.routes
+	for peerId, entry := range p.entries {
+		if entry.online && time.Since(entry.seenAt) >= p.ttl {
+			entry.online = false
+			peerIds = append(peerIds, peerId)
+		}
+	}
+	p.rw.Unlock()
+
+	for _, peerId := range peerIds {
+		if routes != nil && p.pr.Stat(peerId) != peer.OnlinePeerState {
+			p.removeRoutes(routes, peerId)
+		}
+	}
+	return
+}
+
+// removeRoutes ...
+func (p *Presence) removeRoutes(routes peer.RouteStore, peerId peer.PeerId) {
+	found, err := routes.FindRoutes(peerId)
+	if err != nil {
+		return
+	}
+	for _, route := range found {
+		_ = routes.RemoveRoute(route)
+	}
+}
+
+// Run expires the peers until the context is done.
+func (p *Presence) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(p.ttl/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Expire()
+		}
+	}
+}
+
+// NewPresence uses DefaultPresenceTTL if ttl is not positive.
+func NewPresence(pr peer.Peer, ttl time.Duration) *Presence {
+	if ttl <= 0 {
+		ttl = DefaultPresenceTTL
+	}
+	p := new(Presence)
+	p.pr = pr
+	p.ttl = ttl
+	p.entries = make(map[peer.PeerId]*presenceEntry)
+	p.rw = new(sync.RWMutex)
+	return p
+}
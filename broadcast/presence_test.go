@@ -0,0 +1,172 @@
+package broadcast_test
+
+import (
+	"context"
+	"pan/broadcast"
+	"testing"
+	"time"
+
+	coreMocked "pan/mocks/pan/core"
+	peerMocked "pan/mocks/pan/peer"
+	"pan/peer"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newPresenceRecord ...
+func newPresenceRecord(peerId peer.PeerId, seq int64) *broadcast.Record {
+	rd := new(broadcast.Record)
+	rd.PeerId = peerId[:]
+	rd.Seq = seq
+	rd.Token = []byte("token")
+	return rd
+}
+
+// newPresenceRoute ...
+func newPresenceRoute(peerId peer.PeerId) *peer.Route {
+	route := new(peer.Route)
+	route.PeerId = peerId
+	route.NodeType = peer.QUICNodeType
+	route.Addr = []byte("127.0.0.1:9000")
+	return route
+}
+
+// newPresencePeer is a peer with a real node pool over routes.
+func newPresencePeer(routes peer.RouteStore) peer.Peer {
+	return peer.New(uuid.New(), nil, new(coreMocked.MockApp[peer.Context]), peer.NewPeerIdGenerator(false), 3, peer.NewPeerWithRouteStore(routes))
+}
+
+// TestPresence ...
+func TestPresence(t *testing.T) {
+
+	t.Run("Alive", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		pr := new(peerMocked.MockPeer)
+		pr.On("Stat", peerId).Return(peer.UnknownPeerState)
+
+		presence := broadcast.NewPresence(pr, time.Minute)
+		assert.Equal(t, peer.UnknownPeerState, presence.Stat(peerId), "State should be from peer")
+
+		presence.Alive(newPresenceRecord(peerId, 1))
+
+		assert.Equal(t, peer.OnlinePeerState, presence.Stat(peerId), "State should be online")
+		assert.Equal(t, []peer.PeerId{peerId}, presence.Online(), "Peer should be online")
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("Dead", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		pr := new(peerMocked.MockPeer)
+		pr.On("Stat", peerId).Return(peer.UnknownPeerState)
+		pr.On("Disconnect", peerId).Once().Return(nil)
+
+		presence := broadcast.NewPresence(pr, time.Minute)
+		presence.Alive(newPresenceRecord(peerId, 1))
+		presence.Dead(newPresenceRecord(peerId, 1))
+
+		assert.Equal(t, peer.OfflinePeerState, presence.Stat(peerId), "State should be offline")
+		assert.Empty(t, presence.Online(), "No peer should be online")
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("Dead with older seq", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		pr := new(peerMocked.MockPeer)
+		pr.On("Stat", peerId).Return(peer.UnknownPeerState)
+
+		presence := broadcast.NewPresence(pr, time.Minute)
+		presence.Alive(newPresenceRecord(peerId, 2))
+		presence.Dead(newPresenceRecord(peerId, 1))
+
+		assert.Equal(t, peer.OnlinePeerState, presence.Stat(peerId), "State should be online after restart")
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		routes := peer.NewMemoryRouteStore()
+		_ = routes.SaveRoute(newPresenceRoute(peerId))
+		pr := newPresencePeer(routes)
+
+		presence := broadcast.NewPresence(pr, 10*time.Millisecond)
+		presence.UseRouteStore(routes)
+		presence.Alive(newPresenceRecord(peerId, 1))
+		assert.Empty(t, presence.Expire(), "No peer should be expired")
+
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Equal(t, []peer.PeerId{peerId}, presence.Expire(), "Peer should be expired")
+		assert.Equal(t, peer.OfflinePeerState, presence.Stat(peerId), "State should be offline")
+		found, _ := routes.FindRoutes(peerId)
+		assert.Empty(t, found, "Routes of expired peer should be removed")
+	})
+
+	t.Run("Expire with connected peer", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		routes := peer.NewMemoryRouteStore()
+		_ = routes.SaveRoute(newPresenceRoute(peerId))
+		pr := newPresencePeer(routes)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		node := new(peerMocked.MockNode)
+		node.On("AcceptNodeStream", mock.Anything).Return(nil, context.Canceled).Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		})
+		go pr.Accept(ctx, node, peerId)
+		assert.Eventually(t, func() bool {
+			return pr.Stat(peerId) == peer.OnlinePeerState
+		}, time.Second, time.Millisecond, "Node should be pooled")
+
+		presence := broadcast.NewPresence(pr, 10*time.Millisecond)
+		presence.UseRouteStore(routes)
+		presence.Alive(newPresenceRecord(peerId, 1))
+
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Equal(t, []peer.PeerId{peerId}, presence.Expire(), "Peer should be expired")
+		assert.Equal(t, peer.OnlinePeerState, presence.Stat(peerId), "Connected peer should stay online")
+		found, _ := routes.FindRoutes(peerId)
+		assert.Len(t, found, 1, "Routes of connected peer should be kept")
+		node.AssertNotCalled(t, "Close")
+	})
+
+	t.Run("NewPresence without ttl", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		pr := new(peerMocked.MockPeer)
+		pr.On("Stat", peerId).Return(peer.UnknownPeerState)
+
+		presence := broadcast.NewPresence(pr, 0)
+		presence.Alive(newPresenceRecord(peerId, 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		presence.Run(ctx)
+
+		assert.Equal(t, peer.OnlinePeerState, presence.Stat(peerId), "Peer should be online with default ttl")
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("Stat with connected peer", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		pr := new(peerMocked.MockPeer)
+		pr.On("Stat", peerId).Return(peer.OnlinePeerState)
+		pr.On("Disconnect", peerId).Once().Return(nil)
+
+		presence := broadcast.NewPresence(pr, time.Minute)
+		presence.Dead(newPresenceRecord(peerId, 1))
+
+		assert.Equal(t, peer.OnlinePeerState, presence.Stat(peerId), "Connected peer should be online")
+		pr.AssertExpectations(t)
+	})
+
+}
@@ -1,48 +1,278 @@
 package broadcast
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"net"
+	"time"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrStaleRecord is returned when a record is saved with an older seq
+	// than the stored one of its PeerId.
+	ErrStaleRecord = errors.New("Stale Record")
+	// ErrMissingPeerId is returned when a record without PeerId is saved.
+	ErrMissingPeerId = errors.New("Missing PeerId")
+)
+
+// Record is the discovery state of a PeerId, it is saved by every alive and
+// death of the peer.
 type Record struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	PeerId    []byte `gorm:"size:16;uniqueIndex:idx_peer_records_peer_id"`
+	PublicKey []byte
+	Seq       int64
+	Token     []byte `gorm:"size:32"`
+	// Addr is the source addr of the latest message.
+	Addr      []byte
+	DeathTime int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Addrs     []*RecordAddr `gorm:"foreignKey:RecordId"`
+}
+
+// TableName ...
+func (*Record) TableName() string {
+	return "peer_records"
+}
+
+// RecordAddr is a node addr which the peer is observed on, it is the host of
+// the source addr with the port of a serve info.
+type RecordAddr struct {
+	ID       int64  `gorm:"primaryKey;autoIncrement"`
+	RecordId int64  `gorm:"uniqueIndex:idx_peer_record_addrs_addr"`
+	Type     uint8  `gorm:"uniqueIndex:idx_peer_record_addrs_addr"`
+	Addr     []byte `gorm:"uniqueIndex:idx_peer_record_addrs_addr"`
+	Seq      int64
+	SeenAt   int64
+}
+
+// TableName ...
+func (*RecordAddr) TableName() string {
+	return "peer_record_addrs"
+}
+
+// RecordHistory is a saved alive or death. It is the table of the former
+// records which were keyed by addr and seq, so the table is kept as it was.
+type RecordHistory struct {
 	gorm.Model
-	ID        int64  `gorm:"primary_key;auto_increment"`
 	Seq       int64  `gorm:"index:idx_seq,sort:desc"`
 	Token     []byte `gorm:"size:32"`
 	Addr      []byte `gorm:"index:idx_addr"`
 	PeerId    []byte `gorm:"size:16"`
+	PublicKey []byte
 	DeathTime int64
 }
 
+// TableName ...
+func (*RecordHistory) TableName() string {
+	return "records"
+}
+
 type Repo interface {
+	// Init migrates the tables, the records of the former table are moved
+	// into the latest record of every PeerId.
 	Init() error
-	FindOneWithAddrAndSeq(addr []byte, seq int64) (*Record, error)
+	// FindOneWithPeerId returns nil if the PeerId is unknown.
+	FindOneWithPeerId(peerId []byte) (*Record, error)
+	// Save inserts or updates the record of its PeerId with the addrs, and
+	// appends it to the history. It returns ErrStaleRecord if the seq is
+	// older than the stored one and ErrMissingPeerId if the PeerId is empty.
 	Save(record *Record) error
+	// FindLatest returns the record of every PeerId.
+	FindLatest() ([]*Record, error)
+	// FindWithAddr returns the records of the addr, an addr without port
+	// matches the host on every port.
+	FindWithAddr(addr []byte) ([]*Record, error)
+	// FindHistory returns a page of the alive and death records, the newest
+	// first, a nil peerId pages the records of all peers.
+	FindHistory(peerId []byte, offset int, limit int) ([]*RecordHistory, error)
+	// Prune deletes the records, addrs and history which are not updated
+	// since before.
+	Prune(before time.Time) (int64, error)
 }
 
 type repoStruct struct {
 	db *gorm.DB
 }
 
-// Create ...
+// Init ...
 func (r *repoStruct) Init() (err error) {
-	err = r.db.AutoMigrate(&Record{})
+	migrator := r.db.Migrator()
+	legacy := migrator.HasTable(&RecordHistory{}) && !migrator.HasTable(&Record{})
+
+	err = r.db.AutoMigrate(&Record{}, &RecordAddr{}, &RecordHistory{})
+	if err != nil || !legacy {
+		return
+	}
+	err = r.migrateHistory()
+	return
+}
+
+// migrateHistory creates the record of every PeerId from its latest history.
+func (r *repoStruct) migrateHistory() error {
+	return r.db.Transaction(func(tx *gorm.DB) (err error) {
+		histories := make([]*RecordHistory, 0)
+		latest := tx.Model(&RecordHistory{}).Select("MAX(id)").Where("peer_id IS NOT NULL").Group("peer_id")
+		result := tx.Where("id IN (?)", latest).Find(&histories)
+		if result.Error != nil {
+			err = result.Error
+			return
+		}
+		for _, history := range histories {
+			rd := new(Record)
+			rd.PeerId = history.PeerId
+			rd.PublicKey = history.PublicKey
+			rd.Seq = history.Seq
+			rd.Token = history.Token
+			rd.Addr = history.Addr
+			rd.DeathTime = history.DeathTime
+			rd.CreatedAt = history.CreatedAt
+			rd.UpdatedAt = history.UpdatedAt
+			result = tx.Create(rd)
+			if result.Error != nil {
+				err = result.Error
+				return
+			}
+		}
+		return
+	})
+}
+
+// FindOneWithPeerId ...
+func (r *repoStruct) FindOneWithPeerId(peerId []byte) (rd *Record, err error) {
+	rds := make([]*Record, 0)
+	result := r.db.Preload("Addrs").Where("peer_id = ?", peerId).Limit(1).Find(&rds)
+	err = result.Error
+	if err == nil && len(rds) > 0 {
+		rd = rds[0]
+	}
+	return
+}
+
+// Save ...
+func (r *repoStruct) Save(record *Record) error {
+	if len(record.PeerId) == 0 {
+		return ErrMissingPeerId
+	}
+	return r.db.Transaction(func(tx *gorm.DB) (err error) {
+		current := make([]*Record, 0)
+		result := tx.Where("peer_id = ?", record.PeerId).Limit(1).Find(&current)
+		if result.Error != nil {
+			err = result.Error
+			return
+		}
+		if len(current) > 0 {
+			if current[0].Seq > record.Seq {
+				err = ErrStaleRecord
+				return
+			}
+			record.ID = current[0].ID
+			record.CreatedAt = current[0].CreatedAt
+		}
+
+		// the addrs are upserted one by one, the ones which are not
+		// observed this time are kept until they are pruned.
+		result = tx.Omit(clause.Associations).Save(record)
+		if result.Error != nil {
+			err = result.Error
+			return
+		}
+
+		seenAt := time.Now().Unix()
+		for _, addr := range record.Addrs {
+			addr.RecordId = record.ID
+			addr.Seq = record.Seq
+			addr.SeenAt = seenAt
+			result = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "record_id"}, {Name: "type"}, {Name: "addr"}},
+				DoUpdates: clause.AssignmentColumns([]string{"seq", "seen_at"}),
+			}).Create(addr)
+			if result.Error != nil {
+				err = result.Error
+				return
+			}
+		}
+
+		history := new(RecordHistory)
+		history.Seq = record.Seq
+		history.Token = record.Token
+		history.Addr = record.Addr
+		history.PeerId = record.PeerId
+		history.PublicKey = record.PublicKey
+		history.DeathTime = record.DeathTime
+		result = tx.Create(history)
+		err = result.Error
+		return
+	})
+}
+
+// FindLatest ...
+func (r *repoStruct) FindLatest() (rds []*Record, err error) {
+	result := r.db.Preload("Addrs").Order("updated_at DESC").Find(&rds)
+	err = result.Error
 	return
 }
 
-// Create ...
-func (r *repoStruct) Save(record *Record) (err error) {
-	result := r.db.Save(record)
+// FindWithAddr ...
+func (r *repoStruct) FindWithAddr(addr []byte) (rds []*Record, err error) {
+	query := "addr = ?"
+	var arg any = addr
+	_, _, splitErr := net.SplitHostPort(string(addr))
+	if splitErr != nil {
+		query = "addr LIKE ?"
+		arg = net.JoinHostPort(string(addr), "%")
+	}
+
+	observed := r.db.Model(&RecordAddr{}).Select("record_id").Where(query, arg)
+	result := r.db.Preload("Addrs").Where(query, arg).Or("id IN (?)", observed).Order("updated_at DESC").Find(&rds)
 	err = result.Error
 	return
 }
 
-// FindOneWithAddrAndSeq ...
-func (r *repoStruct) FindOneWithAddrAndSeq(addr []byte, seq int64) (rd *Record, err error) {
-	rd = new(Record)
-	result := r.db.Where(&Record{Addr: addr, Seq: seq}).Take(&rd)
+// FindHistory ...
+func (r *repoStruct) FindHistory(peerId []byte, offset int, limit int) (histories []*RecordHistory, err error) {
+	db := r.db
+	if peerId != nil {
+		db = db.Where("peer_id = ?", peerId)
+	}
+	result := db.Order("id DESC").Offset(offset).Limit(limit).Find(&histories)
 	err = result.Error
 	return
 }
 
+// Prune deletes the rows permanently, soft deleting them would keep the
+// tables growing. The addrs of a pruned record are deleted with it.
+func (r *repoStruct) Prune(before time.Time) (count int64, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) (err error) {
+		result := tx.Unscoped().Where("updated_at < ?", before).Delete(&RecordHistory{})
+		if result.Error != nil {
+			err = result.Error
+			return
+		}
+		count += result.RowsAffected
+
+		stale := tx.Model(&Record{}).Select("id").Where("updated_at < ?", before)
+		result = tx.Where("seen_at < ? OR record_id IN (?)", before.Unix(), stale).Delete(&RecordAddr{})
+		if result.Error != nil {
+			err = result.Error
+			return
+		}
+		count += result.RowsAffected
+
+		result = tx.Where("updated_at < ?", before).Delete(&Record{})
+		err = result.Error
+		count += result.RowsAffected
+		return
+	})
+	if err != nil {
+		count = 0
+	}
+	return
+}
+
 // NewRepo ...
 func NewRepo(db *gorm.DB) Repo {
 	repo := new(repoStruct)
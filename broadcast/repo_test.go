@@ -25,6 +25,10 @@ func TestModel(t *testing.T) {
 		defer mockDB.Close()
 
 		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("CREATE TABLE `peer_records`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_peer_records_peer_id`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE `peer_record_addrs`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_peer_record_addrs_addr`").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE TABLE `records`").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE INDEX `idx_seq`").WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("CREATE INDEX `idx_addr`").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -48,11 +52,62 @@ func TestModel(t *testing.T) {
 
 	})
 
+	t.Run("Init with former records", func(t *testing.T) {
+
+		peerId := uuid.New()
+		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+		seq := time.Now().Unix()
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		hasTable := "SELECT count\\(\\*\\) FROM sqlite_master WHERE type='table' AND name=?"
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery(hasTable).WithArgs("records").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(hasTable).WithArgs("records").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT sql FROM sqlite_master").WillReturnRows(sqlmock.NewRows([]string{"sql"}).AddRow(
+			"CREATE TABLE `records` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`seq` integer,`token` blob,`addr` blob,`peer_id` blob,`public_key` blob,`death_time` integer)",
+		))
+		mock.ExpectQuery("SELECT \\* FROM `records` LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "seq", "token", "addr", "peer_id", "public_key", "death_time"}))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM sqlite_master WHERE type = (.+) AND tbl_name = (.+) AND name = ?").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM sqlite_master WHERE type = (.+) AND tbl_name = (.+) AND name = ?").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM sqlite_master WHERE type = (.+) AND tbl_name = (.+) AND name = ?").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("CREATE TABLE `peer_records`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_peer_records_peer_id`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE `peer_record_addrs`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_peer_record_addrs_addr`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM `records` WHERE id IN \\(SELECT MAX\\(id\\) FROM `records` WHERE peer_id IS NOT NULL (.+) GROUP BY `peer_id`\\)").WillReturnRows(sqlmock.NewRows([]string{"id", "seq", "addr", "peer_id"}).AddRow(int64(3), seq, addr, peerId[:]))
+		mock.ExpectExec("INSERT INTO `peer_records`").WithArgs(peerId[:], sqlmock.AnyArg(), seq, sqlmock.AnyArg(), addr, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.MatchExpectationsInOrder(false)
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo := broadcast.NewRepo(db)
+		err = repo.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
 	t.Run("Save", func(t *testing.T) {
 
 		token := make([]byte, 32)
 		rand.Read(token)
 		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+		nodeAddr := []byte(net.JoinHostPort("127.0.0.1", "9100"))
 		peerId := uuid.New()
 
 		rd := new(broadcast.Record)
@@ -60,7 +115,7 @@ func TestModel(t *testing.T) {
 		rd.Token = token
 		rd.Addr = addr
 		rd.PeerId = peerId[:]
-		rd.DeathTime = time.Now().Unix()
+		rd.Addrs = []*broadcast.RecordAddr{{Type: 1, Addr: nodeAddr}}
 
 		mockDB, mock, err := sqlmock.New()
 		if err != nil {
@@ -69,7 +124,12 @@ func TestModel(t *testing.T) {
 		defer mockDB.Close()
 
 		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
-		mock.ExpectExec("INSERT INTO `records`").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), rd.Seq, rd.Token, rd.Addr, rd.PeerId, rd.DeathTime).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE peer_id = ?").WithArgs(rd.PeerId).WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id", "seq"}).AddRow(int64(7), rd.PeerId, rd.Seq-1))
+		mock.ExpectExec("UPDATE `peer_records` SET (.+) WHERE `id` = ?").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO `peer_record_addrs` (.+) ON CONFLICT \\(`record_id`,`type`,`addr`\\) DO UPDATE").WithArgs(int64(7), uint8(1), nodeAddr, rd.Seq, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO `records`").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), rd.Seq, rd.Token, rd.Addr, rd.PeerId, rd.PublicKey, rd.DeathTime).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 
 		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
 		if err != nil {
@@ -86,14 +146,158 @@ func TestModel(t *testing.T) {
 			t.Errorf("there were unfulfilled expectations: %s", err)
 		}
 
+		assert.Equal(t, int64(7), rd.ID, "Record of PeerId should be updated")
+		assert.Equal(t, int64(7), rd.Addrs[0].RecordId, "Addr should belong to record")
+
 	})
 
-	t.Run("FindOneWithAddrAndSeq", func(t *testing.T) {
+	t.Run("Save with stale seq", func(t *testing.T) {
+
+		peerId := uuid.New()
+
+		rd := new(broadcast.Record)
+		rd.Seq = time.Now().Unix()
+		rd.PeerId = peerId[:]
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE peer_id = ?").WithArgs(rd.PeerId).WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id", "seq"}).AddRow(int64(7), rd.PeerId, rd.Seq+1))
+		mock.ExpectRollback()
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo := broadcast.NewRepo(db)
+		err = repo.Save(rd)
+		assert.ErrorIs(t, err, broadcast.ErrStaleRecord, "Error should be ErrStaleRecord")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("FindOneWithPeerId", func(t *testing.T) {
 
 		token := make([]byte, 32)
 		rand.Read(token)
 		seq := time.Now().Unix()
 		id := int64(123)
+		peerId := uuid.New()
+		nodeAddr := []byte(net.JoinHostPort("127.0.0.1", "9100"))
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE peer_id = ?").WithArgs(peerId[:]).WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id", "seq", "token"}).AddRow(id, peerId[:], seq, token))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_record_addrs` WHERE `peer_record_addrs`.`record_id` = ?").WithArgs(id).WillReturnRows(sqlmock.NewRows([]string{"id", "record_id", "type", "addr"}).AddRow(int64(1), id, 1, nodeAddr))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE peer_id = ?").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo := broadcast.NewRepo(db)
+		rd, err := repo.FindOneWithPeerId(peerId[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, id, rd.ID, "ID should be same")
+		assert.Equal(t, seq, rd.Seq, "Seq should be same")
+		assert.Equal(t, token, rd.Token, "Token should be same")
+		assert.Len(t, rd.Addrs, 1, "Addrs should be loaded")
+		assert.Equal(t, nodeAddr, rd.Addrs[0].Addr, "Addr should be same")
+
+		otherPeerId := uuid.New()
+		rd, err = repo.FindOneWithPeerId(otherPeerId[:])
+		assert.Nil(t, err, "Error should be nil")
+		assert.Nil(t, rd, "Record should not be found")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("Save without PeerId", func(t *testing.T) {
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rd := new(broadcast.Record)
+		rd.PublicKey = []byte("public key")
+		rd.Seq = 1
+
+		repo := broadcast.NewRepo(db)
+		err = repo.Save(rd)
+
+		assert.ErrorIs(t, err, broadcast.ErrMissingPeerId, "Error should be missing PeerId")
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("FindLatest", func(t *testing.T) {
+
+		peerId := uuid.New()
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` ORDER BY updated_at DESC").WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id"}).AddRow(int64(3), peerId[:]))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_record_addrs` WHERE `peer_record_addrs`.`record_id` = ?").WithArgs(int64(3)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo := broadcast.NewRepo(db)
+		rds, err := repo.FindLatest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Len(t, rds, 1, "Record of every peer should be found")
+		assert.Equal(t, peerId[:], rds[0].PeerId, "PeerId should be same")
+
+	})
+
+	t.Run("FindWithAddr", func(t *testing.T) {
+
 		addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
 
 		mockDB, mock, err := sqlmock.New()
@@ -103,7 +307,11 @@ func TestModel(t *testing.T) {
 		defer mockDB.Close()
 
 		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
-		mock.ExpectQuery("SELECT (.+) FROM `records`").WillReturnRows(sqlmock.NewRows([]string{"id", "seq", "token", "addr"}).AddRow(id, seq, token, addr))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE addr = (.+) OR id IN \\(SELECT `record_id` FROM `peer_record_addrs` WHERE addr = (.+)\\)").WithArgs(addr, addr).WillReturnRows(sqlmock.NewRows([]string{"id", "addr"}).AddRow(int64(1), addr))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_record_addrs`").WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE addr LIKE (.+) OR id IN \\(SELECT `record_id` FROM `peer_record_addrs` WHERE addr LIKE (.+)\\)").WithArgs("127.0.0.1:%", "127.0.0.1:%").WillReturnRows(sqlmock.NewRows([]string{"id", "addr"}).AddRow(int64(2), addr))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_record_addrs`").WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT (.+) FROM `peer_records` WHERE addr LIKE (.+) OR id IN").WithArgs("[fe80::1]:%", "[fe80::1]:%").WillReturnRows(sqlmock.NewRows([]string{"id", "addr"}))
 
 		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
 		if err != nil {
@@ -111,19 +319,92 @@ func TestModel(t *testing.T) {
 		}
 
 		repo := broadcast.NewRepo(db)
-		rd, err := repo.FindOneWithAddrAndSeq(addr, seq)
+		rds, err := repo.FindWithAddr(addr)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, rds, 1, "Record of addr should be found")
+
+		rds, err = repo.FindWithAddr([]byte("127.0.0.1"))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, rds, 1, "Record of host should be found")
+
+		rds, err = repo.FindWithAddr([]byte("fe80::1"))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Empty(t, rds, "No record should be found")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("FindHistory", func(t *testing.T) {
+
+		peerId := uuid.New()
+
+		mockDB, mock, err := sqlmock.New()
 		if err != nil {
 			t.Fatal(err)
 		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `records` WHERE peer_id = (.+) ORDER BY id DESC LIMIT 10 OFFSET 20").WithArgs(peerId[:]).WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id"}).AddRow(int64(2), peerId[:]).AddRow(int64(1), peerId[:]))
+		mock.ExpectQuery("SELECT (.+) FROM `records` WHERE `records`.`deleted_at` IS NULL ORDER BY id DESC LIMIT 10").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo := broadcast.NewRepo(db)
+		rds, err := repo.FindHistory(peerId[:], 20, 10)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, rds, 2, "Page should be found")
+		assert.Equal(t, uint(2), rds[0].ID, "Newest record should be first")
+
+		rds, err = repo.FindHistory(nil, 0, 10)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Empty(t, rds, "No record should be found")
 
 		if err := mock.ExpectationsWereMet(); err != nil {
 			t.Errorf("there were unfulfilled expectations: %s", err)
 		}
 
-		assert.Equal(t, id, rd.ID, "ID should be same")
-		assert.Equal(t, seq, rd.Seq, "Seq should be same")
-		assert.Equal(t, token, rd.Token, "Token should be same")
-		assert.Equal(t, addr, rd.Addr, "Addr should be same")
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+
+		before := time.Now().Add(-24 * time.Hour)
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `records` WHERE updated_at <").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("DELETE FROM `peer_record_addrs` WHERE seen_at < (.+) OR record_id IN \\(SELECT `id` FROM `peer_records` WHERE updated_at < (.+)\\)").WithArgs(before.Unix(), before).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM `peer_records` WHERE updated_at <").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo := broadcast.NewRepo(db)
+		count, err := repo.Prune(before)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Equal(t, int64(6), count, "Count should be deleted rows")
 
 	})
 }
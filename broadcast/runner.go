@@ -0,0 +1,254 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRunnerStarted = errors.New("Runner Started")
+var ErrRunnerStopped = errors.New("Runner Stopped")
+
+const (
+	defaultRunnerInterval = 30 * time.Second
+	maxRunnerJitter       = 0.9
+)
+
+// InterfacesStateFn returns a state of the network interfaces, an announce is
+// sent when it changes.
+type InterfacesStateFn func() (string, error)
+
+// Runner announces the service periodically. It sends a burst of alives on
+// start and when the interfaces change, single alives on a jittered
+// interval, and the deaths on stop.
+type Runner struct {
+	ctrl            *Controller
+	burst           int
+	interval        time.Duration
+	jitter          float64
+	refreshInterval time.Duration
+	watchInterval   time.Duration
+	interfacesFn    InterfacesStateFn
+	cancel          context.CancelFunc
+	done            chan struct{}
+	lock            *sync.Mutex
+}
+
+// Start refreshes the token and starts to announce.
+func (r *Runner) Start() (err error) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cancel != nil {
+		err = ErrRunnerStarted
+		return
+	}
+
+	r.ctrl.service.RefreshToken()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.run(ctx, r.done)
+	return
+}
+
+// Stop stops to announce and broadcasts the deaths, so the other peers mark
+// this one offline without waiting for the ttl.
+func (r *Runner) Stop() (err error) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cancel == nil {
+		err = ErrRunnerStopped
+		return
+	}
+
+	r.cancel()
+	<-r.done
+	r.cancel = nil
+	r.done = nil
+
+	err = r.ctrl.broadcastDead(context.Background(), 2)
+	return
+}
+
+// run ...
+func (r *Runner) run(ctx context.Context, done chan struct{}) {
+
+	defer close(done)
+
+	// errors of a round are dropped, the next round retries.
+	_ = r.ctrl.broadcastAlive(ctx, r.burst)
+
+	announce := time.NewTimer(r.nextInterval())
+	defer announce.Stop()
+
+	var refresh <-chan time.Time
+	if r.refreshInterval > 0 {
+		refreshTicker := time.NewTicker(r.refreshInterval)
+		defer refreshTicker.Stop()
+		refresh = refreshTicker.C
+	}
+
+	var watch <-chan time.Time
+	var state string
+	if r.watchInterval > 0 && r.interfacesFn != nil {
+		state, _ = r.interfacesFn()
+		watchTicker := time.NewTicker(r.watchInterval)
+		defer watchTicker.Stop()
+		watch = watchTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-announce.C:
+			_ = r.ctrl.broadcastAlive(ctx, 1)
+		case <-refresh:
+			r.ctrl.service.RefreshToken()
+			_ = r.ctrl.broadcastAlive(ctx, r.burst)
+		case <-watch:
+			current, err := r.interfacesFn()
+			if err != nil || current == state {
+				continue
+			}
+			state = current
+			_ = r.ctrl.broadcastAlive(ctx, r.burst)
+		}
+		if !announce.Stop() {
+			select {
+			case <-announce.C:
+			default:
+			}
+		}
+		announce.Reset(r.nextInterval())
+	}
+}
+
+// nextInterval is the interval with a random jitter, so peers started
+// together do not announce together.
+func (r *Runner) nextInterval() time.Duration {
+	delta := r.jitter * (2*rand.Float64() - 1)
+	return time.Duration(float64(r.interval) * (1 + delta))
+}
+
+// interfacesState is the up interfaces with their addresses.
+func interfacesState() (state string, err error) {
+
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	items := make([]string, 0)
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, addrErr := ifi.Addrs()
+		if addrErr != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			items = append(items, ifi.Name+"/"+addr.String())
+		}
+	}
+	sort.Strings(items)
+	state = strings.Join(items, ",")
+	return
+}
+
+type newRunnerConfig struct {
+	burst           int
+	interval        time.Duration
+	jitter          float64
+	refreshInterval time.Duration
+	watchInterval   time.Duration
+	interfacesFn    InterfacesStateFn
+}
+
+type NewRunnerWithFn func(cfg *newRunnerConfig)
+
+// NewRunnerWithBurst sets how many alives are sent on start, on refresh and
+// when the interfaces change.
+func NewRunnerWithBurst(times int) NewRunnerWithFn {
+	return func(cfg *newRunnerConfig) {
+		cfg.burst = times
+	}
+}
+
+// NewRunnerWithInterval sets the interval of alives, every interval is
+// changed by a random jitter in [-jitter, jitter] of it. A non-positive
+// interval is the default one, the jitter is clamped to [0, 0.9].
+func NewRunnerWithInterval(interval time.Duration, jitter float64) NewRunnerWithFn {
+	return func(cfg *newRunnerConfig) {
+		cfg.interval = interval
+		cfg.jitter = jitter
+	}
+}
+
+// NewRunnerWithRefreshInterval sets how often the seq and token are
+// refreshed, a non-positive interval refreshes them on start only.
+func NewRunnerWithRefreshInterval(interval time.Duration) NewRunnerWithFn {
+	return func(cfg *newRunnerConfig) {
+		cfg.refreshInterval = interval
+	}
+}
+
+// NewRunnerWithWatchInterval sets how often the interfaces are checked, a
+// non-positive interval does not check them.
+func NewRunnerWithWatchInterval(interval time.Duration) NewRunnerWithFn {
+	return func(cfg *newRunnerConfig) {
+		cfg.watchInterval = interval
+	}
+}
+
+// NewRunnerWithInterfacesStateFn replaces the state of the interfaces.
+func NewRunnerWithInterfacesStateFn(fn InterfacesStateFn) NewRunnerWithFn {
+	return func(cfg *newRunnerConfig) {
+		cfg.interfacesFn = fn
+	}
+}
+
+// NewRunner ...
+func NewRunner(ctrl *Controller, withFns ...NewRunnerWithFn) *Runner {
+
+	cfg := new(newRunnerConfig)
+	cfg.burst = 5
+	cfg.interval = defaultRunnerInterval
+	cfg.jitter = 0.2
+	cfg.refreshInterval = time.Hour
+	cfg.watchInterval = 5 * time.Second
+	cfg.interfacesFn = interfacesState
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+
+	// a non-positive interval would announce in a busy loop
+	if cfg.interval <= 0 {
+		cfg.interval = defaultRunnerInterval
+	}
+	cfg.jitter = min(max(cfg.jitter, 0), maxRunnerJitter)
+	cfg.refreshInterval = max(cfg.refreshInterval, 0)
+	cfg.watchInterval = max(cfg.watchInterval, 0)
+
+	r := new(Runner)
+	r.ctrl = ctrl
+	r.burst = cfg.burst
+	r.interval = cfg.interval
+	r.jitter = cfg.jitter
+	r.refreshInterval = cfg.refreshInterval
+	r.watchInterval = cfg.watchInterval
+	r.interfacesFn = cfg.interfacesFn
+	r.lock = new(sync.Mutex)
+	return r
+}
@@ -0,0 +1,162 @@
+package broadcast_test
+
+import (
+	"errors"
+	"pan/broadcast"
+	"pan/core"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mocked "pan/mocks/pan/broadcast"
+	peerMocked "pan/mocks/pan/peer"
+	"pan/peer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newRunnerNet records the methods written to it.
+func newRunnerNet() (network *mocked.MockNet, methods func() []string) {
+	lock := new(sync.Mutex)
+	written := make([]string, 0)
+	network = new(mocked.MockNet)
+	network.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		packet, _, _ := broadcast.ParsePacket(args.Get(0).([]byte))
+		method, _, _ := core.ParsePacket(packet, 0)
+		lock.Lock()
+		written = append(written, string(method))
+		lock.Unlock()
+	})
+	methods = func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), written...)
+	}
+	return
+}
+
+// newRunnerController ...
+func newRunnerController(t *testing.T, network broadcast.Net) *broadcast.Controller {
+	serveInfo := new(broadcast.ServeInfo)
+	serveInfo.Port = int32(9000)
+	serveInfo.Type = []byte{peer.QUICNodeType}
+	settings, _ := newServiceSettings(t)
+	service := broadcast.NewService(new(mocked.MockRepo), new(peerMocked.MockPeer), settings, serveInfo)
+	return broadcast.NewController(service, network)
+}
+
+// TestRunner ...
+func TestRunner(t *testing.T) {
+
+	t.Run("Start and Stop", func(t *testing.T) {
+
+		network, methods := newRunnerNet()
+		runner := broadcast.NewRunner(
+			newRunnerController(t, network),
+			broadcast.NewRunnerWithBurst(1),
+			broadcast.NewRunnerWithInterval(10*time.Millisecond, 0.5),
+			broadcast.NewRunnerWithWatchInterval(0),
+		)
+
+		err := runner.Start()
+		assert.Nil(t, err, "Error should be nil")
+		assert.ErrorIs(t, runner.Start(), broadcast.ErrRunnerStarted, "Error should be started")
+
+		assert.Eventually(t, func() bool {
+			return len(methods()) >= 3
+		}, time.Second, time.Millisecond, "Alive should be announced periodically")
+
+		err = runner.Stop()
+		assert.Nil(t, err, "Error should be nil")
+		assert.ErrorIs(t, runner.Stop(), broadcast.ErrRunnerStopped, "Error should be stopped")
+
+		written := methods()
+		assert.Equal(t, []string{"dead", "dead"}, written[len(written)-2:], "Dead should be sent on stop")
+		for _, method := range written[:len(written)-2] {
+			assert.Equal(t, "alive", method, "Alive should be sent before stop")
+		}
+	})
+
+	t.Run("Start with interfaces change", func(t *testing.T) {
+
+		network, methods := newRunnerNet()
+		var changed atomic.Bool
+		runner := broadcast.NewRunner(
+			newRunnerController(t, network),
+			broadcast.NewRunnerWithBurst(1),
+			broadcast.NewRunnerWithInterval(time.Hour, 0),
+			broadcast.NewRunnerWithWatchInterval(time.Millisecond),
+			broadcast.NewRunnerWithInterfacesStateFn(func() (string, error) {
+				if changed.Load() {
+					return "eth0/192.168.1.2/24", nil
+				}
+				return "eth0/192.168.1.1/24", nil
+			}),
+		)
+
+		err := runner.Start()
+		assert.Nil(t, err, "Error should be nil")
+		assert.Eventually(t, func() bool {
+			return len(methods()) == 1
+		}, time.Second, time.Millisecond, "Alive should be announced on start")
+
+		changed.Store(true)
+		assert.Eventually(t, func() bool {
+			return len(methods()) == 2
+		}, time.Second, time.Millisecond, "Alive should be announced on change")
+
+		_ = runner.Stop()
+	})
+
+	t.Run("Start with interfaces error", func(t *testing.T) {
+
+		network, methods := newRunnerNet()
+		var calls atomic.Int32
+		runner := broadcast.NewRunner(
+			newRunnerController(t, network),
+			broadcast.NewRunnerWithBurst(1),
+			broadcast.NewRunnerWithInterval(time.Hour, 0),
+			broadcast.NewRunnerWithWatchInterval(time.Millisecond),
+			broadcast.NewRunnerWithInterfacesStateFn(func() (string, error) {
+				if calls.Add(1) > 1 {
+					return "", errors.New("Interfaces Error")
+				}
+				return "eth0/192.168.1.1/24", nil
+			}),
+		)
+
+		err := runner.Start()
+		assert.Nil(t, err, "Error should be nil")
+		assert.Eventually(t, func() bool {
+			return calls.Load() > 3
+		}, time.Second, time.Millisecond, "Interfaces should be watched")
+		assert.Equal(t, []string{"alive"}, methods(), "Alive should not be announced on error")
+
+		_ = runner.Stop()
+	})
+
+	t.Run("Start with non-positive intervals", func(t *testing.T) {
+
+		network, methods := newRunnerNet()
+		runner := broadcast.NewRunner(
+			newRunnerController(t, network),
+			broadcast.NewRunnerWithBurst(1),
+			broadcast.NewRunnerWithInterval(0, 2),
+			broadcast.NewRunnerWithRefreshInterval(-time.Second),
+			broadcast.NewRunnerWithWatchInterval(-time.Second),
+		)
+
+		err := runner.Start()
+		assert.Nil(t, err, "Error should be nil")
+		assert.Eventually(t, func() bool {
+			return len(methods()) == 1
+		}, time.Second, time.Millisecond, "Alive should be announced on start")
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, []string{"alive"}, methods(), "Alive should not be announced in a busy loop")
+
+		_ = runner.Stop()
+	})
+
+}
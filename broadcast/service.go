@@ -2,10 +2,15 @@ package broadcast
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"net"
 	"strconv"
 
+	"pan/core"
 	"pan/peer"
 	"sync"
 	"time"
@@ -13,6 +18,29 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// ErrInvalidMessage is returned for messages that are dropped, because
+// their signature or key does not match.
+var ErrInvalidMessage = errors.New("Invalid Message")
+
+// ErrUnreachablePeer is returned for alives whose serve infos can not be
+// dialed or authenticated, the failures of every route are joined into it.
+var ErrUnreachablePeer = errors.New("Unreachable Peer")
+
+const messageHash = crypto.SHA256
+
+const serviceTokenSize = 32
+
+type ServiceSettings interface {
+	// PrivateKey is the pem encoded key that signs the messages.
+	PrivateKey() []byte
+	// Certificate is the pem encoded certificate of the key, it is the
+	// certificate of the peer nodes as well.
+	Certificate() []byte
+	// PeerId is the PeerId which the other peers generate for the node, the
+	// records of the receivers are keyed by it.
+	PeerId() []byte
+}
+
 type Service struct {
 	serveInfos []*ServeInfo
 	repo       Repo
@@ -20,13 +48,57 @@ type Service struct {
 	token      []byte
 	rw         *sync.RWMutex
 	pr         peer.Peer
+	settings   ServiceSettings
+	seen       *seenCache
+	presence   *Presence
+	events     peer.EventBus
+}
+
+// UsePresence feeds the received records to the presence.
+func (s *Service) UsePresence(presence *Presence) {
+	s.rw.Lock()
+	s.presence = presence
+	s.rw.Unlock()
+}
+
+// UseEventBus publishes PeerDiscovered and PeerDead events to the bus.
+func (s *Service) UseEventBus(events peer.EventBus) {
+	s.rw.Lock()
+	s.events = events
+	s.rw.Unlock()
 }
 
-// TokenRefresh ...
+// publish publishes the event of the record, if there is an event bus.
+func (s *Service) publish(eventType peer.EventType, rd *Record) {
+	s.rw.RLock()
+	events := s.events
+	s.rw.RUnlock()
+
+	if events == nil || len(rd.PeerId) != len(peer.PeerId{}) {
+		return
+	}
+	event := peer.NewEvent(eventType, peer.PeerId(rd.PeerId))
+	event.Addr = rd.Addr
+	events.Publish(event)
+}
+
+// usedPresence ...
+func (s *Service) usedPresence() *Presence {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.presence
+}
+
+// RefreshToken starts a new seq and token, the seq keeps increasing even
+// when it is refreshed twice in a second.
 func (s *Service) RefreshToken() {
+	// a new token is allocated, generated messages keep the old one.
+	token := make([]byte, serviceTokenSize)
+	rand.Read(token)
+
 	s.rw.Lock()
-	s.seq = time.Now().Unix()
-	rand.Read(s.token)
+	s.seq = max(time.Now().Unix(), s.seq+1)
+	s.token = token
 	s.rw.Unlock()
 }
 
@@ -40,6 +112,12 @@ func (s *Service) GenerateAliveMessage() (payload []byte, err error) {
 	s.rw.RUnlock()
 
 	msg.ServeInfos = s.serveInfos
+	msg.PeerId = s.settings.PeerId()
+	msg.Certificate = s.settings.Certificate()
+	msg.Signature, err = core.SignWithPrivateKey(s.settings.PrivateKey(), aliveSignData(msg), messageHash)
+	if err != nil {
+		return
+	}
 	payload, err = proto.Marshal(msg)
 
 	return
@@ -52,53 +130,142 @@ func (s *Service) RecvAliveMessage(addr []byte, payload []byte) (err error) {
 	if err != nil {
 		return
 	}
-	// Implement: Intercept invalid messages
 
-	rd, err := s.repo.FindOneWithAddrAndSeq(addr, msg.Seq)
-	if err != nil || (rd != nil && rd.Seq >= msg.Seq) {
+	// duplicates are dropped before they reach the repo or the dialer, the
+	// key is added after verifying, so forged messages can not shadow it.
+	key := seenKey([]byte("alive"), addr, msg.Seq, msg.Token)
+	if s.seen.Has(key) {
 		return
 	}
-	ip, _, err := net.SplitHostPort(string(addr))
+
+	pubKey, err := verifyMessage(msg.Certificate, aliveSignData(msg), msg.Signature)
 	if err != nil {
 		return
 	}
-	if rd == nil {
-		rd = new(Record)
+	if !s.seen.Add(key) {
+		return
 	}
+	defer func() {
+		// the repeated alive retries a failed one
+		if err != nil {
+			s.seen.Forget(key)
+		}
+	}()
 
-	// Implement: verify alive message
+	// the record is found by the claimed PeerId, so a peer which moves to
+	// another addr keeps its record. The same seq from another addr adds the
+	// addr. The claim is checked by authenticating the nodes.
+	claimed, err := parseMessagePeerId(msg.PeerId)
+	if err != nil {
+		return
+	}
+	rd, err := s.repo.FindOneWithPeerId(claimed[:])
+	if err != nil {
+		return
+	}
+	if rd != nil && (rd.Seq > msg.Seq || (rd.Seq == msg.Seq && (rd.DeathTime > 0 || bytes.Equal(rd.Addr, addr)))) {
+		return
+	}
+	ip, _, err := net.SplitHostPort(string(addr))
+	if err != nil {
+		return
+	}
+	rd = new(Record)
+
+	// a route which fails is skipped, the alive fails only if no route is
+	// authenticated.
+	routeErrs := make([]error, 0)
 	for _, serveInfo := range msg.ServeInfos {
-		switch serveInfo.Type[0] {
+		if len(serveInfo.Type) == 0 {
+			continue
+		}
+		var nodeAddr []byte
+		nodeType := serveInfo.Type[0]
+		addrString := net.JoinHostPort(ip, strconv.Itoa(int(serveInfo.Port)))
+		switch nodeType {
 		case peer.QUICNodeType:
-			addrString := net.JoinHostPort(ip, strconv.Itoa(int(serveInfo.Port)))
 			udpAddr, addrErr := net.ResolveUDPAddr("udp", addrString)
 			if addrErr != nil {
 				err = addrErr
 				return
 			}
-			quicAddr := peer.MarshalQUICAddr(udpAddr)
-			node, connErr := s.pr.Connect(peer.QUICNodeType, quicAddr)
-			if connErr != nil {
+			nodeAddr = peer.MarshalQUICAddr(udpAddr)
+		case peer.TCPNodeType:
+			tcpAddr, addrErr := net.ResolveTCPAddr("tcp", addrString)
+			if addrErr != nil {
 				err = addrErr
 				return
 			}
-			peerId, authErr := s.pr.Authenticate(node, peer.NormalAuthenticateMode)
-			if authErr != nil {
-				err = authErr
-				node.Close()
-				return
-			}
-			rd.PeerId = peerId[:]
+			nodeAddr = peer.MarshalTCPAddr(tcpAddr)
+		default:
+			continue
+		}
+
+		// every reachable transport is authenticated, so the route table
+		// learns all of them and Peer.Open can fall back between them.
+		node, connErr := s.pr.Connect(nodeType, nodeAddr)
+		if connErr != nil {
+			routeErrs = append(routeErrs, connErr)
+			continue
+		}
+		// the node must serve the key that signed the message, otherwise
+		// the message announces somebody else.
+		keyErr := verifyNodeKey(node, pubKey)
+		if keyErr != nil {
+			routeErrs = append(routeErrs, keyErr)
+			node.Close()
+			continue
+		}
+		// authenticate exchanges the revocation lists as well, so every
+		// alive round spreads new revocations.
+		peerId, authErr := s.pr.Authenticate(node, peer.NormalAuthenticateMode)
+		if authErr != nil {
+			routeErrs = append(routeErrs, authErr)
+			node.Close()
+			continue
+		}
+		if peerId != claimed {
+			routeErrs = append(routeErrs, fmt.Errorf("%w: Mismatch PeerId", ErrInvalidMessage))
+			node.Close()
+			continue
 		}
+		rd.PeerId = peerId[:]
+
+		recordAddr := new(RecordAddr)
+		recordAddr.Type = nodeType
+		recordAddr.Addr = []byte(addrString)
+		rd.Addrs = append(rd.Addrs, recordAddr)
+	}
+
+	// a record is saved only for an authenticated PeerId, the serve infos
+	// may be empty or of unknown types.
+	if rd.PeerId == nil {
+		if len(routeErrs) > 0 {
+			err = fmt.Errorf("%w: %w", ErrUnreachablePeer, errors.Join(routeErrs...))
+		}
+		return
 	}
 
-	// Implement: set node online
 	rd.Seq = msg.Seq
 	rd.Token = msg.Token
 	rd.Addr = addr
+	rd.PublicKey = pubKey
 	err = s.repo.Save(rd)
+	if errors.Is(err, ErrStaleRecord) {
+		// a newer alive is saved meanwhile
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
 
-	return err
+	presence := s.usedPresence()
+	if presence != nil {
+		presence.Alive(rd)
+	}
+	s.publish(peer.PeerDiscoveredEvent, rd)
+	return
 }
 
 func (s *Service) GenerateDeadMessage() (payload []byte, err error) {
@@ -109,6 +276,12 @@ func (s *Service) GenerateDeadMessage() (payload []byte, err error) {
 	msg.Token = s.token
 	s.rw.RUnlock()
 
+	msg.PeerId = s.settings.PeerId()
+	msg.Certificate = s.settings.Certificate()
+	msg.Signature, err = core.SignWithPrivateKey(s.settings.PrivateKey(), deathSignData(msg), messageHash)
+	if err != nil {
+		return
+	}
 	payload, err = proto.Marshal(msg)
 	return
 }
@@ -120,40 +293,148 @@ func (s *Service) RecvDeadMessage(addr []byte, payload []byte) error {
 	if err != nil {
 		return err
 	}
-	// Implement: Intercept invalid messages
-	rd, err := s.repo.FindOneWithAddrAndSeq(addr, msg.Seq)
-	if err != nil || rd == nil || rd.DeathTime > 0 || rd.Seq != msg.Seq || !bytes.Equal(rd.Token, msg.Token) {
+
+	key := seenKey([]byte("dead"), addr, msg.Seq, msg.Token)
+	if s.seen.Has(key) {
+		return nil
+	}
+
+	pubKey, err := verifyMessage(msg.Certificate, deathSignData(msg), msg.Signature)
+	if err != nil {
 		return err
 	}
+	if !s.seen.Add(key) {
+		return nil
+	}
 
-	// Implement: verify death message
-	if rd.PeerId != nil {
-		peerId := peer.PeerId(rd.PeerId)
-		state := s.pr.Stat(peerId)
-		if state != peer.OfflinePeerState {
-			// TODO: clean peer node ?
-		}
+	// the record is found by the PeerId, only the key that announced the
+	// record may declare its death.
+	claimed, err := parseMessagePeerId(msg.PeerId)
+	if err != nil {
+		return err
+	}
+	rd, err := s.repo.FindOneWithPeerId(claimed[:])
+	if err != nil || rd == nil || !bytes.Equal(rd.PublicKey, pubKey) {
+		return err
+	}
+	if rd.DeathTime > 0 || rd.Seq != msg.Seq || !bytes.Equal(rd.Token, msg.Token) {
+		return nil
 	}
 
-	// Implement: set node offline
-	rd.Seq = msg.Seq
-	rd.Token = msg.Token
 	rd.Addr = addr
 	rd.DeathTime = time.Now().Unix()
+	// the addrs are not observed by a death
+	rd.Addrs = nil
 	err = s.repo.Save(rd)
+	if errors.Is(err, ErrStaleRecord) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	return err
+	presence := s.usedPresence()
+	if presence != nil {
+		presence.Dead(rd)
+	}
+	s.publish(peer.PeerDeadEvent, rd)
+	return nil
 }
 
 // NewService ...
-func NewService(repo Repo, pr peer.Peer, serveInfos ...*ServeInfo) *Service {
+func NewService(repo Repo, pr peer.Peer, settings ServiceSettings, serveInfos ...*ServeInfo) *Service {
 	service := new(Service)
+	service.settings = settings
 	service.serveInfos = serveInfos
 	service.repo = repo
-	service.token = make([]byte, 32)
+	service.token = make([]byte, serviceTokenSize)
 	service.rw = new(sync.RWMutex)
 	service.pr = pr
+	service.seen = newSeenCache(10*time.Minute, 4096)
 
 	service.RefreshToken()
 	return service
 }
+
+// aliveSignData is the data signed in alive message, it covers seq, token
+// and serve infos.
+func aliveSignData(msg *Alive) []byte {
+	data := signData([]byte("alive"), msg.Seq, msg.Token)
+	data = appendSignField(data, msg.PeerId)
+	for _, serveInfo := range msg.ServeInfos {
+		data = binary.BigEndian.AppendUint32(data, uint32(serveInfo.Port))
+		data = appendSignField(data, serveInfo.Type)
+	}
+	return data
+}
+
+// deathSignData is the data signed in death message.
+func deathSignData(msg *Death) []byte {
+	data := signData([]byte("dead"), msg.Seq, msg.Token)
+	data = appendSignField(data, msg.PeerId)
+	return data
+}
+
+// signData ...
+func signData(method []byte, seq int64, token []byte) []byte {
+	data := appendSignField(nil, method)
+	data = binary.BigEndian.AppendUint64(data, uint64(seq))
+	data = appendSignField(data, token)
+	return data
+}
+
+// appendSignField appends the field with its size, so that fields can not
+// be shifted into each other.
+func appendSignField(data []byte, field []byte) []byte {
+	data = binary.BigEndian.AppendUint16(data, uint16(len(field)))
+	return append(data, field...)
+}
+
+// verifyMessage checks the signature with the public key of the
+// certificate and returns the public key.
+func verifyMessage(cert, data, sig []byte) (pubKey []byte, err error) {
+	x509Cert, err := core.ParseCertWithPem(cert)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+		return
+	}
+
+	pubKey, err = core.ExtractPublicKeyFromCert(x509Cert)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+		return
+	}
+
+	err = core.VerifyWithPublicKey(pubKey, data, sig, messageHash)
+	if err != nil {
+		pubKey = nil
+		err = fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+	return
+}
+
+// parseMessagePeerId ...
+func parseMessagePeerId(data []byte) (peerId peer.PeerId, err error) {
+	if len(data) != len(peerId) {
+		err = fmt.Errorf("%w: Invalid PeerId", ErrInvalidMessage)
+		return
+	}
+	peerId = peer.PeerId(data)
+	return
+}
+
+// verifyNodeKey checks the node certificate holds the public key, the peer
+// generator derives the PeerId from it.
+func verifyNodeKey(node peer.Node, pubKey []byte) (err error) {
+	cert := node.Certificate()
+	if cert == nil {
+		err = fmt.Errorf("%w: Missing Node Certificate", ErrInvalidMessage)
+		return
+	}
+
+	nodeKey, err := core.ExtractPublicKeyFromCert(cert)
+	if err == nil && !bytes.Equal(nodeKey, pubKey) {
+		err = fmt.Errorf("%w: Mismatch Public Key", ErrInvalidMessage)
+	}
+	return
+}
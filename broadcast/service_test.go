@@ -1 +1,549 @@
 package broadcast_test
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"pan/broadcast"
+	"pan/core"
+	"strconv"
+	"testing"
+	"time"
+
+	mocked "pan/mocks/pan/broadcast"
+	peerMocked "pan/mocks/pan/peer"
+	"pan/peer"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestKeyAndCert generates a key with its pem and parsed certificate and
+// the public key of it.
+func newTestKeyAndCert(t *testing.T) (key []byte, cert []byte, x509Cert *x509.Certificate, pubKey []byte) {
+	key, cert, err := core.GenerateKeyAndCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x509Cert, err = core.ParseCertWithPem(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err = core.ExtractPublicKeyFromCert(x509Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// newServiceSettings ...
+func newServiceSettings(t *testing.T) (settings *mocked.MockServiceSettings, cert *x509.Certificate) {
+	key, certPem, cert, _ := newTestKeyAndCert(t)
+
+	peerId := uuid.New()
+	settings = new(mocked.MockServiceSettings)
+	settings.On("PrivateKey").Maybe().Return(key)
+	settings.On("Certificate").Maybe().Return(certPem)
+	settings.On("PeerId").Maybe().Return(peerId[:])
+	return
+}
+
+// TestService ...
+func TestService(t *testing.T) {
+
+	quicServeInfo := new(broadcast.ServeInfo)
+	quicServeInfo.Port = int32(9000)
+	quicServeInfo.Type = []byte{peer.QUICNodeType}
+	addr := []byte(net.JoinHostPort("127.0.0.1", "9000"))
+
+	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(quicServeInfo.Port))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	quicAddr := peer.MarshalQUICAddr(udpAddr)
+
+	t.Run("RefreshToken while generating messages", func(t *testing.T) {
+
+		settings, _ := newServiceSettings(t)
+		service := broadcast.NewService(new(mocked.MockRepo), new(peerMocked.MockPeer), settings, quicServeInfo)
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					service.RefreshToken()
+				}
+			}
+		}()
+
+		for i := 0; i < 20; i++ {
+			payload, err := service.GenerateAliveMessage()
+			assert.Nil(t, err, "Error should be nil")
+			alive := new(broadcast.Alive)
+			_ = proto.Unmarshal(payload, alive)
+			assert.NotEmpty(t, alive.Token, "Alive token should not be empty")
+
+			payload, err = service.GenerateDeadMessage()
+			assert.Nil(t, err, "Error should be nil")
+			death := new(broadcast.Death)
+			_ = proto.Unmarshal(payload, death)
+			assert.NotEmpty(t, death.Token, "Death token should not be empty")
+		}
+		close(stop)
+		<-done
+	})
+
+	t.Run("RecvAliveMessage with forged serve infos", func(t *testing.T) {
+
+		settings, _ := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+		msg.ServeInfos[0].Port = 22
+		payload, _ = proto.Marshal(msg)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.ErrorIs(t, err, broadcast.ErrInvalidMessage, "Error should be invalid message")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage with other node key", func(t *testing.T) {
+
+		settings, _ := newServiceSettings(t)
+		_, _, otherCert, _ := newTestKeyAndCert(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		node := new(peerMocked.MockNode)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Once().Return(node, nil)
+		node.On("Certificate").Once().Return(otherCert)
+		node.On("Close").Once().Return(nil)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.ErrorIs(t, err, broadcast.ErrInvalidMessage, "Error should be invalid message")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage with other PeerId", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		node := new(peerMocked.MockNode)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		// the authenticated PeerId differs from the claimed one, so nothing
+		// is saved for the claim.
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Once().Return(node, nil)
+		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peer.PeerId(uuid.New()), nil)
+		node.On("Certificate").Once().Return(cert)
+		node.On("Close").Once().Return(nil)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.ErrorIs(t, err, broadcast.ErrInvalidMessage, "Error should be invalid message")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage without serve type", func(t *testing.T) {
+
+		emptyServeInfo := new(broadcast.ServeInfo)
+		emptyServeInfo.Port = int32(9000)
+
+		settings, _ := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, emptyServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		// no route is authenticated, so no record is saved
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		node := new(peerMocked.MockNode)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+		presence := broadcast.NewPresence(pr, time.Minute)
+		service.UsePresence(presence)
+		events := peer.NewEventBus()
+		sub := events.Subscribe(1)
+		service.UseEventBus(events)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		peerId := peer.PeerId(msg.PeerId)
+		pubKey, _ := core.ExtractPublicKeyFromCert(cert)
+		var rd *broadcast.Record
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
+		repo.On("Save", mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
+			rd = args.Get(0).(*broadcast.Record)
+		})
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Once().Return(node, nil)
+		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peerId, nil)
+		node.On("Certificate").Once().Return(cert)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peerId[:], rd.PeerId, "PeerId should be same")
+		assert.Equal(t, pubKey, rd.PublicKey, "PublicKey should be same")
+		assert.Len(t, rd.Addrs, 1, "Addr of serve info should be observed")
+		assert.Equal(t, peer.QUICNodeType, rd.Addrs[0].Type, "Type should be same")
+		assert.Equal(t, []byte(net.JoinHostPort("127.0.0.1", "9000")), rd.Addrs[0].Addr, "Addr should be same")
+		assert.Equal(t, []peer.PeerId{peerId}, presence.Online(), "Peer should be online")
+		event := <-sub.C
+		assert.Equal(t, peer.PeerDiscoveredEvent, event.Type, "Event should be discovered")
+		assert.Equal(t, peerId, event.PeerId, "PeerId should be same")
+		assert.Equal(t, addr, event.Addr, "Addr should be same")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage with older seq", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		pubKey, _ := core.ExtractPublicKeyFromCert(cert)
+		rd := new(broadcast.Record)
+		rd.Seq = msg.Seq + 1
+		rd.PublicKey = pubKey
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(rd, nil)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage from other addr", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		node := new(peerMocked.MockNode)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		// the peer moves to another addr with the same seq, the record of
+		// its key gets the new addr.
+		peerId := peer.PeerId(msg.PeerId)
+		pubKey, _ := core.ExtractPublicKeyFromCert(cert)
+		current := new(broadcast.Record)
+		current.PeerId = peerId[:]
+		current.Seq = msg.Seq
+		current.Token = msg.Token
+		current.Addr = []byte(net.JoinHostPort("192.168.1.2", "9000"))
+		current.PublicKey = pubKey
+		var rd *broadcast.Record
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(current, nil)
+		repo.On("Save", mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
+			rd = args.Get(0).(*broadcast.Record)
+		})
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Once().Return(node, nil)
+		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peerId, nil)
+		node.On("Certificate").Once().Return(cert)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peerId[:], rd.PeerId, "PeerId should be same")
+		assert.Equal(t, addr, rd.Addr, "Addr should be new one")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage with stale record", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		node := new(peerMocked.MockNode)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+		presence := broadcast.NewPresence(pr, time.Minute)
+		service.UsePresence(presence)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
+		repo.On("Save", mock.Anything).Once().Return(broadcast.ErrStaleRecord)
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Once().Return(node, nil)
+		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peer.PeerId(msg.PeerId), nil)
+		node.On("Certificate").Once().Return(cert)
+
+		err = service.RecvAliveMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Empty(t, presence.Online(), "Stale record should not be online")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage with duplicate", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		node := new(peerMocked.MockNode)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(nil, nil)
+		repo.On("Save", mock.Anything).Once().Return(nil)
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Once().Return(node, nil)
+		pr.On("Authenticate", node, peer.NormalAuthenticateMode).Once().Return(peer.PeerId(msg.PeerId), nil)
+		node.On("Certificate").Once().Return(cert)
+
+		err = service.RecvAliveMessage(addr, payload)
+		assert.Nil(t, err, "Error should be nil")
+
+		err = service.RecvAliveMessage(addr, payload)
+		assert.Nil(t, err, "Error should be nil")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("RecvAliveMessage retries failed one", func(t *testing.T) {
+
+		settings, _ := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateAliveMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Alive)
+		_ = proto.Unmarshal(payload, msg)
+
+		connErr := errors.New("Connect Error")
+		repo.On("FindOneWithPeerId", msg.PeerId).Twice().Return(nil, nil)
+		pr.On("Connect", peer.QUICNodeType, quicAddr).Twice().Return(nil, connErr)
+
+		err = service.RecvAliveMessage(addr, payload)
+		assert.ErrorIs(t, err, connErr, "Error should be connect error")
+
+		err = service.RecvAliveMessage(addr, payload)
+		assert.ErrorIs(t, err, connErr, "Error should be connect error")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvDeadMessage with duplicate", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateDeadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Death)
+		_ = proto.Unmarshal(payload, msg)
+
+		pubKey, _ := core.ExtractPublicKeyFromCert(cert)
+		rd := new(broadcast.Record)
+		rd.Seq = msg.Seq
+		rd.Token = msg.Token
+		rd.PublicKey = pubKey
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(rd, nil)
+		repo.On("Save", rd).Once().Return(nil)
+
+		err = service.RecvDeadMessage(addr, payload)
+		assert.Nil(t, err, "Error should be nil")
+
+		err = service.RecvDeadMessage(addr, payload)
+		assert.Nil(t, err, "Error should be nil")
+		assert.NotZero(t, rd.DeathTime, "DeathTime should be set")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvDeadMessage with presence", func(t *testing.T) {
+
+		settings, cert := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+		presence := broadcast.NewPresence(pr, time.Minute)
+		service.UsePresence(presence)
+		events := peer.NewEventBus()
+		sub := events.Subscribe(1, peer.PeerDeadEvent)
+		service.UseEventBus(events)
+
+		payload, err := service.GenerateDeadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Death)
+		_ = proto.Unmarshal(payload, msg)
+
+		peerId := peer.PeerId(msg.PeerId)
+		pubKey, _ := core.ExtractPublicKeyFromCert(cert)
+		rd := new(broadcast.Record)
+		rd.PeerId = peerId[:]
+		rd.Seq = msg.Seq
+		rd.Token = msg.Token
+		rd.PublicKey = pubKey
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(rd, nil)
+		repo.On("Save", rd).Once().Return(nil)
+		pr.On("Disconnect", peerId).Once().Return(nil)
+		pr.On("Stat", peerId).Once().Return(peer.UnknownPeerState)
+
+		err = service.RecvDeadMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peer.OfflinePeerState, presence.Stat(peerId), "State should be offline")
+		assert.Equal(t, peerId, (<-sub.C).PeerId, "Dead event should be published")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvDeadMessage with other key", func(t *testing.T) {
+
+		settings, _ := newServiceSettings(t)
+		_, _, _, otherPubKey := newTestKeyAndCert(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateDeadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Death)
+		_ = proto.Unmarshal(payload, msg)
+
+		// the record of the PeerId is announced by another key, so it can
+		// not be declared dead by this key.
+		rd := new(broadcast.Record)
+		rd.PeerId = msg.PeerId
+		rd.Seq = msg.Seq
+		rd.Token = msg.Token
+		rd.PublicKey = otherPubKey
+		repo.On("FindOneWithPeerId", msg.PeerId).Once().Return(rd, nil)
+
+		err = service.RecvDeadMessage(addr, payload)
+
+		assert.Nil(t, err, "Error should be nil")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+	t.Run("RecvDeadMessage with invalid signature", func(t *testing.T) {
+
+		settings, _ := newServiceSettings(t)
+		repo := new(mocked.MockRepo)
+		pr := new(peerMocked.MockPeer)
+		service := broadcast.NewService(repo, pr, settings, quicServeInfo)
+
+		payload, err := service.GenerateDeadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := new(broadcast.Death)
+		_ = proto.Unmarshal(payload, msg)
+		msg.Signature = []byte("forged")
+		payload, _ = proto.Marshal(msg)
+
+		err = service.RecvDeadMessage(addr, payload)
+
+		assert.True(t, errors.Is(err, broadcast.ErrInvalidMessage), "Error should be invalid message")
+		repo.AssertExpectations(t)
+		pr.AssertExpectations(t)
+	})
+
+}
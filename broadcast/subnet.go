@@ -0,0 +1,133 @@
+package broadcast
+
+import (
+	"errors"
+	"net"
+)
+
+var ErrNoBroadcastAddr = errors.New("No Broadcast Address")
+
+type subnetBroadcastSt struct {
+	conn       *net.UDPConn
+	port       int
+	addrs      []*net.UDPAddr
+	bufferSize int
+}
+
+// Read ...
+func (b *subnetBroadcastSt) Read(size int) (payload []byte, srcAddr []byte, err error) {
+	return readUDP(b.conn, size, b.bufferSize)
+}
+
+// Write sends the payload to the broadcast address of every subnet, the
+// subnets are looked up on each write so new interfaces are covered.
+func (b *subnetBroadcastSt) Write(payload []byte) (err error) {
+
+	addrs := b.addrs
+	if len(addrs) == 0 {
+		addrs, err = subnetBroadcastAddrs(b.port)
+		if err != nil {
+			return
+		}
+	}
+	if len(addrs) == 0 {
+		err = ErrNoBroadcastAddr
+		return
+	}
+
+	err = writeUDP(b.conn, payload, addrs)
+	return
+}
+
+// Close ...
+func (b *subnetBroadcastSt) Close() error {
+	return b.conn.Close()
+}
+
+// subnetBroadcastAddrs ...
+func subnetBroadcastAddrs(port int) (addrs []*net.UDPAddr, err error) {
+
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		ifiAddrs, ifiErr := ifi.Addrs()
+		if ifiErr != nil {
+			continue
+		}
+		for _, ifiAddr := range ifiAddrs {
+			ipNet, ok := ifiAddr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP.To4()
+			if ip == nil || len(ipNet.Mask) != net.IPv4len {
+				continue
+			}
+			bcast := make(net.IP, net.IPv4len)
+			for i := range ip {
+				bcast[i] = ip[i] | ^ipNet.Mask[i]
+			}
+			addrs = append(addrs, &net.UDPAddr{IP: bcast, Port: port})
+		}
+	}
+	return
+}
+
+type newSubnetBroadcastConfig struct {
+	port       int
+	addrs      []*net.UDPAddr
+	bufferSize int
+}
+
+// defaultSubnetBroadcastConfig ...
+func defaultSubnetBroadcastConfig() *newSubnetBroadcastConfig {
+	cfg := new(newSubnetBroadcastConfig)
+	cfg.port = 9101
+	cfg.bufferSize = 64 * 1024
+	return cfg
+}
+
+type NewSubnetBroadcastWithFn func(cfg *newSubnetBroadcastConfig)
+
+// NewSubnetBroadcastWithPort ...
+func NewSubnetBroadcastWithPort(port int) NewSubnetBroadcastWithFn {
+	return func(cfg *newSubnetBroadcastConfig) {
+		cfg.port = port
+	}
+}
+
+// NewSubnetBroadcastWithAddrs replaces the broadcast addresses of the
+// interfaces with fixed ones.
+func NewSubnetBroadcastWithAddrs(addrs ...*net.UDPAddr) NewSubnetBroadcastWithFn {
+	return func(cfg *newSubnetBroadcastConfig) {
+		cfg.addrs = addrs
+	}
+}
+
+// NewSubnetBroadcast sends to the IPv4 broadcast address of each subnet, for
+// networks which drop multicast.
+func NewSubnetBroadcast(withFns ...NewSubnetBroadcastWithFn) (Net, error) {
+
+	cfg := defaultSubnetBroadcastConfig()
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: cfg.port})
+	if err != nil {
+		return nil, err
+	}
+
+	n := new(subnetBroadcastSt)
+	n.conn = conn
+	n.port = cfg.port
+	n.addrs = cfg.addrs
+	n.bufferSize = cfg.bufferSize
+	return n, nil
+}
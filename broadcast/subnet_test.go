@@ -0,0 +1,39 @@
+package broadcast_test
+
+import (
+	"net"
+	"pan/broadcast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSubnetBroadcast ...
+func TestSubnetBroadcast(t *testing.T) {
+
+	t.Run("write and read success", func(t *testing.T) {
+
+		buf := []byte("content buffer")
+
+		serve, err := broadcast.NewSubnetBroadcast(
+			broadcast.NewSubnetBroadcastWithPort(9111),
+			broadcast.NewSubnetBroadcastWithAddrs(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9111}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		err = serve.Write(buf)
+		assert.Nil(t, err, "Error should be nil")
+
+		msg, addr, err := serve.Read(-1)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, buf, msg, "Buffer should be same")
+
+		ip, _, err := net.SplitHostPort(string(addr))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "127.0.0.1", ip, "IP should be local")
+	})
+
+}
@@ -0,0 +1,101 @@
+package broadcast
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var ErrNoSeed = errors.New("No Seed")
+
+// Unicast is a Net which sends to a static seed list.
+type Unicast interface {
+	Net
+	Seeds() []*net.UDPAddr
+	SetSeeds(seeds ...*net.UDPAddr)
+}
+
+type unicastSt struct {
+	conn       *net.UDPConn
+	seeds      []*net.UDPAddr
+	bufferSize int
+	rw         *sync.RWMutex
+}
+
+// Read ...
+func (u *unicastSt) Read(size int) (payload []byte, srcAddr []byte, err error) {
+	return readUDP(u.conn, size, u.bufferSize)
+}
+
+// Write ...
+func (u *unicastSt) Write(payload []byte) (err error) {
+	seeds := u.Seeds()
+	if len(seeds) == 0 {
+		err = ErrNoSeed
+		return
+	}
+	err = writeUDP(u.conn, payload, seeds)
+	return
+}
+
+// Close ...
+func (u *unicastSt) Close() error {
+	return u.conn.Close()
+}
+
+// Seeds ...
+func (u *unicastSt) Seeds() []*net.UDPAddr {
+	u.rw.RLock()
+	defer u.rw.RUnlock()
+	return u.seeds
+}
+
+// SetSeeds ...
+func (u *unicastSt) SetSeeds(seeds ...*net.UDPAddr) {
+	u.rw.Lock()
+	u.seeds = seeds
+	u.rw.Unlock()
+}
+
+type newUnicastConfig struct {
+	addr       *net.UDPAddr
+	bufferSize int
+}
+
+// defaultUnicastConfig ...
+func defaultUnicastConfig() *newUnicastConfig {
+	cfg := new(newUnicastConfig)
+	cfg.addr = &net.UDPAddr{Port: 9102}
+	cfg.bufferSize = 64 * 1024
+	return cfg
+}
+
+type NewUnicastWithFn func(cfg *newUnicastConfig)
+
+// NewUnicastWithAddr sets the local addr to listen.
+func NewUnicastWithAddr(addr *net.UDPAddr) NewUnicastWithFn {
+	return func(cfg *newUnicastConfig) {
+		cfg.addr = addr
+	}
+}
+
+// NewUnicast ...
+func NewUnicast(seeds []*net.UDPAddr, withFns ...NewUnicastWithFn) (Unicast, error) {
+
+	cfg := defaultUnicastConfig()
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+
+	conn, err := net.ListenUDP("udp", cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	n := new(unicastSt)
+	n.conn = conn
+	n.seeds = seeds
+	n.bufferSize = cfg.bufferSize
+	n.rw = new(sync.RWMutex)
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package broadcast_test
+
+import (
+	"net"
+	"pan/broadcast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUnicast ...
+func TestUnicast(t *testing.T) {
+
+	t.Run("write to seeds and read", func(t *testing.T) {
+
+		buf := []byte("content buffer")
+		serveAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9112}
+
+		serve, err := broadcast.NewUnicast(nil, broadcast.NewUnicastWithAddr(serveAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		dialer, err := broadcast.NewUnicast([]*net.UDPAddr{serveAddr}, broadcast.NewUnicastWithAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9113}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		err = dialer.Write(buf)
+		assert.Nil(t, err, "Error should be nil")
+
+		msg, addr, err := serve.Read(-1)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, buf, msg, "Buffer should be same")
+		assert.Equal(t, []byte("127.0.0.1:9113"), addr, "Addr should be dialer")
+	})
+
+	t.Run("write without seeds", func(t *testing.T) {
+
+		serve, err := broadcast.NewUnicast(nil, broadcast.NewUnicastWithAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9114}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		err = serve.Write([]byte("content buffer"))
+		assert.ErrorIs(t, err, broadcast.ErrNoSeed, "Error should be no seed")
+
+		serve.SetSeeds(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9114})
+		err = serve.Write([]byte("content buffer"))
+		assert.Nil(t, err, "Error should be nil")
+	})
+
+	t.Run("read after close", func(t *testing.T) {
+
+		serve, err := broadcast.NewUnicast(nil, broadcast.NewUnicastWithAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9115}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve.Close()
+
+		_, _, err = serve.Read(-1)
+		assert.ErrorIs(t, err, net.ErrClosed, "Error should be closed")
+	})
+
+}
@@ -0,0 +1,356 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KeystoreKeyFile  = "key.pem"
+	KeystoreCertFile = "cert.pem"
+	KeystoreCAFile   = "ca.pem"
+)
+
+const (
+	ScryptKeystoreKdf   = "scrypt"
+	Argon2idKeystoreKdf = "argon2id"
+)
+
+const (
+	keystoreDirMode  = os.FileMode(0700)
+	keystoreKeyMode  = os.FileMode(0600)
+	keystoreCertMode = os.FileMode(0644)
+)
+
+const (
+	encryptedKeyPemType = "ENCRYPTED PRIVATE KEY"
+	keystoreSaltSize    = 16
+	keystoreKeySize     = 32
+)
+
+var (
+	ErrMissingPassphrase = errors.New("Missing Passphrase")
+	ErrInvalidPassphrase = errors.New("Invalid Passphrase")
+)
+
+// Keystore keeps the identity of the node, the same key is loaded on every
+// run so that the PeerId does not change.
+type Keystore interface {
+	PrivateKey() []byte
+	Certificate() []byte
+	TLSConfig(nextProtos ...string) (*tls.Config, error)
+}
+
+type keystoreConfig struct {
+	passphrase  []byte
+	kdf         string
+	caCert      []byte
+	generateFns []GenerateKeyAndCertWithFn
+}
+
+type OpenKeystoreWithFn func(cfg *keystoreConfig)
+
+// OpenKeystoreWithPassphrase encrypts the private key on disk.
+func OpenKeystoreWithPassphrase(passphrase []byte) OpenKeystoreWithFn {
+	return func(cfg *keystoreConfig) {
+		cfg.passphrase = passphrase
+	}
+}
+
+// OpenKeystoreWithKdf selects how the passphrase is derived for a new key,
+// scrypt or argon2id, the default is scrypt. A stored key keeps its own.
+func OpenKeystoreWithKdf(kdf string) OpenKeystoreWithFn {
+	return func(cfg *keystoreConfig) {
+		cfg.kdf = kdf
+	}
+}
+
+// OpenKeystoreWithCA trusts the pem certificate of a local CA instead of
+// the ca file in the directory.
+func OpenKeystoreWithCA(caCert []byte) OpenKeystoreWithFn {
+	return func(cfg *keystoreConfig) {
+		cfg.caCert = caCert
+	}
+}
+
+// OpenKeystoreWithGenerate sets the options of the key and certificate
+// generated on first run.
+func OpenKeystoreWithGenerate(generateFns ...GenerateKeyAndCertWithFn) OpenKeystoreWithFn {
+	return func(cfg *keystoreConfig) {
+		cfg.generateFns = append(cfg.generateFns, generateFns...)
+	}
+}
+
+type keystoreSt struct {
+	key    []byte
+	cert   []byte
+	caCert []byte
+}
+
+// PrivateKey ...
+func (ks *keystoreSt) PrivateKey() []byte {
+	return ks.key
+}
+
+// Certificate ...
+func (ks *keystoreSt) Certificate() []byte {
+	return ks.cert
+}
+
+// TLSConfig serves and dials with the same config. Any client certificate is
+// required, when a CA is trusted the certificate must be issued by it.
+func (ks *keystoreSt) TLSConfig(nextProtos ...string) (tlsConf *tls.Config, err error) {
+
+	certificate, err := tls.X509KeyPair(ks.cert, ks.key)
+	if err != nil {
+		return
+	}
+
+	tlsConf = &tls.Config{
+		Certificates:       []tls.Certificate{certificate},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+		NextProtos:         nextProtos,
+	}
+
+	if ks.caCert != nil {
+		caCert := ks.caCert
+		tlsConf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) (err error) {
+			if len(rawCerts) == 0 {
+				err = errors.New("Missing Certificate")
+				return
+			}
+			x509Cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return
+			}
+			err = VerifyCertWithCA(x509Cert, caCert)
+			return
+		}
+	}
+	return
+}
+
+// OpenKeystore loads the key and certificate from dir, they are generated
+// and stored on first run. An existing dir is restricted to the owner and a
+// plain key is encrypted in place when a passphrase is given.
+func OpenKeystore(dir string, withFns ...OpenKeystoreWithFn) (ks Keystore, err error) {
+
+	cfg := new(keystoreConfig)
+	cfg.kdf = ScryptKeystoreKdf
+	for _, fn := range withFns {
+		fn(cfg)
+	}
+
+	err = os.MkdirAll(dir, keystoreDirMode)
+	if err != nil {
+		return
+	}
+	err = os.Chmod(dir, keystoreDirMode)
+	if err != nil {
+		return
+	}
+
+	keyPath := filepath.Join(dir, KeystoreKeyFile)
+	certPath := filepath.Join(dir, KeystoreCertFile)
+
+	store := new(keystoreSt)
+	encrypted := true
+	keyData, err := os.ReadFile(keyPath)
+	if err == nil {
+		store.key, encrypted, err = decryptKeystoreKey(keyData, cfg.passphrase)
+		if err != nil {
+			return
+		}
+		store.cert, err = os.ReadFile(certPath)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = store.generate(cfg, keyPath, certPath)
+	}
+	if err != nil {
+		return
+	}
+
+	_, err = tls.X509KeyPair(store.cert, store.key)
+	if err != nil {
+		return
+	}
+
+	if cfg.passphrase != nil && !encrypted {
+		keyData, err = encryptKeystoreKey(store.key, cfg.passphrase, cfg.kdf)
+		if err != nil {
+			return
+		}
+		err = writeKeystoreFile(keyPath, keyData, keystoreKeyMode)
+		if err != nil {
+			return
+		}
+	}
+
+	store.caCert = cfg.caCert
+	if store.caCert == nil {
+		store.caCert, err = os.ReadFile(filepath.Join(dir, KeystoreCAFile))
+		if errors.Is(err, os.ErrNotExist) {
+			store.caCert = nil
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	ks = store
+	return
+}
+
+// generate ...
+func (ks *keystoreSt) generate(cfg *keystoreConfig, keyPath, certPath string) (err error) {
+
+	ks.key, ks.cert, err = GenerateKeyAndCert(cfg.generateFns...)
+	if err != nil {
+		return
+	}
+
+	keyData := ks.key
+	if cfg.passphrase != nil {
+		keyData, err = encryptKeystoreKey(ks.key, cfg.passphrase, cfg.kdf)
+		if err != nil {
+			return
+		}
+	}
+
+	err = writeKeystoreFile(certPath, ks.cert, keystoreCertMode)
+	if err != nil {
+		return
+	}
+	err = writeKeystoreFile(keyPath, keyData, keystoreKeyMode)
+	return
+}
+
+// writeKeystoreFile writes the file with the mode, the mode of an existing
+// file is changed too.
+func writeKeystoreFile(path string, data []byte, mode os.FileMode) (err error) {
+	err = os.WriteFile(path, data, mode)
+	if err != nil {
+		return
+	}
+	err = os.Chmod(path, mode)
+	return
+}
+
+// deriveKeystoreKey ...
+func deriveKeystoreKey(passphrase, salt []byte, kdf string) (key []byte, err error) {
+	switch kdf {
+	case ScryptKeystoreKdf:
+		key, err = scrypt.Key(passphrase, salt, 1<<15, 8, 1, keystoreKeySize)
+	case Argon2idKeystoreKdf:
+		key = argon2.IDKey(passphrase, salt, 1, 64*1024, 4, keystoreKeySize)
+	default:
+		err = errors.New("Unsupported Kdf")
+	}
+	return
+}
+
+// encryptKeystoreKey seals the pem key with AES-GCM, the kdf, salt and
+// nonce are kept in the headers of the encrypted pem.
+func encryptKeystoreKey(key, passphrase []byte, kdf string) (data []byte, err error) {
+
+	salt := make([]byte, keystoreSaltSize)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return
+	}
+
+	aead, err := newKeystoreAEAD(passphrase, salt, kdf)
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return
+	}
+
+	block := new(pem.Block)
+	block.Type = encryptedKeyPemType
+	block.Headers = map[string]string{
+		"Kdf":   kdf,
+		"Salt":  hex.EncodeToString(salt),
+		"Nonce": hex.EncodeToString(nonce),
+	}
+	block.Bytes = aead.Seal(nil, nonce, key, nil)
+	data = pem.EncodeToMemory(block)
+	return
+}
+
+// decryptKeystoreKey returns a plain pem key as it is.
+func decryptKeystoreKey(data, passphrase []byte) (key []byte, encrypted bool, err error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		err = errors.New("Invalid Pem")
+		return
+	}
+	if block.Type != encryptedKeyPemType {
+		key = data
+		return
+	}
+	encrypted = true
+	if passphrase == nil {
+		err = ErrMissingPassphrase
+		return
+	}
+
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return
+	}
+	nonce, err := hex.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return
+	}
+
+	aead, err := newKeystoreAEAD(passphrase, salt, block.Headers["Kdf"])
+	if err != nil {
+		return
+	}
+	if len(nonce) != aead.NonceSize() {
+		err = errors.New("Invalid Nonce")
+		return
+	}
+
+	key, err = aead.Open(nil, nonce, block.Bytes, nil)
+	if err != nil {
+		err = ErrInvalidPassphrase
+	}
+	return
+}
+
+// newKeystoreAEAD ...
+func newKeystoreAEAD(passphrase, salt []byte, kdf string) (aead cipher.AEAD, err error) {
+
+	key, err := deriveKeystoreKey(passphrase, salt, kdf)
+	if err != nil {
+		return
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	aead, err = cipher.NewGCM(block)
+	return
+}
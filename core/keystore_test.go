@@ -0,0 +1,165 @@
+package core_test
+
+import (
+	"crypto/tls"
+	"os"
+	"pan/core"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKeystore ...
+func TestKeystore(t *testing.T) {
+
+	t.Run("OpenKeystore", func(t *testing.T) {
+
+		dir := filepath.Join(t.TempDir(), "keystore")
+		ks, err := core.OpenKeystore(dir, core.OpenKeystoreWithGenerate(core.GenerateKeyAndCertWithCommonName("node")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dirInfo, _ := os.Stat(dir)
+		keyInfo, _ := os.Stat(filepath.Join(dir, core.KeystoreKeyFile))
+		certInfo, _ := os.Stat(filepath.Join(dir, core.KeystoreCertFile))
+		assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm(), "Dir mode should be 0700")
+		assert.Equal(t, os.FileMode(0600), keyInfo.Mode().Perm(), "Key mode should be 0600")
+		assert.Equal(t, os.FileMode(0644), certInfo.Mode().Perm(), "Cert mode should be 0644")
+
+		cert, _ := core.ParseCertWithPem(ks.Certificate())
+		assert.Equal(t, "node", cert.Subject.CommonName, "CommonName should be same")
+
+		reopened, err := core.OpenKeystore(dir)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, ks.PrivateKey(), reopened.PrivateKey(), "PrivateKey should be same")
+		assert.Equal(t, ks.Certificate(), reopened.Certificate(), "Certificate should be same")
+	})
+
+	t.Run("OpenKeystore with passphrase", func(t *testing.T) {
+
+		for _, kdf := range []string{core.ScryptKeystoreKdf, core.Argon2idKeystoreKdf} {
+			dir := t.TempDir()
+			passphrase := []byte("secret")
+			ks, err := core.OpenKeystore(dir, core.OpenKeystoreWithPassphrase(passphrase), core.OpenKeystoreWithKdf(kdf))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keyData, _ := os.ReadFile(filepath.Join(dir, core.KeystoreKeyFile))
+			assert.NotEqual(t, ks.PrivateKey(), keyData, "Stored key should be encrypted: %s", kdf)
+
+			reopened, err := core.OpenKeystore(dir, core.OpenKeystoreWithPassphrase(passphrase))
+			assert.Nil(t, err, "Error should be nil: %s", kdf)
+			assert.Equal(t, ks.PrivateKey(), reopened.PrivateKey(), "PrivateKey should be same: %s", kdf)
+
+			_, err = core.OpenKeystore(dir, core.OpenKeystoreWithPassphrase([]byte("wrong")))
+			assert.ErrorIs(t, err, core.ErrInvalidPassphrase, "Error should be invalid passphrase: %s", kdf)
+
+			_, err = core.OpenKeystore(dir)
+			assert.ErrorIs(t, err, core.ErrMissingPassphrase, "Error should be missing passphrase: %s", kdf)
+		}
+	})
+
+	t.Run("OpenKeystore with existing dir", func(t *testing.T) {
+
+		dir := t.TempDir()
+		err := os.Chmod(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = core.OpenKeystore(dir)
+		assert.Nil(t, err, "Error should be nil")
+
+		dirInfo, _ := os.Stat(dir)
+		assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm(), "Dir mode should be 0700")
+	})
+
+	t.Run("OpenKeystore with passphrase and plain key", func(t *testing.T) {
+
+		dir := t.TempDir()
+		ks, err := core.OpenKeystore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPath := filepath.Join(dir, core.KeystoreKeyFile)
+		err = os.Chmod(keyPath, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		passphrase := []byte("secret")
+		reopened, err := core.OpenKeystore(dir, core.OpenKeystoreWithPassphrase(passphrase))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, ks.PrivateKey(), reopened.PrivateKey(), "PrivateKey should be same")
+
+		keyData, _ := os.ReadFile(keyPath)
+		assert.NotEqual(t, ks.PrivateKey(), keyData, "Stored key should be encrypted")
+		keyInfo, _ := os.Stat(keyPath)
+		assert.Equal(t, os.FileMode(0600), keyInfo.Mode().Perm(), "Key mode should be 0600")
+
+		_, err = core.OpenKeystore(dir)
+		assert.ErrorIs(t, err, core.ErrMissingPassphrase, "Error should be missing passphrase")
+
+		reopened, err = core.OpenKeystore(dir, core.OpenKeystoreWithPassphrase(passphrase))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, ks.PrivateKey(), reopened.PrivateKey(), "PrivateKey should be same")
+	})
+
+	t.Run("OpenKeystore with unsupported kdf", func(t *testing.T) {
+
+		_, err := core.OpenKeystore(t.TempDir(), core.OpenKeystoreWithPassphrase([]byte("secret")), core.OpenKeystoreWithKdf("md5"))
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	t.Run("TLSConfig", func(t *testing.T) {
+
+		ks, err := core.OpenKeystore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tlsConf, err := ks.TLSConfig("pan")
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, tlsConf.Certificates, 1, "Certificates should have the key pair")
+		assert.Equal(t, []string{"pan"}, tlsConf.NextProtos, "NextProtos should be same")
+		assert.Equal(t, tls.RequireAnyClientCert, tlsConf.ClientAuth, "ClientAuth should require any client cert")
+		assert.Nil(t, tlsConf.VerifyPeerCertificate, "VerifyPeerCertificate should be nil without CA")
+	})
+
+	t.Run("TLSConfig with CA", func(t *testing.T) {
+
+		caKey, caCert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithCA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		err = os.WriteFile(filepath.Join(dir, core.KeystoreCAFile), caCert, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ks, err := core.OpenKeystore(dir, core.OpenKeystoreWithGenerate(core.GenerateKeyAndCertWithParent(caCert, caKey)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := core.OpenKeystore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tlsConf, err := ks.TLSConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		issued, _ := core.ParseCertWithPem(ks.Certificate())
+		selfSigned, _ := core.ParseCertWithPem(other.Certificate())
+
+		assert.Nil(t, tlsConf.VerifyPeerCertificate([][]byte{issued.Raw}, nil), "Issued certificate should be verified")
+		assert.NotNil(t, tlsConf.VerifyPeerCertificate([][]byte{selfSigned.Raw}, nil), "Self signed certificate should not be verified")
+	})
+
+}
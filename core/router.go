@@ -0,0 +1,234 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	routeParamPrefix = ":"
+	routeWildcard    = "*"
+	routeSeparator   = "/"
+)
+
+type Params map[string]string
+
+// ParamsSetter is implemented by contexts able to carry route params.
+type ParamsSetter interface {
+	SetParams(params Params)
+}
+
+type Router[T Context] interface {
+	Handler[T]
+	Route(path string, handles ...Handle[T])
+	Group(prefix string, handles ...Handle[T]) Router[T]
+}
+
+type routeNode[T Context] struct {
+	children  map[string]*routeNode[T]
+	param     *routeNode[T]
+	paramName string
+	wildcard  []Handler[T]
+	handlers  []Handler[T]
+}
+
+// insert ...
+func (n *routeNode[T]) insert(segments []string, handlers []Handler[T]) {
+	if len(segments) <= 0 {
+		n.handlers = append(n.handlers, handlers...)
+		return
+	}
+
+	segment := segments[0]
+	if segment == routeWildcard {
+		if len(segments) > 1 {
+			panic(fmt.Errorf("Wildcard should be last route segment: %s", strings.Join(segments, routeSeparator)))
+		}
+		n.wildcard = append(n.wildcard, handlers...)
+		return
+	}
+
+	if strings.HasPrefix(segment, routeParamPrefix) {
+		name := segment[len(routeParamPrefix):]
+		if n.param == nil {
+			n.param = newRouteNode[T]()
+			n.paramName = name
+		} else if n.paramName != name {
+			panic(fmt.Errorf("Conflict route param: %s and %s", n.paramName, name))
+		}
+		n.param.insert(segments[1:], handlers)
+		return
+	}
+
+	child, ok := n.children[segment]
+	if ok == false {
+		child = newRouteNode[T]()
+		n.children[segment] = child
+	}
+	child.insert(segments[1:], handlers)
+}
+
+// match ...
+func (n *routeNode[T]) match(segments []string, params Params) (handlers []Handler[T], ok bool) {
+	if len(segments) <= 0 {
+		if n.handlers != nil {
+			handlers = n.handlers
+			ok = true
+		}
+		return
+	}
+
+	segment := segments[0]
+	child, existed := n.children[segment]
+	if existed {
+		handlers, ok = child.match(segments[1:], params)
+		if ok {
+			return
+		}
+	}
+
+	if n.param != nil {
+		params[n.paramName] = segment
+		handlers, ok = n.param.match(segments[1:], params)
+		if ok {
+			return
+		}
+		delete(params, n.paramName)
+	}
+
+	if n.wildcard != nil {
+		params[routeWildcard] = strings.Join(segments, routeSeparator)
+		handlers = n.wildcard
+		ok = true
+	}
+	return
+}
+
+// newRouteNode ...
+func newRouteNode[T Context]() *routeNode[T] {
+	node := new(routeNode[T])
+	node.children = make(map[string]*routeNode[T])
+	return node
+}
+
+type routerTree[T Context] struct {
+	root *routeNode[T]
+	rw   *sync.RWMutex
+}
+
+type routerStruct[T Context] struct {
+	tree     *routerTree[T]
+	prefix   []string
+	handlers []Handler[T]
+}
+
+// Handle ...
+func (r *routerStruct[T]) Handle(ctx T, next Next) error {
+
+	segments := splitRoutePath(string(ctx.Method()))
+	params := make(Params)
+
+	r.tree.rw.RLock()
+	handlers, ok := r.tree.root.match(segments, params)
+	r.tree.rw.RUnlock()
+
+	if ok == false {
+		return next()
+	}
+
+	if len(params) > 0 {
+		setter, ok := any(ctx).(ParamsSetter)
+		if ok {
+			setter.SetParams(params)
+		}
+	}
+
+	return dispatch(ctx, handlers, 0, next)
+}
+
+// Route ...
+func (r *routerStruct[T]) Route(path string, handles ...Handle[T]) {
+
+	segments := make([]string, 0, len(r.prefix))
+	segments = append(segments, r.prefix...)
+	segments = append(segments, splitRoutePath(path)...)
+
+	handlers := make([]Handler[T], 0, len(r.handlers)+len(handles))
+	handlers = append(handlers, r.handlers...)
+	handlers = append(handlers, wrapHandles(handles)...)
+
+	r.tree.rw.Lock()
+	defer r.tree.rw.Unlock()
+	r.tree.root.insert(segments, handlers)
+}
+
+// Group ...
+func (r *routerStruct[T]) Group(prefix string, handles ...Handle[T]) Router[T] {
+
+	group := new(routerStruct[T])
+	group.tree = r.tree
+
+	group.prefix = make([]string, 0, len(r.prefix))
+	group.prefix = append(group.prefix, r.prefix...)
+	group.prefix = append(group.prefix, splitRoutePath(prefix)...)
+
+	group.handlers = make([]Handler[T], 0, len(r.handlers)+len(handles))
+	group.handlers = append(group.handlers, r.handlers...)
+	group.handlers = append(group.handlers, wrapHandles(handles)...)
+
+	return group
+}
+
+// NewRouter ...
+func NewRouter[T Context]() Router[T] {
+	tree := new(routerTree[T])
+	tree.root = newRouteNode[T]()
+	tree.rw = new(sync.RWMutex)
+
+	router := new(routerStruct[T])
+	router.tree = tree
+	router.prefix = make([]string, 0)
+	router.handlers = make([]Handler[T], 0)
+	return router
+}
+
+// MatchRoute reports whether path matches the pattern, the pattern has the
+// params and wildcard of Route.
+func MatchRoute(pattern, path string) bool {
+
+	patternSegments := splitRoutePath(pattern)
+	segments := splitRoutePath(path)
+	for i, segment := range patternSegments {
+		if segment == routeWildcard {
+			return i < len(segments)
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(segment, routeParamPrefix) == false && segment != segments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(segments)
+}
+
+// wrapHandles ...
+func wrapHandles[T Context](handles []Handle[T]) []Handler[T] {
+	handlers := make([]Handler[T], 0, len(handles))
+	for _, handle := range handles {
+		handler := new(handlerStruct[T])
+		handler.handle = handle
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// splitRoutePath ...
+func splitRoutePath(path string) []string {
+	path = strings.Trim(path, routeSeparator)
+	if len(path) <= 0 {
+		return []string{}
+	}
+	return strings.Split(path, routeSeparator)
+}
@@ -0,0 +1,169 @@
+package core_test
+
+import (
+	"pan/core"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestRouteContext struct {
+	method []byte
+	params core.Params
+	trace  []string
+}
+
+// Method ...
+func (c *TestRouteContext) Method() []byte {
+	return c.method
+}
+
+// SetParams ...
+func (c *TestRouteContext) SetParams(params core.Params) {
+	c.params = params
+}
+
+// traceHandle ...
+func traceHandle(name string) core.Handle[*TestRouteContext] {
+	return func(ctx *TestRouteContext, next core.Next) error {
+		ctx.trace = append(ctx.trace, name)
+		return next()
+	}
+}
+
+// TestRouter ...
+func TestRouter(t *testing.T) {
+
+	t.Run("Route exact", func(t *testing.T) {
+
+		router := core.NewRouter[*TestRouteContext]()
+		router.Route("file/list", traceHandle("list"))
+		router.Route("file/info", traceHandle("info"))
+
+		ctx := &TestRouteContext{method: []byte("file/list")}
+		nextCalled := false
+		err := router.Handle(ctx, func() error {
+			nextCalled = true
+			return nil
+		})
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, nextCalled, "Next should be called")
+		assert.Equal(t, []string{"list"}, ctx.trace, "Only list handle should be called")
+		assert.Nil(t, ctx.params, "Params should not be set")
+
+	})
+
+	t.Run("Route params", func(t *testing.T) {
+
+		router := core.NewRouter[*TestRouteContext]()
+		router.Route("sync/:id/chunk", traceHandle("chunk"))
+
+		ctx := &TestRouteContext{method: []byte("sync/abc/chunk")}
+		err := router.Handle(ctx, func() error { return nil })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []string{"chunk"}, ctx.trace, "Chunk handle should be called")
+		assert.Equal(t, "abc", ctx.params["id"], "Param id should be extracted")
+
+	})
+
+	t.Run("Route wildcard", func(t *testing.T) {
+
+		router := core.NewRouter[*TestRouteContext]()
+		router.Route("file/*", traceHandle("wildcard"))
+
+		ctx := &TestRouteContext{method: []byte("file/a/b")}
+		err := router.Handle(ctx, func() error { return nil })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []string{"wildcard"}, ctx.trace, "Wildcard handle should be called")
+		assert.Equal(t, "a/b", ctx.params["*"], "Wildcard param should be rest of path")
+
+	})
+
+	t.Run("Route precedence", func(t *testing.T) {
+
+		router := core.NewRouter[*TestRouteContext]()
+		router.Route("file/*", traceHandle("wildcard"))
+		router.Route("file/:name", traceHandle("param"))
+		router.Route("file/list", traceHandle("exact"))
+
+		for method, name := range map[string]string{"file/list": "exact", "file/other": "param", "file/other/deep": "wildcard"} {
+			ctx := &TestRouteContext{method: []byte(method)}
+			err := router.Handle(ctx, func() error { return nil })
+			assert.Nil(t, err, "Error should be nil")
+			assert.Equal(t, []string{name}, ctx.trace, "Matched handle should be called")
+		}
+
+	})
+
+	t.Run("Route not found", func(t *testing.T) {
+
+		router := core.NewRouter[*TestRouteContext]()
+		router.Route("file/list", traceHandle("list"))
+
+		ctx := &TestRouteContext{method: []byte("file/info")}
+		nextCalled := false
+		err := router.Handle(ctx, func() error {
+			nextCalled = true
+			return nil
+		})
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, nextCalled, "Next should be called")
+		assert.Nil(t, ctx.trace, "No handle should be called")
+
+	})
+
+	t.Run("Group", func(t *testing.T) {
+
+		router := core.NewRouter[*TestRouteContext]()
+		group := router.Group("file", traceHandle("group"))
+		subGroup := group.Group(":name", traceHandle("subGroup"))
+		subGroup.Route("chunk", traceHandle("chunk"))
+		group.Route("list", traceHandle("list"))
+
+		ctx := &TestRouteContext{method: []byte("file/abc/chunk")}
+		err := router.Handle(ctx, func() error { return nil })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []string{"group", "subGroup", "chunk"}, ctx.trace, "Group handles should be called in order")
+		assert.Equal(t, "abc", ctx.params["name"], "Param name should be extracted")
+
+		ctx = &TestRouteContext{method: []byte("file/list")}
+		err = router.Handle(ctx, func() error { return nil })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []string{"group", "list"}, ctx.trace, "Sub group handles should not be called")
+
+	})
+
+	t.Run("Use with App", func(t *testing.T) {
+
+		app := core.New[*TestRouteContext]()
+		router := core.NewRouter[*TestRouteContext]()
+		router.Route("file/list", traceHandle("list"))
+		app.Use(router)
+		app.UseFn(nil, traceHandle("after"))
+
+		ctx := &TestRouteContext{method: []byte("file/list")}
+		err := app.Run(ctx)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []string{"list", "after"}, ctx.trace, "Router should call next handler")
+
+	})
+
+	t.Run("MatchRoute", func(t *testing.T) {
+
+		assert.True(t, core.MatchRoute("file/list", "file/list"), "Exact should match")
+		assert.False(t, core.MatchRoute("file/list", "file/list/all"), "Longer path should not match")
+		assert.True(t, core.MatchRoute("file/:id/read", "file/3/read"), "Param should match")
+		assert.False(t, core.MatchRoute("file/:id/read", "file/3"), "Shorter path should not match")
+		assert.True(t, core.MatchRoute("file/*", "file/3/read"), "Wildcard should match rest")
+		assert.False(t, core.MatchRoute("file/*", "file"), "Wildcard should not match empty rest")
+		assert.True(t, core.MatchRoute("*", "Endorse"), "Wildcard should match all")
+	})
+
+}
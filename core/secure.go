@@ -3,6 +3,7 @@ package core
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -10,11 +11,11 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"os"
 	"time"
 )
@@ -22,6 +23,10 @@ import (
 // ParseCertWithPem ...
 func ParseCertWithPem(cert []byte) (x509Cert *x509.Certificate, err error) {
 	block, _ := pem.Decode(cert)
+	if block == nil {
+		err = errors.New("Invalid Pem")
+		return
+	}
 	x509Cert, err = x509.ParseCertificate(block.Bytes)
 	return
 }
@@ -32,20 +37,45 @@ func ExtractPublicKeyFromCert(x509Cert *x509.Certificate) (pubKey []byte, err er
 	return
 }
 
+type signConfig struct {
+	pss bool
+}
+
+type SignWithFn func(cfg *signConfig)
+
+// SignWithPSS makes RSA keys use RSA-PSS instead of PKCS#1 v1.5,
+// the other key types ignore it. Both sides must agree on it.
+func SignWithPSS() SignWithFn {
+	return func(cfg *signConfig) {
+		cfg.pss = true
+	}
+}
+
+// newSignConfig ...
+func newSignConfig(withFns []SignWithFn) *signConfig {
+	cfg := new(signConfig)
+	for _, fn := range withFns {
+		fn(cfg)
+	}
+	return cfg
+}
+
 // VerifyWithPublicKey ...
-func VerifyWithPublicKey(key, data, sig []byte, hash crypto.Hash) (err error) {
+func VerifyWithPublicKey(key, data, sig []byte, hash crypto.Hash, withFns ...SignWithFn) (err error) {
 
 	pubKey, err := x509.ParsePKIXPublicKey(key)
 	if err != nil {
 		return
 	}
 
+	cfg := newSignConfig(withFns)
 	switch pubKey.(type) {
 	case *rsa.PublicKey:
-		err = verifyWithRSA(pubKey.(*rsa.PublicKey), hash, data, sig)
+		err = verifyWithRSA(pubKey.(*rsa.PublicKey), hash, data, sig, cfg.pss)
 	case *ecdsa.PublicKey:
 		err = verifyWithECDSA(pubKey.(*ecdsa.PublicKey), data, sig)
-
+	case ed25519.PublicKey:
+		err = verifyWithEd25519(pubKey.(ed25519.PublicKey), data, sig)
 	default:
 		err = errors.New("Unsupported Verify Algorithm")
 	}
@@ -54,13 +84,18 @@ func VerifyWithPublicKey(key, data, sig []byte, hash crypto.Hash) (err error) {
 }
 
 // verifyWithRSA ...
-func verifyWithRSA(publicKey *rsa.PublicKey, hash crypto.Hash, data, sig []byte) (err error) {
+func verifyWithRSA(publicKey *rsa.PublicKey, hash crypto.Hash, data, sig []byte, pss bool) (err error) {
 
 	hashed, err := hashWithRSA(hash, data)
 	if err != nil {
 		return
 	}
 
+	if pss {
+		err = rsa.VerifyPSS(publicKey, hash, hashed, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		return
+	}
+
 	err = rsa.VerifyPKCS1v15(publicKey, hash, hashed, sig)
 	return
 }
@@ -81,20 +116,37 @@ func verifyWithECDSA(publicKey *ecdsa.PublicKey, data, sig []byte) (err error) {
 	return
 }
 
+// verifyWithEd25519 signs the data itself, so the hash is not used.
+func verifyWithEd25519(publicKey ed25519.PublicKey, data, sig []byte) (err error) {
+
+	valid := ed25519.Verify(publicKey, data, sig)
+	if valid == false {
+		err = errors.New("Verify Failed")
+	}
+	return
+}
+
 // SignWithPrivateKey ...
-func SignWithPrivateKey(key, data []byte, hash crypto.Hash) (sig []byte, err error) {
+func SignWithPrivateKey(key, data []byte, hash crypto.Hash, withFns ...SignWithFn) (sig []byte, err error) {
 
 	block, _ := pem.Decode(key)
+	if block == nil {
+		err = errors.New("Invalid Pem")
+		return
+	}
 	x509Key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		return
 	}
 
+	cfg := newSignConfig(withFns)
 	switch x509Key.(type) {
 	case *rsa.PrivateKey:
-		sig, err = signWithRSA(x509Key.(*rsa.PrivateKey), hash, data)
+		sig, err = signWithRSA(x509Key.(*rsa.PrivateKey), hash, data, cfg.pss)
 	case *ecdsa.PrivateKey:
 		sig, err = signWithECDSA(x509Key.(*ecdsa.PrivateKey), data)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(x509Key.(ed25519.PrivateKey), data)
 	default:
 		err = errors.New("Unsupported Sign Algorithm")
 	}
@@ -102,13 +154,19 @@ func SignWithPrivateKey(key, data []byte, hash crypto.Hash) (sig []byte, err err
 }
 
 // signWithRSA ...
-func signWithRSA(key *rsa.PrivateKey, hash crypto.Hash, data []byte) (sig []byte, err error) {
+func signWithRSA(key *rsa.PrivateKey, hash crypto.Hash, data []byte, pss bool) (sig []byte, err error) {
 
 	hashed, err := hashWithRSA(hash, data)
-	if err == nil {
-		sig, err = rsa.SignPKCS1v15(nil, key, hash, hashed)
+	if err != nil {
+		return
 	}
 
+	if pss {
+		sig, err = rsa.SignPSS(rand.Reader, key, hash, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		return
+	}
+
+	sig, err = rsa.SignPKCS1v15(nil, key, hash, hashed)
 	return
 }
 
@@ -174,7 +232,8 @@ func shaWithCryptoHash(hash crypto.Hash, data []byte) (hashed []byte, err error)
 	return
 }
 
-// SizeOfSignature ...
+// SizeOfSignature returns the maximum size of a signature made by the
+// private key of pubkey, it is the same for PKCS#1 v1.5 and PSS.
 func SizeOfSignature(pubkey []byte, hash crypto.Hash) (size int, err error) {
 	pubKey, err := x509.ParsePKIXPublicKey(pubkey)
 	if err != nil {
@@ -183,10 +242,11 @@ func SizeOfSignature(pubkey []byte, hash crypto.Hash) (size int, err error) {
 
 	switch pubKey.(type) {
 	case *rsa.PublicKey:
-		size, err = sizeOfSignatureWithRSA(hash)
+		size, err = sizeOfSignatureWithRSA(pubKey.(*rsa.PublicKey), hash)
 	case *ecdsa.PublicKey:
 		size, err = sizeOfSignatureWithECDSA(pubKey.(*ecdsa.PublicKey))
-
+	case ed25519.PublicKey:
+		size = ed25519.SignatureSize
 	default:
 		err = errors.New("Unsupported Verify Algorithm")
 	}
@@ -195,29 +255,45 @@ func SizeOfSignature(pubkey []byte, hash crypto.Hash) (size int, err error) {
 
 }
 
-// sizeOfSignatureWithRSA ...
-func sizeOfSignatureWithRSA(hash crypto.Hash) (size int, err error) {
+// sizeOfSignatureWithRSA is the size of the modulus.
+func sizeOfSignatureWithRSA(pubKey *rsa.PublicKey, hash crypto.Hash) (size int, err error) {
+
+	_, err = shaWithCryptoHash(hash, nil)
+	if err != nil {
+		return
+	}
 
-	// TODO: Implement
+	size = pubKey.Size()
 	return
 }
 
-// sizeOfSignatureWithECDSA ...
+// sizeOfSignatureWithECDSA is the size of the ASN.1 DER sequence of r and s,
+// both at most as long as the curve order and maybe with a leading zero.
 func sizeOfSignatureWithECDSA(pubKey *ecdsa.PublicKey) (size int, err error) {
-	curveName := pubKey.Params().Name
+	params := pubKey.Params()
 
-	// TODO: Implement
-	switch curveName {
-	case "P-224":
-		size = 1
-	case "P-256":
-		size = 2
-	case "P-384":
-		size = 3
-	case "P-521":
-		size = 4
+	switch params.Name {
+	case "P-224", "P-256", "P-384", "P-521":
 	default:
-		err = fmt.Errorf("Unsupported Curve Name: %s", curveName)
+		err = fmt.Errorf("Unsupported Curve Name: %s", params.Name)
+		return
+	}
+
+	intSize := params.N.BitLen()/8 + 1
+	intSize += 1 + sizeOfDERLength(intSize)
+	seqSize := 2 * intSize
+	size = 1 + sizeOfDERLength(seqSize) + seqSize
+	return
+}
+
+// sizeOfDERLength ...
+func sizeOfDERLength(length int) (size int) {
+	size = 1
+	if length < 0x80 {
+		return
+	}
+	for ; length > 0; length >>= 8 {
+		size++
 	}
 	return
 }
@@ -228,20 +304,22 @@ type generateKeyAndCertConfig struct {
 	template      *x509.Certificate
 	parentCert    *x509.Certificate
 	parentPrivKey any
+	parentCertPem []byte
+	parentKeyPem  []byte
 	bits          int
 }
 
 // default ...
-func defaultGenerateKeyAndCertConfig(hostname string) *generateKeyAndCertConfig {
+func defaultGenerateKeyAndCertConfig() *generateKeyAndCertConfig {
 	cfg := new(generateKeyAndCertConfig)
 	cfg.algorithm = x509.ECDSA
 	cfg.hash = crypto.SHA256
+	cfg.bits = 2048
 
 	max := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, _ := rand.Int(rand.Reader, max)
 	cfg.template = &x509.Certificate{
 		SerialNumber:          serialNumber,
-		Subject:               pkix.Name{CommonName: hostname},
 		NotBefore:             time.Now(),
 		NotAfter:              time.Now().AddDate(10, 0, 0),
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
@@ -252,25 +330,102 @@ func defaultGenerateKeyAndCertConfig(hostname string) *generateKeyAndCertConfig
 
 }
 
-type generateKeyAndCertConfigFunc func(cfg *generateKeyAndCertConfig)
+type GenerateKeyAndCertWithFn func(cfg *generateKeyAndCertConfig)
 
-// // GenerateKeyAndCertWithSettings ...
-// func GenerateKeyAndCertWithSettings() generateKeyAndCertConfigFunc {
-// 	return func (cfg *generateKeyAndCertConfig){}
-// }
+// GenerateKeyAndCertWithAlgorithm selects RSA, ECDSA or Ed25519, the
+// default is ECDSA.
+func GenerateKeyAndCertWithAlgorithm(algorithm x509.PublicKeyAlgorithm) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.algorithm = algorithm
+	}
+}
 
-// GenerateKey ...
-func GenerateKeyAndCert(cfgFns ...generateKeyAndCertConfigFunc) (key []byte, cert []byte, err error) {
+// GenerateKeyAndCertWithHash selects the ECDSA curve by its hash, SHA256
+// is P-256 and the default.
+func GenerateKeyAndCertWithHash(hash crypto.Hash) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.hash = hash
+	}
+}
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		return
+// GenerateKeyAndCertWithBits sets the RSA key size, the default is 2048.
+func GenerateKeyAndCertWithBits(bits int) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.bits = bits
+	}
+}
+
+// GenerateKeyAndCertWithValidity makes the certificate valid from now for
+// validity, the default is 10 years.
+func GenerateKeyAndCertWithValidity(validity time.Duration) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.template.NotAfter = cfg.template.NotBefore.Add(validity)
+	}
+}
+
+// GenerateKeyAndCertWithCommonName replaces the hostname as CommonName.
+func GenerateKeyAndCertWithCommonName(commonName string) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.template.Subject.CommonName = commonName
+	}
+}
+
+// GenerateKeyAndCertWithIPAddresses ...
+func GenerateKeyAndCertWithIPAddresses(ips ...net.IP) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.template.IPAddresses = append(cfg.template.IPAddresses, ips...)
+	}
+}
+
+// GenerateKeyAndCertWithDNSNames ...
+func GenerateKeyAndCertWithDNSNames(names ...string) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.template.DNSNames = append(cfg.template.DNSNames, names...)
+	}
+}
+
+// GenerateKeyAndCertWithCA generates a local CA, which only signs the
+// certificates of nodes and can not sign other CAs.
+func GenerateKeyAndCertWithCA() GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.template.IsCA = true
+		cfg.template.MaxPathLen = 0
+		cfg.template.MaxPathLenZero = true
+		cfg.template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	}
-	cfg := defaultGenerateKeyAndCertConfig(hostname)
+}
+
+// GenerateKeyAndCertWithParent signs the certificate with the pem key and
+// certificate of a CA instead of self signing.
+func GenerateKeyAndCertWithParent(cert, key []byte) GenerateKeyAndCertWithFn {
+	return func(cfg *generateKeyAndCertConfig) {
+		cfg.parentCertPem = cert
+		cfg.parentKeyPem = key
+	}
+}
+
+// GenerateKey ...
+func GenerateKeyAndCert(cfgFns ...GenerateKeyAndCertWithFn) (key []byte, cert []byte, err error) {
+
+	cfg := defaultGenerateKeyAndCertConfig()
 	for _, fn := range cfgFns {
 		fn(cfg)
 	}
 
+	if cfg.template.Subject.CommonName == "" {
+		cfg.template.Subject.CommonName, err = os.Hostname()
+		if err != nil {
+			return
+		}
+	}
+
+	if cfg.parentCertPem != nil {
+		cfg.parentCert, cfg.parentPrivKey, err = parseParentKeyAndCert(cfg.parentCertPem, cfg.parentKeyPem)
+		if err != nil {
+			return
+		}
+	}
+
 	var pubKey any
 	var privKey any
 	var pemType string
@@ -281,6 +436,9 @@ func GenerateKeyAndCert(cfgFns ...generateKeyAndCertConfigFunc) (key []byte, cer
 	case x509.ECDSA:
 		pemType = "EC PRIVATE KEY"
 		pubKey, privKey, err = generateKeyWithECDSA(cfg.hash)
+	case x509.Ed25519:
+		pemType = "PRIVATE KEY"
+		pubKey, privKey, err = generateKeyWithEd25519()
 	default:
 		err = fmt.Errorf("Unsupported Signature Algorithm: %s", cfg.algorithm.String())
 	}
@@ -318,6 +476,52 @@ func GenerateKeyAndCert(cfgFns ...generateKeyAndCertConfigFunc) (key []byte, cer
 	return
 }
 
+// parseParentKeyAndCert ...
+func parseParentKeyAndCert(cert, key []byte) (x509Cert *x509.Certificate, privKey any, err error) {
+
+	x509Cert, err = ParseCertWithPem(cert)
+	if err != nil {
+		return
+	}
+	if x509Cert.IsCA == false {
+		err = errors.New("Parent Is Not CA")
+		return
+	}
+
+	block, _ := pem.Decode(key)
+	if block == nil {
+		err = errors.New("Invalid Pem")
+		return
+	}
+	privKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	return
+}
+
+// VerifyCertWithCA checks that x509Cert is issued by the pem certificate
+// of a local CA.
+func VerifyCertWithCA(x509Cert *x509.Certificate, caCert []byte) (err error) {
+
+	x509CACert, err := ParseCertWithPem(caCert)
+	if err != nil {
+		return
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(x509CACert)
+	err = VerifyCertWithRoots(x509Cert, roots)
+	return
+}
+
+// VerifyCertWithRoots checks that x509Cert is issued by one of the parsed
+// CA certificates of roots.
+func VerifyCertWithRoots(x509Cert *x509.Certificate, roots *x509.CertPool) (err error) {
+	_, err = x509Cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return
+}
+
 // generateKeyWithRSA ...
 func generateKeyWithRSA(bits int) (pubKey any, privKey any, err error) {
 	caPrivkey, err := rsa.GenerateKey(rand.Reader, bits)
@@ -356,3 +560,13 @@ func generateKeyWithECDSA(hash crypto.Hash) (pubKey any, privKey any, err error)
 	}
 	return
 }
+
+// generateKeyWithEd25519 ...
+func generateKeyWithEd25519() (pubKey any, privKey any, err error) {
+	edPubKey, edPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	if err == nil {
+		pubKey = edPubKey
+		privKey = edPrivKey
+	}
+	return
+}
@@ -0,0 +1,223 @@
+package core_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"pan/core"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestPublicKey ...
+func newTestPublicKey(t *testing.T, cert []byte) []byte {
+	x509Cert, err := core.ParseCertWithPem(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := core.ExtractPublicKeyFromCert(x509Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pubKey
+}
+
+// newTestECDSAKey ...
+func newTestECDSAKey(t *testing.T, curve elliptic.Curve) (key []byte, pubKey []byte) {
+	privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err = x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return
+}
+
+// TestSecure ...
+func TestSecure(t *testing.T) {
+
+	data := []byte("hello")
+
+	t.Run("Sign and verify", func(t *testing.T) {
+
+		algorithms := []x509.PublicKeyAlgorithm{x509.RSA, x509.ECDSA, x509.Ed25519}
+		for _, algorithm := range algorithms {
+			key, cert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithAlgorithm(algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pubKey := newTestPublicKey(t, cert)
+
+			sig, err := core.SignWithPrivateKey(key, data, crypto.SHA256)
+			assert.Nil(t, err, "Sign error should be nil: %s", algorithm)
+
+			err = core.VerifyWithPublicKey(pubKey, data, sig, crypto.SHA256)
+			assert.Nil(t, err, "Verify error should be nil: %s", algorithm)
+
+			err = core.VerifyWithPublicKey(pubKey, []byte("forged"), sig, crypto.SHA256)
+			assert.NotNil(t, err, "Verify error should not be nil: %s", algorithm)
+
+			size, err := core.SizeOfSignature(pubKey, crypto.SHA256)
+			assert.Nil(t, err, "Size error should be nil: %s", algorithm)
+			assert.LessOrEqual(t, len(sig), size, "Signature should fit in size: %s", algorithm)
+		}
+	})
+
+	t.Run("Sign and verify with PSS", func(t *testing.T) {
+
+		key, cert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithAlgorithm(x509.RSA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey := newTestPublicKey(t, cert)
+
+		sig, err := core.SignWithPrivateKey(key, data, crypto.SHA256, core.SignWithPSS())
+		assert.Nil(t, err, "Sign error should be nil")
+
+		err = core.VerifyWithPublicKey(pubKey, data, sig, crypto.SHA256, core.SignWithPSS())
+		assert.Nil(t, err, "Verify error should be nil")
+
+		err = core.VerifyWithPublicKey(pubKey, data, sig, crypto.SHA256)
+		assert.NotNil(t, err, "PKCS1v15 verify error should not be nil")
+	})
+
+	t.Run("SizeOfSignature", func(t *testing.T) {
+
+		_, cert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithAlgorithm(x509.RSA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := core.SizeOfSignature(newTestPublicKey(t, cert), crypto.SHA256)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, 256, size, "RSA 2048 size should be 256")
+
+		_, cert, err = core.GenerateKeyAndCert(core.GenerateKeyAndCertWithAlgorithm(x509.Ed25519))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err = core.SizeOfSignature(newTestPublicKey(t, cert), crypto.SHA256)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, 64, size, "Ed25519 size should be 64")
+
+		curves := map[elliptic.Curve]int{
+			elliptic.P224(): 64,
+			elliptic.P256(): 72,
+			elliptic.P384(): 104,
+			elliptic.P521(): 139,
+		}
+		for curve, expected := range curves {
+			key, pubKey := newTestECDSAKey(t, curve)
+			size, err := core.SizeOfSignature(pubKey, crypto.SHA256)
+			assert.Nil(t, err, "Error should be nil")
+			assert.Equal(t, expected, size, "Size should be same: %s", curve.Params().Name)
+
+			for i := 0; i < 8; i++ {
+				sig, err := core.SignWithPrivateKey(key, data, crypto.SHA256)
+				assert.Nil(t, err, "Sign error should be nil")
+				assert.LessOrEqual(t, len(sig), size, "Signature should fit in size: %s", curve.Params().Name)
+			}
+		}
+	})
+
+	t.Run("SizeOfSignature with unsupported hash", func(t *testing.T) {
+
+		_, cert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithAlgorithm(x509.RSA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = core.SizeOfSignature(newTestPublicKey(t, cert), crypto.MD5)
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	t.Run("SignWithPrivateKey with invalid pem", func(t *testing.T) {
+
+		_, err := core.SignWithPrivateKey([]byte("invalid"), data, crypto.SHA256)
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	t.Run("GenerateKeyAndCert with options", func(t *testing.T) {
+
+		ip := net.ParseIP("192.168.1.2")
+		_, cert, err := core.GenerateKeyAndCert(
+			core.GenerateKeyAndCertWithAlgorithm(x509.RSA),
+			core.GenerateKeyAndCertWithBits(3072),
+			core.GenerateKeyAndCertWithValidity(time.Hour),
+			core.GenerateKeyAndCertWithCommonName("node"),
+			core.GenerateKeyAndCertWithIPAddresses(ip),
+			core.GenerateKeyAndCertWithDNSNames("node.local"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x509Cert, err := core.ParseCertWithPem(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, _ := core.SizeOfSignature(newTestPublicKey(t, cert), crypto.SHA256)
+
+		assert.Equal(t, x509.RSA, x509Cert.PublicKeyAlgorithm, "Algorithm should be RSA")
+		assert.Equal(t, 384, size, "RSA key should have 3072 bits")
+		assert.Equal(t, time.Hour, x509Cert.NotAfter.Sub(x509Cert.NotBefore), "Validity should be same")
+		assert.Equal(t, "node", x509Cert.Subject.CommonName, "CommonName should be same")
+		assert.True(t, ip.Equal(x509Cert.IPAddresses[0]), "IP address should be same")
+		assert.Equal(t, []string{"node.local"}, x509Cert.DNSNames, "DNS names should be same")
+		assert.False(t, x509Cert.IsCA, "Certificate should not be CA")
+	})
+
+	t.Run("GenerateKeyAndCert with CA", func(t *testing.T) {
+
+		caKey, caCert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithCA(), core.GenerateKeyAndCertWithCommonName("ca"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cert, err := core.GenerateKeyAndCert(
+			core.GenerateKeyAndCertWithAlgorithm(x509.Ed25519),
+			core.GenerateKeyAndCertWithParent(caCert, caKey),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, otherCert, err := core.GenerateKeyAndCert()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		x509CACert, _ := core.ParseCertWithPem(caCert)
+		x509Cert, _ := core.ParseCertWithPem(cert)
+		x509OtherCert, _ := core.ParseCertWithPem(otherCert)
+
+		assert.True(t, x509CACert.IsCA, "CA should be CA")
+		assert.Equal(t, "ca", x509Cert.Issuer.CommonName, "Issuer should be CA")
+		assert.Nil(t, core.VerifyCertWithCA(x509Cert, caCert), "Issued certificate should be verified")
+		assert.NotNil(t, core.VerifyCertWithCA(x509OtherCert, caCert), "Self signed certificate should not be verified")
+
+		roots := x509.NewCertPool()
+		roots.AddCert(x509CACert)
+		assert.Nil(t, core.VerifyCertWithRoots(x509Cert, roots), "Issued certificate should be verified with roots")
+		assert.NotNil(t, core.VerifyCertWithRoots(x509OtherCert, roots), "Self signed certificate should not be verified with roots")
+	})
+
+	t.Run("GenerateKeyAndCert with parent not CA", func(t *testing.T) {
+
+		key, cert, err := core.GenerateKeyAndCert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = core.GenerateKeyAndCert(core.GenerateKeyAndCertWithParent(cert, key))
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+}
@@ -34,6 +34,19 @@ func (bi *BucketItem[T, V]) Value() (val T) {
 	return
 }
 
+// BlockId returns the id of the block, ok is false for removed items.
+func (bi *BucketItem[T, V]) BlockId() (id V, ok bool) {
+
+	bi.rw.RLock()
+	if bi.idx >= 0 {
+		id = bi.block.id
+		ok = true
+	}
+	bi.rw.RUnlock()
+
+	return
+}
+
 // Block ...
 // func (bi *BucketItem[T, V]) Block() *BucketBlock[T, V] {
 // 	return bi.block
@@ -100,6 +113,19 @@ func (b *Bucket[T, V]) FindBlockItem(targetId V) (item *BucketItem[T, V]) {
 	return
 }
 
+// Items ...
+func (b *Bucket[T, V]) Items() (items []*BucketItem[T, V]) {
+
+	b.rw.RLock()
+	items = make([]*BucketItem[T, V], 0, len(b.blocks))
+	for _, block := range b.blocks {
+		items = append(items, block.items...)
+	}
+	b.rw.RUnlock()
+
+	return
+}
+
 // PutItem ...
 func (b *Bucket[T, V]) PutItem(targetId V, value T) (item *BucketItem[T, V]) {
 
@@ -157,7 +183,7 @@ func (b *Bucket[T, V]) RemoveItem(item *BucketItem[T, V]) {
 			if idx != 0 {
 				copy(items, block.items[:idx])
 			}
-			copy(items, block.items[idx+1:])
+			copy(items[idx:], block.items[idx+1:])
 			for _, nitem := range items[idx:] {
 				nitem.idx--
 			}
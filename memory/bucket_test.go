@@ -45,6 +45,77 @@ func TestBucket(t *testing.T) {
 
 	})
 
+	t.Run("RemoveItem from middle and end", func(t *testing.T) {
+
+		bucket := memory.NewBucket[string, int](cmp.Compare[int])
+
+		bucket.PutItem(3, "value 3-0")
+		middle := bucket.PutItem(3, "value 3-1")
+		bucket.PutItem(3, "value 3-2")
+		last := bucket.PutItem(3, "value 3-3")
+		before := bucket.FindBlockItems(3)
+
+		values := func(items []*memory.BucketItem[string, int]) []string {
+			result := make([]string, 0, len(items))
+			for _, item := range items {
+				result = append(result, item.Value())
+			}
+			return result
+		}
+
+		bucket.RemoveItem(middle)
+		assert.Equal(t, []string{"value 3-0", "value 3-2", "value 3-3"}, values(bucket.FindBlockItems(3)), "Items should keep order after remove middle")
+
+		bucket.RemoveItem(last)
+		items := bucket.FindBlockItems(3)
+		assert.Equal(t, []string{"value 3-0", "value 3-2"}, values(items), "Items should keep order after remove end")
+		assert.True(t, middle.Expired(), "Middle item should be expired")
+		assert.True(t, last.Expired(), "Last item should be expired")
+
+		assert.Equal(t, []string{"value 3-0", "value 3-1", "value 3-2", "value 3-3"}, values(before), "Found items should not be changed by remove")
+
+		bucket.RemoveItem(items[1])
+		assert.Equal(t, []string{"value 3-0"}, values(bucket.FindBlockItems(3)), "Items should be removed by shifted index")
+		assert.Equal(t, []string{"value 3-0", "value 3-2"}, values(items), "Found items should not be changed by remove")
+
+	})
+
+	t.Run("Items", func(t *testing.T) {
+
+		bucket := memory.NewBucket[string, int](cmp.Compare[int])
+
+		bucket.PutItem(4, "value 4")
+		item := bucket.PutItem(3, "value 3")
+		bucket.PutItem(3, "value 3-1")
+		bucket.PutItem(3, "value 3-2")
+		bucket.PutItem(5, "value 5")
+		bucket.RemoveItem(item)
+		items := bucket.Items()
+
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			values = append(values, item.Value())
+		}
+
+		assert.Equal(t, []string{"value 3-1", "value 3-2", "value 4", "value 5"}, values, "Items should be ordered by block")
+
+	})
+
+	t.Run("BlockId", func(t *testing.T) {
+
+		bucket := memory.NewBucket[string, int](cmp.Compare[int])
+
+		item := bucket.PutItem(3, "value 3")
+		id, ok := item.BlockId()
+		assert.True(t, ok, "Item should have block id")
+		assert.Equal(t, 3, id, "Block id should be same")
+
+		bucket.RemoveItem(item)
+		_, ok = item.BlockId()
+		assert.False(t, ok, "Removed item should not have block id")
+
+	})
+
 	// t.Run("Test", func(t *testing.T) {
 
 	// 	bucket := memory.NewBucket[string, int](cmp.Compare[int])
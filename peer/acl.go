@@ -0,0 +1,488 @@
+package peer
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"pan/core"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AccessRuleType string
+
+const (
+	PeerIdAccessRuleType    = AccessRuleType("peer_id")
+	NamespaceAccessRuleType = AccessRuleType("namespace")
+	IssuerAccessRuleType    = AccessRuleType("issuer")
+	CIDRAccessRuleType      = AccessRuleType("cidr")
+)
+
+// accessRuleTypes is the order rules are checked in, the first type with a
+// matching rule decides.
+var accessRuleTypes = []AccessRuleType{
+	PeerIdAccessRuleType,
+	IssuerAccessRuleType,
+	CIDRAccessRuleType,
+	NamespaceAccessRuleType,
+}
+
+var ErrInvalidAccessRule = errors.New("Invalid Access Rule")
+
+// AccessRule allows or denies the peers matching Value. Value is a PeerId or
+// namespace uuid, the pem certificate of an issuing CA or a CIDR.
+// ExpiredAt is a unix time, zero never expires.
+type AccessRule struct {
+	Id        int64          `json:"id"`
+	Type      AccessRuleType `json:"type"`
+	Value     string         `json:"value"`
+	Allow     bool           `json:"allow"`
+	ExpiredAt int64          `json:"expiredAt,omitempty"`
+}
+
+// Expired ...
+func (r *AccessRule) Expired(now time.Time) bool {
+	return r.ExpiredAt > 0 && r.ExpiredAt <= now.Unix()
+}
+
+// AccessRequest is what a rule is matched against.
+type AccessRequest struct {
+	PeerId      PeerId
+	Namespace   uuid.UUID
+	Certificate *x509.Certificate
+	Addr        []byte
+}
+
+// AccessRuleStore keeps the rules, it is a config file or database.
+type AccessRuleStore interface {
+	Init() error
+	FindRules() ([]*AccessRule, error)
+	SaveRule(rule *AccessRule) error
+	RemoveRule(id int64) error
+}
+
+// AccessList is the access policy of a PeerIdGenerator, the rules can be
+// changed at runtime.
+type AccessList interface {
+	Init() error
+	Rules() []*AccessRule
+	AddRule(rule *AccessRule) error
+	RemoveRule(id int64) error
+	Check(req *AccessRequest) (allow bool, matched bool)
+}
+
+type accessRuleSt struct {
+	*AccessRule
+	id     uuid.UUID
+	prefix netip.Prefix
+	roots  *x509.CertPool
+}
+
+// match ...
+func (r *accessRuleSt) match(req *AccessRequest) bool {
+	switch r.Type {
+	case PeerIdAccessRuleType:
+		return r.id == uuid.UUID(req.PeerId)
+	case NamespaceAccessRuleType:
+		return r.id == req.Namespace
+	case IssuerAccessRuleType:
+		return req.Certificate != nil && core.VerifyCertWithRoots(req.Certificate, r.roots) == nil
+	case CIDRAccessRuleType:
+		addr, ok := parseAccessAddr(req.Addr)
+		return ok && r.prefix.Contains(addr)
+	}
+	return false
+}
+
+// parseAccessAddr ...
+func parseAccessAddr(addr []byte) (ip netip.Addr, ok bool) {
+	host, _, err := net.SplitHostPort(string(addr))
+	if err != nil {
+		host = string(addr)
+	}
+	ip, err = netip.ParseAddr(host)
+	if err != nil {
+		return
+	}
+	// the zone of a link local addr is dropped, prefixes have no zone
+	ip = ip.Unmap().WithZone("")
+	ok = true
+	return
+}
+
+// compileAccessRule ...
+func compileAccessRule(rule *AccessRule) (compiled *accessRuleSt, err error) {
+
+	compiled = new(accessRuleSt)
+	compiled.AccessRule = rule
+	switch rule.Type {
+	case PeerIdAccessRuleType, NamespaceAccessRuleType:
+		compiled.id, err = uuid.Parse(rule.Value)
+	case IssuerAccessRuleType:
+		// the CA is parsed once, it is checked on every authenticate
+		var caCert *x509.Certificate
+		caCert, err = core.ParseCertWithPem([]byte(rule.Value))
+		if err == nil {
+			compiled.roots = x509.NewCertPool()
+			compiled.roots.AddCert(caCert)
+		}
+	case CIDRAccessRuleType:
+		compiled.prefix, err = netip.ParsePrefix(rule.Value)
+		compiled.prefix = compiled.prefix.Masked()
+	default:
+		err = errors.New("Unsupported Type")
+	}
+
+	if err != nil {
+		compiled = nil
+		err = errors.Join(ErrInvalidAccessRule, err)
+	}
+	return
+}
+
+type accessListSt struct {
+	store AccessRuleStore
+	rules []*accessRuleSt
+	rw    *sync.RWMutex
+}
+
+// Init loads the stored rules.
+func (al *accessListSt) Init() (err error) {
+
+	err = al.store.Init()
+	if err != nil {
+		return
+	}
+
+	rules, err := al.store.FindRules()
+	if err != nil {
+		return
+	}
+
+	compiledRules := make([]*accessRuleSt, 0, len(rules))
+	for _, rule := range rules {
+		compiled, compileErr := compileAccessRule(rule)
+		if compileErr != nil {
+			err = compileErr
+			return
+		}
+		compiledRules = append(compiledRules, compiled)
+	}
+
+	al.rw.Lock()
+	al.rules = compiledRules
+	al.rw.Unlock()
+	return
+}
+
+// Rules ...
+func (al *accessListSt) Rules() (rules []*AccessRule) {
+	al.rw.RLock()
+	rules = make([]*AccessRule, 0, len(al.rules))
+	for _, rule := range al.rules {
+		value := *rule.AccessRule
+		rules = append(rules, &value)
+	}
+	al.rw.RUnlock()
+	return
+}
+
+// AddRule stores the rule, its Id is set by the store.
+func (al *accessListSt) AddRule(rule *AccessRule) (err error) {
+
+	compiled, err := compileAccessRule(rule)
+	if err != nil {
+		return
+	}
+
+	al.rw.Lock()
+	defer al.rw.Unlock()
+
+	err = al.store.SaveRule(rule)
+	if err != nil {
+		return
+	}
+	value := *rule
+	compiled.AccessRule = &value
+	al.rules = append(al.rules, compiled)
+	return
+}
+
+// RemoveRule ...
+func (al *accessListSt) RemoveRule(id int64) (err error) {
+
+	al.rw.Lock()
+	defer al.rw.Unlock()
+
+	err = al.store.RemoveRule(id)
+	if err != nil {
+		return
+	}
+	al.rules = slices.DeleteFunc(al.rules, func(rule *accessRuleSt) bool {
+		return rule.Id == id
+	})
+	return
+}
+
+// Check returns the decision of the first rule type with a matching rule,
+// a deny rule wins over an allow rule of the same type. Expired rules are
+// skipped.
+func (al *accessListSt) Check(req *AccessRequest) (allow bool, matched bool) {
+
+	now := time.Now()
+
+	al.rw.RLock()
+	defer al.rw.RUnlock()
+
+	for _, ruleType := range accessRuleTypes {
+		for _, rule := range al.rules {
+			if rule.Type != ruleType || rule.Expired(now) || rule.match(req) == false {
+				continue
+			}
+			if matched == false {
+				allow = true
+				matched = true
+			}
+			allow = allow && rule.Allow
+		}
+		if matched {
+			return
+		}
+	}
+	return
+}
+
+// NewAccessList ...
+func NewAccessList(store AccessRuleStore) AccessList {
+	al := new(accessListSt)
+	al.store = store
+	al.rules = make([]*accessRuleSt, 0)
+	al.rw = new(sync.RWMutex)
+	return al
+}
+
+type memoryAccessRuleStore struct {
+	rules  []*AccessRule
+	nextId int64
+	mu     *sync.Mutex
+}
+
+// Init ...
+func (s *memoryAccessRuleStore) Init() error {
+	return nil
+}
+
+// FindRules ...
+func (s *memoryAccessRuleStore) FindRules() (rules []*AccessRule, err error) {
+	s.mu.Lock()
+	rules = make([]*AccessRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		value := *rule
+		rules = append(rules, &value)
+	}
+	s.mu.Unlock()
+	return
+}
+
+// SaveRule ...
+func (s *memoryAccessRuleStore) SaveRule(rule *AccessRule) (err error) {
+	s.mu.Lock()
+	s.nextId++
+	rule.Id = s.nextId
+	value := *rule
+	s.rules = append(s.rules, &value)
+	s.mu.Unlock()
+	return
+}
+
+// RemoveRule ...
+func (s *memoryAccessRuleStore) RemoveRule(id int64) (err error) {
+	s.mu.Lock()
+	s.rules = slices.DeleteFunc(s.rules, func(rule *AccessRule) bool {
+		return rule.Id == id
+	})
+	s.mu.Unlock()
+	return
+}
+
+// NewMemoryAccessRuleStore ...
+func NewMemoryAccessRuleStore() AccessRuleStore {
+	store := new(memoryAccessRuleStore)
+	store.rules = make([]*AccessRule, 0)
+	store.mu = new(sync.Mutex)
+	return store
+}
+
+type fileAccessRuleStore struct {
+	*memoryAccessRuleStore
+	path string
+}
+
+// Init reads the rules of the json file, a missing file has no rules.
+func (s *fileAccessRuleStore) Init() (err error) {
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	rules := make([]*AccessRule, 0)
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.nextId = 0
+	for _, rule := range rules {
+		s.nextId = max(s.nextId, rule.Id)
+	}
+	// rules written by hand may leave out the id.
+	for _, rule := range rules {
+		if rule.Id == 0 {
+			s.nextId++
+			rule.Id = s.nextId
+		}
+	}
+	s.mu.Unlock()
+	return
+}
+
+// SaveRule ...
+func (s *fileAccessRuleStore) SaveRule(rule *AccessRule) (err error) {
+	err = s.memoryAccessRuleStore.SaveRule(rule)
+	if err == nil {
+		err = s.write()
+	}
+	return
+}
+
+// RemoveRule ...
+func (s *fileAccessRuleStore) RemoveRule(id int64) (err error) {
+	err = s.memoryAccessRuleStore.RemoveRule(id)
+	if err == nil {
+		err = s.write()
+	}
+	return
+}
+
+// write replaces the file, so a crash never leaves half of the rules.
+func (s *fileAccessRuleStore) write() (err error) {
+
+	rules, err := s.FindRules()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	return
+}
+
+// NewFileAccessRuleStore keeps the rules in a json config file.
+func NewFileAccessRuleStore(path string) AccessRuleStore {
+	store := new(fileAccessRuleStore)
+	store.memoryAccessRuleStore = NewMemoryAccessRuleStore().(*memoryAccessRuleStore)
+	store.path = path
+	return store
+}
+
+// AccessRuleRecord is the database row of an access rule.
+type AccessRuleRecord struct {
+	ID        int64 `gorm:"primary_key;auto_increment"`
+	Type      string
+	Value     string
+	Allow     bool
+	ExpiredAt int64
+}
+
+type gormAccessRuleStore struct {
+	db *gorm.DB
+}
+
+// Init ...
+func (s *gormAccessRuleStore) Init() (err error) {
+	err = s.db.AutoMigrate(&AccessRuleRecord{})
+	return
+}
+
+// FindRules ...
+func (s *gormAccessRuleStore) FindRules() (rules []*AccessRule, err error) {
+	records := make([]*AccessRuleRecord, 0)
+	result := s.db.Find(&records)
+	err = result.Error
+	if err != nil {
+		return
+	}
+
+	rules = make([]*AccessRule, 0, len(records))
+	for _, record := range records {
+		rule := new(AccessRule)
+		rule.Id = record.ID
+		rule.Type = AccessRuleType(record.Type)
+		rule.Value = record.Value
+		rule.Allow = record.Allow
+		rule.ExpiredAt = record.ExpiredAt
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// SaveRule ...
+func (s *gormAccessRuleStore) SaveRule(rule *AccessRule) (err error) {
+	record := new(AccessRuleRecord)
+	record.Type = string(rule.Type)
+	record.Value = rule.Value
+	record.Allow = rule.Allow
+	record.ExpiredAt = rule.ExpiredAt
+
+	result := s.db.Create(record)
+	err = result.Error
+	if err == nil {
+		rule.Id = record.ID
+	}
+	return
+}
+
+// RemoveRule ...
+func (s *gormAccessRuleStore) RemoveRule(id int64) (err error) {
+	result := s.db.Delete(&AccessRuleRecord{}, id)
+	err = result.Error
+	return
+}
+
+// NewGormAccessRuleStore ...
+func NewGormAccessRuleStore(db *gorm.DB) AccessRuleStore {
+	store := new(gormAccessRuleStore)
+	store.db = db
+	return store
+}
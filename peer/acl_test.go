@@ -0,0 +1,369 @@
+package peer_test
+
+import (
+	"os"
+	"pan/core"
+	"pan/peer"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newAccessRule ...
+func newAccessRule(ruleType peer.AccessRuleType, value string, allow bool) *peer.AccessRule {
+	rule := new(peer.AccessRule)
+	rule.Type = ruleType
+	rule.Value = value
+	rule.Allow = allow
+	return rule
+}
+
+// newAccessList ...
+func newAccessList(t *testing.T, rules ...*peer.AccessRule) peer.AccessList {
+	acl := peer.NewAccessList(peer.NewMemoryAccessRuleStore())
+	err := acl.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		err = acl.AddRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return acl
+}
+
+// TestAccessList ...
+func TestAccessList(t *testing.T) {
+
+	peerId := peer.PeerId(uuid.New())
+	namespace := uuid.New()
+
+	t.Run("Check PeerId before namespace", func(t *testing.T) {
+
+		acl := newAccessList(t,
+			newAccessRule(peer.NamespaceAccessRuleType, namespace.String(), false),
+			newAccessRule(peer.PeerIdAccessRuleType, uuid.UUID(peerId).String(), true),
+		)
+
+		req := &peer.AccessRequest{PeerId: peerId, Namespace: namespace}
+		allow, matched := acl.Check(req)
+		assert.True(t, matched, "Rule should match")
+		assert.True(t, allow, "PeerId rule should allow")
+
+		req = &peer.AccessRequest{PeerId: peer.PeerId(uuid.New()), Namespace: namespace}
+		allow, matched = acl.Check(req)
+		assert.True(t, matched, "Rule should match")
+		assert.False(t, allow, "Namespace rule should deny")
+
+		req = &peer.AccessRequest{PeerId: peer.PeerId(uuid.New()), Namespace: uuid.New()}
+		_, matched = acl.Check(req)
+		assert.False(t, matched, "Rule should not match")
+	})
+
+	t.Run("Check deny wins in same type", func(t *testing.T) {
+
+		acl := newAccessList(t,
+			newAccessRule(peer.CIDRAccessRuleType, "192.168.0.0/16", true),
+			newAccessRule(peer.CIDRAccessRuleType, "192.168.1.0/24", false),
+		)
+
+		allow, matched := acl.Check(&peer.AccessRequest{Addr: []byte("192.168.1.20:9000")})
+		assert.True(t, matched, "Rule should match")
+		assert.False(t, allow, "Deny rule should win")
+
+		allow, matched = acl.Check(&peer.AccessRequest{Addr: []byte("192.168.2.20:9000")})
+		assert.True(t, matched, "Rule should match")
+		assert.True(t, allow, "Allow rule should allow")
+
+		_, matched = acl.Check(&peer.AccessRequest{Addr: []byte("[fe80::1]:9000")})
+		assert.False(t, matched, "Rule should not match")
+	})
+
+	t.Run("Check CIDR with zoned addr", func(t *testing.T) {
+
+		acl := newAccessList(t, newAccessRule(peer.CIDRAccessRuleType, "fe80::/10", false))
+
+		allow, matched := acl.Check(&peer.AccessRequest{Addr: []byte("[fe80::1%eth0]:9000")})
+		assert.True(t, matched, "Rule should match zoned addr")
+		assert.False(t, allow, "Deny rule should deny")
+	})
+
+	t.Run("Check with expired rule", func(t *testing.T) {
+
+		rule := newAccessRule(peer.PeerIdAccessRuleType, uuid.UUID(peerId).String(), false)
+		rule.ExpiredAt = time.Now().Add(-time.Minute).Unix()
+		acl := newAccessList(t, rule)
+
+		_, matched := acl.Check(&peer.AccessRequest{PeerId: peerId})
+		assert.False(t, matched, "Expired rule should not match")
+	})
+
+	t.Run("Check issuer", func(t *testing.T) {
+
+		caKey, caCert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithCA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cert, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithParent(caCert, caKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, otherCert, err := core.GenerateKeyAndCert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		x509Cert, _ := core.ParseCertWithPem(cert)
+		x509OtherCert, _ := core.ParseCertWithPem(otherCert)
+
+		acl := newAccessList(t, newAccessRule(peer.IssuerAccessRuleType, string(caCert), true))
+
+		allow, matched := acl.Check(&peer.AccessRequest{Certificate: x509Cert})
+		assert.True(t, matched && allow, "Issued certificate should be allowed")
+
+		_, matched = acl.Check(&peer.AccessRequest{Certificate: x509OtherCert})
+		assert.False(t, matched, "Other certificate should not match")
+	})
+
+	t.Run("AddRule with invalid rule", func(t *testing.T) {
+
+		acl := newAccessList(t)
+
+		err := acl.AddRule(newAccessRule(peer.CIDRAccessRuleType, "192.168.0.0/99", true))
+		assert.ErrorIs(t, err, peer.ErrInvalidAccessRule, "Error should be invalid rule")
+
+		err = acl.AddRule(newAccessRule(peer.AccessRuleType("unknown"), "", true))
+		assert.ErrorIs(t, err, peer.ErrInvalidAccessRule, "Error should be invalid rule")
+		assert.Len(t, acl.Rules(), 0, "Rules should be empty")
+	})
+
+	t.Run("Rules, AddRule and RemoveRule", func(t *testing.T) {
+
+		rule := newAccessRule(peer.PeerIdAccessRuleType, uuid.UUID(peerId).String(), false)
+		acl := newAccessList(t, rule)
+
+		rules := acl.Rules()
+		assert.Len(t, rules, 1, "Rules should have one")
+		assert.NotZero(t, rules[0].Id, "Rule id should be set")
+		assert.Equal(t, rule.Value, rules[0].Value, "Rule value should be same")
+
+		err := acl.RemoveRule(rules[0].Id)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, acl.Rules(), 0, "Rules should be empty")
+
+		_, matched := acl.Check(&peer.AccessRequest{PeerId: peerId})
+		assert.False(t, matched, "Removed rule should not match")
+	})
+
+	t.Run("FileAccessRuleStore", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "acl.json")
+		err := os.WriteFile(path, []byte(`[{"type": "cidr", "value": "10.0.0.0/8", "allow": false}]`), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		acl := peer.NewAccessList(peer.NewFileAccessRuleStore(path))
+		err = acl.Init()
+		assert.Nil(t, err, "Error should be nil")
+
+		allow, matched := acl.Check(&peer.AccessRequest{Addr: []byte("10.1.2.3:9000")})
+		assert.True(t, matched && !allow, "Rule of file should deny")
+
+		err = acl.AddRule(newAccessRule(peer.PeerIdAccessRuleType, uuid.UUID(peerId).String(), true))
+		assert.Nil(t, err, "Error should be nil")
+
+		reloaded := peer.NewAccessList(peer.NewFileAccessRuleStore(path))
+		err = reloaded.Init()
+		assert.Nil(t, err, "Error should be nil")
+		rules := reloaded.Rules()
+		assert.Len(t, rules, 2, "Rules should be persisted")
+		assert.Equal(t, int64(1), rules[0].Id, "Rule without id should get one")
+		assert.Equal(t, int64(2), rules[1].Id, "Added rule id should follow")
+	})
+
+	t.Run("Generate with default deny", func(t *testing.T) {
+
+		_, cert, _, _ := newTestKeyAndCert(t)
+		_, otherCert, _, _ := newTestKeyAndCert(t)
+		baseId := uuid.New()
+
+		acl := newAccessList(t, newAccessRule(peer.CIDRAccessRuleType, "127.0.0.0/8", true))
+		generator := peer.NewPeerIdGenerator(true, peer.NewPeerIdGeneratorWithAccessList(acl))
+
+		_, err := generator.Generate(baseId[:], newEndorseNode(t, cert))
+		assert.Nil(t, err, "Error should be nil")
+
+		x509OtherCert, _ := core.ParseCertWithPem(otherCert)
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(x509OtherCert)
+		node.On("Addr").Once().Return([]byte("192.168.1.2:9000"))
+		_, err = generator.Generate(baseId[:], node)
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	t.Run("Generate with runtime rule", func(t *testing.T) {
+
+		_, cert, _, _ := newTestKeyAndCert(t)
+		baseId := uuid.New()
+		node := newEndorseNode(t, cert)
+
+		generator := peer.NewPeerIdGenerator(false)
+		peerId, err := generator.Generate(baseId[:], node)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = generator.AddRule(newAccessRule(peer.PeerIdAccessRuleType, uuid.UUID(peerId).String(), false))
+		assert.Nil(t, err, "Error should be nil")
+		_, err = generator.Generate(baseId[:], node)
+		assert.NotNil(t, err, "Error should not be nil")
+
+		err = generator.RemoveRule(generator.Rules()[0].Id)
+		assert.Nil(t, err, "Error should be nil")
+		_, err = generator.Generate(baseId[:], node)
+		assert.Nil(t, err, "Error should be nil")
+	})
+
+}
+
+// TestGormAccessRuleStore ...
+func TestGormAccessRuleStore(t *testing.T) {
+
+	t.Run("Init", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("CREATE TABLE `access_rule_records`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormAccessRuleStore(db)
+		err = store.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("SaveRule", func(t *testing.T) {
+
+		rule := newAccessRule(peer.CIDRAccessRuleType, "10.0.0.0/8", true)
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("INSERT INTO `access_rule_records`").
+			WithArgs(string(rule.Type), rule.Value, rule.Allow, rule.ExpiredAt).
+			WillReturnResult(sqlmock.NewResult(7, 1))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormAccessRuleStore(db)
+		err = store.SaveRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Equal(t, int64(7), rule.Id, "Rule id should be set")
+
+	})
+
+	t.Run("FindRules", func(t *testing.T) {
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `access_rule_records`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "type", "value", "allow", "expired_at"}).
+				AddRow(3, "cidr", "10.0.0.0/8", true, 0))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormAccessRuleStore(db)
+		rules, err := store.FindRules()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Len(t, rules, 1, "Should find one rule")
+		assert.Equal(t, int64(3), rules[0].Id, "Id should be same")
+		assert.Equal(t, peer.CIDRAccessRuleType, rules[0].Type, "Type should be same")
+		assert.Equal(t, "10.0.0.0/8", rules[0].Value, "Value should be same")
+		assert.True(t, rules[0].Allow, "Allow should be same")
+
+	})
+
+	t.Run("RemoveRule", func(t *testing.T) {
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("DELETE FROM `access_rule_records` WHERE `access_rule_records`.`id` = ?").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormAccessRuleStore(db)
+		err = store.RemoveRule(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+}
@@ -0,0 +1,81 @@
+package peer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"pan/core"
+)
+
+const (
+	AuthenticateNonceSize = 32
+	authenticateHash      = crypto.SHA256
+)
+
+var (
+	initiatorRole = []byte("Initiator")
+	responderRole = []byte("Responder")
+)
+
+// authenticateTranscript is the data signed by each side of the handshake.
+// The role keeps a signature of one side from being replayed by the other.
+func authenticateTranscript(role, reqBaseId, reqNonce, resBaseId, resNonce []byte) []byte {
+	return bytes.Join([][]byte{role, reqBaseId, reqNonce, resBaseId, resNonce}, nil)
+}
+
+// newAuthenticateNonce ...
+func newAuthenticateNonce() (nonce []byte, err error) {
+	nonce = make([]byte, AuthenticateNonceSize)
+	_, err = rand.Read(nonce)
+	return
+}
+
+// keystoreKey returns the private key of keystore, the key must match the
+// certificate which the remote side sees in the TLS handshake.
+func keystoreKey(keystore core.Keystore) (key []byte, err error) {
+	if keystore == nil {
+		err = NewAuthenticateError("Missing Keystore", nil)
+		return
+	}
+
+	key = keystore.PrivateKey()
+	_, err = tls.X509KeyPair(keystore.Certificate(), key)
+	if err != nil {
+		key = nil
+		err = NewAuthenticateError("Invalid Keystore", err)
+	}
+	return
+}
+
+// signTranscript ...
+func (p *peerSt) signTranscript(transcript []byte) (sig []byte, err error) {
+	if p.keyErr != nil {
+		err = p.keyErr
+		return
+	}
+	sig, err = core.SignWithPrivateKey(p.privateKey, transcript, authenticateHash)
+	return
+}
+
+// verifyTranscript checks the signature against the public key of the
+// node certificate.
+func verifyTranscript(node Node, transcript, sig []byte) (err error) {
+	cert := node.Certificate()
+	if cert == nil {
+		err = NewAuthenticateError("Missing Certificate", nil)
+		return
+	}
+
+	pubKey, err := core.ExtractPublicKeyFromCert(cert)
+	if err != nil {
+		err = NewAuthenticateError("Invalid Certificate", err)
+		return
+	}
+
+	err = core.VerifyWithPublicKey(pubKey, transcript, sig, authenticateHash)
+	if err != nil {
+		err = NewAuthenticateError("Invalid Signature", err)
+	}
+	return
+}
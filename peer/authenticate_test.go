@@ -0,0 +1,313 @@
+package peer_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"pan/core"
+	"pan/peer"
+	"sync"
+	"testing"
+
+	coreMocked "pan/mocks/pan/core"
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newAuthenticateKeystore ...
+func newAuthenticateKeystore(t *testing.T, key []byte, cert *x509.Certificate) core.Keystore {
+	keystore := new(coreMocked.MockKeystore)
+	keystore.On("PrivateKey").Maybe().Return(key)
+	keystore.On("Certificate").Maybe().Return(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	return keystore
+}
+
+// signAuthenticateTranscript ...
+func signAuthenticateTranscript(t *testing.T, key []byte, role string, reqBaseId, reqNonce, resBaseId, resNonce []byte) []byte {
+	transcript := bytes.Join([][]byte{[]byte(role), reqBaseId, reqNonce, resBaseId, resNonce}, nil)
+	sig, err := core.SignWithPrivateKey(key, transcript, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// verifyAuthenticateTranscript ...
+func verifyAuthenticateTranscript(cert *x509.Certificate, sig []byte, role string, reqBaseId, reqNonce, resBaseId, resNonce []byte) error {
+	transcript := bytes.Join([][]byte{[]byte(role), reqBaseId, reqNonce, resBaseId, resNonce}, nil)
+	pubKey, err := core.ExtractPublicKeyFromCert(cert)
+	if err != nil {
+		return err
+	}
+	return core.VerifyWithPublicKey(pubKey, transcript, sig, crypto.SHA256)
+}
+
+// newAuthenticateStream answers the authenticate request as the remote
+// peer with baseId, the request is sent to reqs when it is read.
+func newAuthenticateStream(t *testing.T, baseId uuid.UUID, key []byte, reqs chan<- *peer.Request) *TestNodeStream {
+	return newTestStream(func(req *peer.Request) (res *peer.Response, err error) {
+		reqBaseId, err := io.ReadAll(req.Body())
+		if err != nil {
+			return
+		}
+		if reqs != nil {
+			reqs <- req
+		}
+
+		reqNonce := req.Header([]byte("Nonce"))
+		nonce := make([]byte, peer.AuthenticateNonceSize)
+		sig := signAuthenticateTranscript(t, key, "Responder", reqBaseId, reqNonce, baseId[:], nonce)
+		res = peer.NewReponse(0, bytes.NewReader(baseId[:]),
+			peer.NewHeaderSegment([]byte("Nonce"), nonce),
+			peer.NewHeaderSegment([]byte("Signature"), sig))
+		return
+	})
+}
+
+// newVerifyStream answers the verify request with code, the request is
+// sent to reqs when it is read.
+func newVerifyStream(code int, reqs chan<- *peer.Request) *TestNodeStream {
+	return newTestStream(func(req *peer.Request) (res *peer.Response, err error) {
+		if reqs != nil {
+			reqs <- req
+		}
+		res = peer.NewReponse(code, bytes.NewReader(nil))
+		return
+	})
+}
+
+// mockAuthenticate sets up the node to pass the authenticate handshake as
+// the remote peer with baseId.
+func mockAuthenticate(t *testing.T, node *mocked.MockNode, baseId uuid.UUID) {
+	key, _, cert, _ := newTestKeyAndCert(t)
+	node.On("Certificate").Once().Return(cert)
+	node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, baseId, key, nil), nil)
+	node.On("OpenNodeStream").Once().Return(newVerifyStream(0, nil), nil)
+}
+
+// newAuthenticatePeer ...
+func newAuthenticatePeer(t *testing.T, baseId uuid.UUID, generator peer.PeerIdGenerator, maxFailedNum uint8, withFns ...peer.NewPeerWithFn) peer.Peer {
+	key, _, cert, _ := newTestKeyAndCert(t)
+	return peer.New(baseId, newAuthenticateKeystore(t, key, cert), new(coreMocked.MockApp[peer.Context]), generator, maxFailedNum, withFns...)
+}
+
+// TestAuthenticate ...
+func TestAuthenticate(t *testing.T) {
+
+	t.Run("Mutual signature", func(t *testing.T) {
+
+		baseId := uuid.New()
+		key, _, cert, _ := newTestKeyAndCert(t)
+		remoteBaseId := uuid.New()
+		remoteKey, _, remoteCert, _ := newTestKeyAndCert(t)
+		remotePeerId := peer.PeerId(uuid.New())
+
+		authReqs := make(chan *peer.Request, 1)
+		verifyReqs := make(chan *peer.Request, 1)
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(remoteCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, remoteBaseId, remoteKey, authReqs), nil)
+		node.On("OpenNodeStream").Once().Return(newVerifyStream(0, verifyReqs), nil)
+		node.On("AcceptNodeStream", mock.Anything).Maybe().Return(nil, net.ErrClosed)
+
+		generator := new(mocked.MockPeerIdGenerator)
+		generator.On("Generate", remoteBaseId[:], node).Once().Return(remotePeerId, nil)
+
+		p := peer.New(baseId, newAuthenticateKeystore(t, key, cert), nil, generator, 0)
+		peerId, err := p.Authenticate(node, peer.OpenAuthenticateMode)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, remotePeerId, peerId, "Peer Id should be same")
+
+		authReq := <-authReqs
+		verifyReq := <-verifyReqs
+		nonce := authReq.Header([]byte("Nonce"))
+		assert.Len(t, nonce, peer.AuthenticateNonceSize, "Nonce size should be same")
+		assert.Equal(t, []byte("Verify"), verifyReq.Method(), "Verify method should be same")
+
+		resNonce := make([]byte, peer.AuthenticateNonceSize)
+		sig := verifyReq.Header([]byte("Signature"))
+		err = verifyAuthenticateTranscript(cert, sig, "Initiator", baseId[:], nonce, remoteBaseId[:], resNonce)
+		assert.Nil(t, err, "Initiator signature should be valid")
+		err = verifyAuthenticateTranscript(cert, sig, "Responder", baseId[:], nonce, remoteBaseId[:], resNonce)
+		assert.NotNil(t, err, "Initiator signature should not be valid as responder")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Invalid remote signature", func(t *testing.T) {
+
+		remoteBaseId := uuid.New()
+		_, _, remoteCert, _ := newTestKeyAndCert(t)
+		otherKey, _, _, _ := newTestKeyAndCert(t)
+
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(remoteCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, remoteBaseId, otherKey, nil), nil)
+
+		generator := new(mocked.MockPeerIdGenerator)
+		p := newAuthenticatePeer(t, uuid.New(), generator, 0)
+		_, err := p.Authenticate(node, peer.OpenAuthenticateMode)
+
+		var authErr *peer.AuthenticateError
+		assert.ErrorAs(t, err, &authErr, "Error should be authenticate error")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Keystore key not matching certificate", func(t *testing.T) {
+
+		remoteBaseId := uuid.New()
+		remoteKey, _, remoteCert, _ := newTestKeyAndCert(t)
+		key, _, _, _ := newTestKeyAndCert(t)
+		_, _, otherCert, _ := newTestKeyAndCert(t)
+
+		node := new(mocked.MockNode)
+		node.On("Certificate").Maybe().Return(remoteCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, remoteBaseId, remoteKey, nil), nil)
+
+		generator := new(mocked.MockPeerIdGenerator)
+		generator.On("Generate", remoteBaseId[:], node).Maybe().Return(peer.PeerId(uuid.New()), nil)
+
+		p := peer.New(uuid.New(), newAuthenticateKeystore(t, key, otherCert), nil, generator, 0)
+		_, err := p.Authenticate(node, peer.OpenAuthenticateMode)
+
+		var authErr *peer.AuthenticateError
+		assert.ErrorAs(t, err, &authErr, "Error should be authenticate error")
+		assert.ErrorContains(t, err, "Invalid Keystore", "Error should be invalid keystore")
+
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Rejected verify", func(t *testing.T) {
+
+		remoteBaseId := uuid.New()
+		remoteKey, _, remoteCert, _ := newTestKeyAndCert(t)
+		remotePeerId := peer.PeerId(uuid.New())
+
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(remoteCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, remoteBaseId, remoteKey, nil), nil)
+		node.On("OpenNodeStream").Once().Return(newVerifyStream(peer.UnauthorizedErrorCode, nil), nil)
+
+		generator := new(mocked.MockPeerIdGenerator)
+		generator.On("Generate", remoteBaseId[:], node).Once().Return(remotePeerId, nil)
+
+		p := newAuthenticatePeer(t, uuid.New(), generator, 0)
+		_, err := p.Authenticate(node, peer.OpenAuthenticateMode)
+
+		var authErr *peer.AuthenticateError
+		var resErr *peer.ResponseError
+		assert.ErrorAs(t, err, &authErr, "Error should be authenticate error")
+		assert.ErrorAs(t, err, &resErr, "Error should wrap response error")
+		assert.Equal(t, peer.UnauthorizedErrorCode, resErr.Code(), "Error code should be unauthorized")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Transport error", func(t *testing.T) {
+
+		terr := errors.New("Test Error")
+		node := new(mocked.MockNode)
+		node.On("OpenNodeStream").Once().Return(nil, terr)
+
+		p := newAuthenticatePeer(t, uuid.New(), nil, 0)
+		_, err := p.Authenticate(node, peer.OpenAuthenticateMode)
+
+		var authErr *peer.AuthenticateError
+		assert.ErrorIs(t, err, terr, "Error should be transport error")
+		assert.False(t, errors.As(err, &authErr), "Error should not be authenticate error")
+
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Accept with invalid signature", func(t *testing.T) {
+
+		baseId := uuid.New()
+		key, _, cert, _ := newTestKeyAndCert(t)
+		_, _, remoteCert, _ := newTestKeyAndCert(t)
+		otherKey, _, _, _ := newTestKeyAndCert(t)
+		remoteBaseId := uuid.New()
+		remotePeerId := peer.PeerId(uuid.New())
+
+		authReqReader, authReqWriter := io.Pipe()
+		authResReader, authResWriter := io.Pipe()
+		authStream := new(TestNodeStream)
+		authStream.Reader = authReqReader
+		authStream.Writer = authResWriter
+		authStream.Closer = authResWriter
+
+		verifyReqReader, verifyReqWriter := io.Pipe()
+		verifyResReader, verifyResWriter := io.Pipe()
+		verifyStream := new(TestNodeStream)
+		verifyStream.Reader = verifyReqReader
+		verifyStream.Writer = verifyResWriter
+		verifyStream.Closer = verifyResWriter
+
+		ctx := context.Background()
+		node := new(mocked.MockNode)
+		node.On("AcceptNodeStream", ctx).Once().Return(authStream, nil)
+		node.On("AcceptNodeStream", ctx).Once().Return(verifyStream, nil)
+		node.On("AcceptNodeStream", ctx).Once().Return(nil, net.ErrClosed)
+		node.On("Certificate").Once().Return(remoteCert)
+
+		generator := new(mocked.MockPeerIdGenerator)
+		generator.On("Generate", remoteBaseId[:], node).Once().Return(remotePeerId, nil)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := peer.New(baseId, newAuthenticateKeystore(t, key, cert), nil, generator, 0)
+			p.AcceptAuthenticate(ctx, node)
+		}()
+
+		nonce := make([]byte, peer.AuthenticateNonceSize)
+		req := peer.NewRequest([]byte("Authenticate"), bytes.NewReader(remoteBaseId[:]),
+			peer.NewHeaderSegment([]byte("Mode"), []byte{peer.NormalAuthenticateMode}),
+			peer.NewHeaderSegment([]byte("Nonce"), nonce))
+		reader, _ := peer.MarshalRequest(req)
+		_, _ = io.Copy(authReqWriter, reader)
+		authReqWriter.Close()
+
+		res := new(peer.Response)
+		err := peer.UnmarshalResponse(authResReader, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resBaseId, _ := io.ReadAll(res.Body())
+		resNonce := res.Header([]byte("Nonce"))
+
+		sig := signAuthenticateTranscript(t, otherKey, "Initiator", remoteBaseId[:], nonce, resBaseId, resNonce)
+		req = peer.NewRequest([]byte("Verify"), nil, peer.NewHeaderSegment([]byte("Signature"), sig))
+		reader, _ = peer.MarshalRequest(req)
+		_, _ = io.Copy(verifyReqWriter, reader)
+		verifyReqWriter.Close()
+
+		res = new(peer.Response)
+		err = peer.UnmarshalResponse(verifyResReader, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(res.Body())
+
+		wg.Wait()
+
+		assert.Equal(t, peer.UnauthorizedErrorCode, res.Code(), "Response code should be unauthorized")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+	})
+
+}
@@ -0,0 +1,158 @@
+package peer
+
+import (
+	"pan/core"
+	"slices"
+	"sync"
+)
+
+// EveryoneGroup holds every authenticated peer, its grants are public.
+const EveryoneGroup = "*"
+
+// Authorizer grants method patterns to PeerIds and groups. The patterns have
+// the params and wildcard of core.Router, so "folder/*" grants all methods of
+// the folder service. As a handler of core.App[Context], methods which are
+// not granted get ForbiddenErrorCode.
+type Authorizer interface {
+	core.Handler[Context]
+	Allowed(peerId PeerId, method []byte) bool
+	GrantPeer(peerId PeerId, patterns ...string)
+	RevokePeer(peerId PeerId, patterns ...string)
+	GrantGroup(group string, patterns ...string)
+	RevokeGroup(group string, patterns ...string)
+	AddMember(group string, peerId PeerId)
+	RemoveMember(group string, peerId PeerId)
+}
+
+type authorizerSt struct {
+	peerGrants  map[PeerId][]string
+	groupGrants map[string][]string
+	members     map[PeerId][]string
+	rw          *sync.RWMutex
+}
+
+// Handle ...
+func (a *authorizerSt) Handle(ctx Context, next core.Next) error {
+	if a.Allowed(ctx.PeerId(), ctx.Method()) == false {
+		return NewReponseError(ForbiddenErrorCode, "Forbidden")
+	}
+	return next()
+}
+
+// Allowed ...
+func (a *authorizerSt) Allowed(peerId PeerId, method []byte) bool {
+
+	path := string(method)
+
+	a.rw.RLock()
+	defer a.rw.RUnlock()
+
+	if matchGrants(a.peerGrants[peerId], path) || matchGrants(a.groupGrants[EveryoneGroup], path) {
+		return true
+	}
+	for _, group := range a.members[peerId] {
+		if matchGrants(a.groupGrants[group], path) {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantPeer ...
+func (a *authorizerSt) GrantPeer(peerId PeerId, patterns ...string) {
+	a.rw.Lock()
+	a.peerGrants[peerId] = appendGrants(a.peerGrants[peerId], patterns)
+	a.rw.Unlock()
+}
+
+// RevokePeer removes the patterns, no patterns removes all.
+func (a *authorizerSt) RevokePeer(peerId PeerId, patterns ...string) {
+	a.rw.Lock()
+	grants := removeGrants(a.peerGrants[peerId], patterns)
+	if len(grants) > 0 {
+		a.peerGrants[peerId] = grants
+	} else {
+		delete(a.peerGrants, peerId)
+	}
+	a.rw.Unlock()
+}
+
+// GrantGroup ...
+func (a *authorizerSt) GrantGroup(group string, patterns ...string) {
+	a.rw.Lock()
+	a.groupGrants[group] = appendGrants(a.groupGrants[group], patterns)
+	a.rw.Unlock()
+}
+
+// RevokeGroup removes the patterns, no patterns removes all.
+func (a *authorizerSt) RevokeGroup(group string, patterns ...string) {
+	a.rw.Lock()
+	grants := removeGrants(a.groupGrants[group], patterns)
+	if len(grants) > 0 {
+		a.groupGrants[group] = grants
+	} else {
+		delete(a.groupGrants, group)
+	}
+	a.rw.Unlock()
+}
+
+// AddMember ...
+func (a *authorizerSt) AddMember(group string, peerId PeerId) {
+	a.rw.Lock()
+	a.members[peerId] = appendGrants(a.members[peerId], []string{group})
+	a.rw.Unlock()
+}
+
+// RemoveMember ...
+func (a *authorizerSt) RemoveMember(group string, peerId PeerId) {
+	a.rw.Lock()
+	groups := removeGrants(a.members[peerId], []string{group})
+	if len(groups) > 0 {
+		a.members[peerId] = groups
+	} else {
+		delete(a.members, peerId)
+	}
+	a.rw.Unlock()
+}
+
+// NewAuthorizer denies everything until it is granted.
+func NewAuthorizer() Authorizer {
+	a := new(authorizerSt)
+	a.peerGrants = make(map[PeerId][]string)
+	a.groupGrants = make(map[string][]string)
+	a.members = make(map[PeerId][]string)
+	a.rw = new(sync.RWMutex)
+	return a
+}
+
+// matchGrants ...
+func matchGrants(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if core.MatchRoute(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendGrants appends the values which are missing, the slice is copied so
+// readers of the old one are not affected.
+func appendGrants(values []string, added []string) []string {
+	values = slices.Clone(values)
+	for _, value := range added {
+		if slices.Contains(values, value) == false {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// removeGrants ...
+func removeGrants(values []string, removed []string) []string {
+	if len(removed) == 0 {
+		return nil
+	}
+	return slices.DeleteFunc(slices.Clone(values), func(value string) bool {
+		return slices.Contains(removed, value)
+	})
+}
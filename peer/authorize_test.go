@@ -0,0 +1,114 @@
+package peer_test
+
+import (
+	"pan/core"
+	"pan/peer"
+	"testing"
+
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAuthorizer ...
+func TestAuthorizer(t *testing.T) {
+
+	t.Run("GrantPeer and RevokePeer", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		authorizer := peer.NewAuthorizer()
+		assert.False(t, authorizer.Allowed(peerId, []byte("folder/list")), "Method should be denied by default")
+
+		authorizer.GrantPeer(peerId, "folder/*", "file/:id/read")
+		assert.True(t, authorizer.Allowed(peerId, []byte("folder/list")), "Wildcard should be allowed")
+		assert.True(t, authorizer.Allowed(peerId, []byte("file/3/read")), "Param should be allowed")
+		assert.False(t, authorizer.Allowed(peerId, []byte("file/3/write")), "Other method should be denied")
+		assert.False(t, authorizer.Allowed(peer.PeerId(uuid.New()), []byte("folder/list")), "Other peer should be denied")
+
+		authorizer.RevokePeer(peerId, "folder/*")
+		assert.False(t, authorizer.Allowed(peerId, []byte("folder/list")), "Revoked method should be denied")
+		assert.True(t, authorizer.Allowed(peerId, []byte("file/3/read")), "Other grant should be kept")
+
+		authorizer.RevokePeer(peerId)
+		assert.False(t, authorizer.Allowed(peerId, []byte("file/3/read")), "All grants should be revoked")
+	})
+
+	t.Run("GrantGroup and members", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		authorizer := peer.NewAuthorizer()
+		authorizer.GrantGroup("family", "folder/*")
+
+		assert.False(t, authorizer.Allowed(peerId, []byte("folder/list")), "Non member should be denied")
+
+		authorizer.AddMember("family", peerId)
+		assert.True(t, authorizer.Allowed(peerId, []byte("folder/list")), "Member should be allowed")
+
+		authorizer.RemoveMember("family", peerId)
+		assert.False(t, authorizer.Allowed(peerId, []byte("folder/list")), "Removed member should be denied")
+
+		authorizer.AddMember("family", peerId)
+		authorizer.RevokeGroup("family")
+		assert.False(t, authorizer.Allowed(peerId, []byte("folder/list")), "Revoked group should be denied")
+	})
+
+	t.Run("GrantGroup everyone", func(t *testing.T) {
+
+		authorizer := peer.NewAuthorizer()
+		authorizer.GrantGroup(peer.EveryoneGroup, "Endorse")
+
+		assert.True(t, authorizer.Allowed(peer.PeerId(uuid.New()), []byte("Endorse")), "Public method should be allowed")
+	})
+
+	t.Run("Handle", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		authorizer := peer.NewAuthorizer()
+		authorizer.GrantPeer(peerId, "folder/*")
+
+		ctx := new(mocked.MockContext)
+		ctx.On("PeerId").Return(peerId)
+		ctx.On("Method").Return([]byte("folder/list"))
+
+		called := false
+		app := core.New[peer.Context]()
+		app.Use(authorizer)
+		app.UseFn([]byte("folder/list"), func(ctx peer.Context, next core.Next) error {
+			called = true
+			return nil
+		})
+		err := app.Run(ctx)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, called, "Handle should be called")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("Handle with forbidden method", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		authorizer := peer.NewAuthorizer()
+		authorizer.GrantPeer(peerId, "folder/*")
+
+		ctx := new(mocked.MockContext)
+		ctx.On("PeerId").Return(peerId)
+		ctx.On("Method").Return([]byte("settings/update"))
+		ctx.On("ThrowError", peer.ForbiddenErrorCode, "Forbidden").Once().Return(nil)
+
+		called := false
+		app := core.New[peer.Context]()
+		app.UseFn(nil, peer.NewRecoverHandle())
+		app.Use(authorizer)
+		app.UseFn([]byte("settings/update"), func(ctx peer.Context, next core.Next) error {
+			called = true
+			return nil
+		})
+		err := app.Run(ctx)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.False(t, called, "Handle should not be called")
+		ctx.AssertExpectations(t)
+	})
+
+}
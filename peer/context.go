@@ -1,25 +1,58 @@
 package peer
 
 import (
+	"context"
 	"io"
 	"pan/core"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Context interface {
+	context.Context
 	core.Context
 	PeerId() PeerId
+	Param(name string) string
 	Headers() []*HeaderSegment
 	Header(name []byte) []byte
 	Body() io.Reader
+	Trailers() []*HeaderSegment
+	Trailer(name []byte) []byte
+	SetTrailers(trailers ...*HeaderSegment)
 	Respond(body io.Reader, headers ...*HeaderSegment) error
 	ThrowError(code int, message string, headers ...*HeaderSegment) error
 }
 
 type contextSt struct {
 	*Request
-	stream NodeStream
-	peerId PeerId
+	stream   NodeStream
+	peerId   PeerId
+	params   core.Params
+	ctx      context.Context
+	cancel   context.CancelFunc
+	trailers []*HeaderSegment
+	mu       sync.Mutex
+}
+
+// Deadline ...
+func (c *contextSt) Deadline() (time.Time, bool) {
+	return c.ctx.Deadline()
+}
+
+// Done ...
+func (c *contextSt) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Err ...
+func (c *contextSt) Err() error {
+	return c.ctx.Err()
+}
+
+// Value ...
+func (c *contextSt) Value(key any) any {
+	return c.ctx.Value(key)
 }
 
 // PeerId ...
@@ -27,6 +60,31 @@ func (c *contextSt) PeerId() PeerId {
 	return c.peerId
 }
 
+// Param ...
+func (c *contextSt) Param(name string) string {
+	return c.params[name]
+}
+
+// SetParams ...
+func (c *contextSt) SetParams(params core.Params) {
+	c.params = params
+}
+
+// SetTrailers sets the trailers of the response, they may be set until
+// the response body reaches EOF.
+func (c *contextSt) SetTrailers(trailers ...*HeaderSegment) {
+	c.mu.Lock()
+	c.trailers = trailers
+	c.mu.Unlock()
+}
+
+// responseTrailers ...
+func (c *contextSt) responseTrailers() []*HeaderSegment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.trailers
+}
+
 // Respond ...
 func (c *contextSt) Respond(body io.Reader, headers ...*HeaderSegment) (err error) {
 	err = c.respond(0, body, headers...)
@@ -45,16 +103,21 @@ func (c *contextSt) ThrowError(code int, message string, headers ...*HeaderSegme
 // respond ...
 func (c *contextSt) respond(code int, body io.Reader, headers ...*HeaderSegment) (err error) {
 	res := NewReponse(code, body, headers...)
-	reader, err := MarshalResponse(res)
+	reader, err := marshalResponse(res, c.responseTrailers)
 	if err != nil {
 		return
 	}
 
+	defer c.cancel()
+
 	_, err = io.Copy(c.stream, reader)
 	if err != nil {
 		return
 	}
 	err = c.stream.Close()
+
+	// the rest of the request body is not read anymore.
+	_ = c.stream.CloseRead()
 	return
 }
 
@@ -68,7 +131,23 @@ func NewContext(stream NodeStream, peerId PeerId) (ctx Context, err error) {
 		ctxSt.Request = req
 		ctxSt.stream = stream
 		ctxSt.peerId = peerId
+		ctxSt.ctx, ctxSt.cancel = newStreamContext(stream, req)
 		ctx = ctxSt
 	}
 	return
 }
+
+// newStreamContext ...
+func newStreamContext(stream NodeStream, req *Request) (context.Context, context.CancelFunc) {
+	parent := context.Background()
+	streamCtx, ok := stream.(NodeStreamContext)
+	if ok {
+		parent = streamCtx.Context()
+	}
+
+	deadline, ok := req.Deadline()
+	if ok {
+		return context.WithDeadline(parent, deadline)
+	}
+	return context.WithCancel(parent)
+}
@@ -2,10 +2,12 @@ package peer_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"io"
 	mrand "math/rand"
 	"testing"
+	"time"
 
 	"pan/peer"
 
@@ -152,4 +154,132 @@ func TestContext(t *testing.T) {
 
 	})
 
+	t.Run("Context with deadline", func(t *testing.T) {
+
+		deadline := time.Now().Add(time.Millisecond * 50)
+		req := peer.NewRequest([]byte("method"), nil)
+		req.SetDeadline(deadline)
+		reader, err := peer.MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream := new(TestNodeStream)
+		stream.Reader = reader
+
+		ctx, err := peer.NewContext(stream, peer.PeerId(uuid.New()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctxDeadline, ok := ctx.Deadline()
+		assert.True(t, ok, "Deadline should be set")
+		assert.WithinDuration(t, deadline, ctxDeadline, 10*time.Millisecond, "Deadline should be near")
+		assert.Nil(t, ctx.Err(), "Error should be nil before deadline")
+
+		<-ctx.Done()
+		assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded, "Error should be deadline exceeded")
+
+	})
+
+	t.Run("Context with stream cancellation", func(t *testing.T) {
+
+		req := peer.NewRequest([]byte("method"), nil)
+		reader, err := peer.MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		streamCtx, streamCancel := context.WithCancel(context.Background())
+		stream := new(TestContextNodeStream)
+		stream.Reader = reader
+		stream.ctx = streamCtx
+
+		ctx, err := peer.NewContext(stream, peer.PeerId(uuid.New()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, ok := ctx.Deadline()
+		assert.False(t, ok, "Deadline should not be set")
+		assert.Nil(t, ctx.Err(), "Error should be nil before cancellation")
+
+		streamCancel()
+		<-ctx.Done()
+		assert.ErrorIs(t, ctx.Err(), context.Canceled, "Error should be canceled")
+
+	})
+
+	t.Run("Respond with trailers", func(t *testing.T) {
+
+		req := peer.NewRequest([]byte("method"), bytes.NewReader([]byte("request")))
+		trailer := peer.NewHeaderSegment([]byte("Checksum"), []byte("abc"))
+		req.SetTrailers(trailer)
+		reader, err := peer.MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseReader, writer := io.Pipe()
+		stream := new(TestNodeStream)
+		stream.Reader = reader
+		stream.Writer = writer
+		stream.Closer = writer
+
+		ctx, err := peer.NewContext(stream, peer.PeerId(uuid.New()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody, err := io.ReadAll(ctx.Body())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the trailer is set while the response body is streamed.
+		body := bytes.NewReader([]byte("response"))
+		resBody := readerFunc(func(p []byte) (int, error) {
+			n, err := body.Read(p)
+			if err == io.EOF {
+				ctx.SetTrailers(trailer)
+			}
+			return n, err
+		})
+		go func() {
+			_ = ctx.Respond(resBody)
+		}()
+
+		res := new(peer.Response)
+		err = peer.UnmarshalResponse(responseReader, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resBodyBytes, err := io.ReadAll(res.Body())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []byte("request"), reqBody, "Request body should be same")
+		assert.Equal(t, trailer.Value(), ctx.Trailer([]byte("Checksum")), "Request trailer should be same")
+		assert.Equal(t, []byte("response"), resBodyBytes, "Response body should be same")
+		assert.Equal(t, trailer.Value(), res.Trailer([]byte("Checksum")), "Response trailer should be same")
+
+	})
+
+}
+
+type readerFunc func(p []byte) (int, error)
+
+// Read ...
+func (fn readerFunc) Read(p []byte) (int, error) {
+	return fn(p)
+}
+
+type TestContextNodeStream struct {
+	TestNodeStream
+	ctx context.Context
+}
+
+// Context ...
+func (ns *TestContextNodeStream) Context() context.Context {
+	return ns.ctx
 }
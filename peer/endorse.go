@@ -0,0 +1,367 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"pan/core"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxEndorsementDepth limits how many rotations are followed back to the
+// first key of a peer.
+const MaxEndorsementDepth = 16
+
+const endorsementHash = crypto.SHA256
+
+var ErrInvalidEndorsement = errors.New("Invalid Endorsement")
+
+// Endorser accepts the endorsement of a rotated key.
+type Endorser interface {
+	Endorse(endorsement *Endorsement) error
+}
+
+// NewEndorsement signs the public key of newCert with the pem key of
+// oldCert, so the new key keeps the PeerId of the old one. The pem key of
+// newCert countersigns it, so nobody can endorse a key it does not hold.
+func NewEndorsement(oldKey, oldCert, newKey, newCert []byte) (endorsement *Endorsement, err error) {
+
+	oldPubKey, err := extractPublicKeyWithPem(oldCert)
+	if err != nil {
+		return
+	}
+	newPubKey, err := extractPublicKeyWithPem(newCert)
+	if err != nil {
+		return
+	}
+
+	endorsement = new(Endorsement)
+	endorsement.OldPublicKey = oldPubKey
+	endorsement.NewPublicKey = newPubKey
+	endorsement.Time = time.Now().Unix()
+	data := endorsementSignData(endorsement)
+	endorsement.Signature, err = core.SignWithPrivateKey(oldKey, data, endorsementHash)
+	if err == nil {
+		endorsement.Countersignature, err = core.SignWithPrivateKey(newKey, data, endorsementHash)
+	}
+	if err != nil {
+		endorsement = nil
+	}
+	return
+}
+
+// VerifyEndorsement checks that the old key signed the new key, and the new
+// key countersigned it.
+func VerifyEndorsement(endorsement *Endorsement) (err error) {
+
+	if len(endorsement.OldPublicKey) == 0 || len(endorsement.NewPublicKey) == 0 {
+		err = ErrInvalidEndorsement
+		return
+	}
+	if bytes.Equal(endorsement.OldPublicKey, endorsement.NewPublicKey) {
+		err = ErrInvalidEndorsement
+		return
+	}
+
+	data := endorsementSignData(endorsement)
+	err = core.VerifyWithPublicKey(endorsement.OldPublicKey, data, endorsement.Signature, endorsementHash)
+	if err == nil {
+		err = core.VerifyWithPublicKey(endorsement.NewPublicKey, data, endorsement.Countersignature, endorsementHash)
+	}
+	if err != nil {
+		err = errors.Join(ErrInvalidEndorsement, err)
+	}
+	return
+}
+
+// endorsementSignData ...
+func endorsementSignData(endorsement *Endorsement) []byte {
+	data := []byte("Endorsement")
+	data = binary.BigEndian.AppendUint16(data, uint16(len(endorsement.OldPublicKey)))
+	data = append(data, endorsement.OldPublicKey...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(endorsement.NewPublicKey)))
+	data = append(data, endorsement.NewPublicKey...)
+	data = binary.BigEndian.AppendUint64(data, uint64(endorsement.Time))
+	return data
+}
+
+// extractPublicKeyWithPem ...
+func extractPublicKeyWithPem(cert []byte) (pubKey []byte, err error) {
+	x509Cert, err := core.ParseCertWithPem(cert)
+	if err == nil {
+		pubKey, err = core.ExtractPublicKeyFromCert(x509Cert)
+	}
+	return
+}
+
+// EndorsementStore keeps the endorsements, so that rotated keys keep their
+// PeerId after restart.
+type EndorsementStore interface {
+	Init() error
+	FindEndorsements() ([]*Endorsement, error)
+	SaveEndorsement(endorsement *Endorsement) error
+}
+
+type endorsementStore struct {
+	store        EndorsementStore
+	endorsements map[string][]byte
+	rw           *sync.RWMutex
+}
+
+// Init loads the stored endorsements.
+func (es *endorsementStore) Init() (err error) {
+
+	err = es.store.Init()
+	if err != nil {
+		return
+	}
+
+	endorsements, err := es.store.FindEndorsements()
+	if err != nil {
+		return
+	}
+
+	es.rw.Lock()
+	for _, endorsement := range endorsements {
+		if VerifyEndorsement(endorsement) == nil && es.check(endorsement) == nil {
+			es.endorsements[string(endorsement.NewPublicKey)] = endorsement.OldPublicKey
+		}
+	}
+	es.rw.Unlock()
+	return
+}
+
+// Endorse verifies and stores the endorsement, a key is endorsed by one old
+// key only.
+func (es *endorsementStore) Endorse(endorsement *Endorsement) (err error) {
+
+	err = VerifyEndorsement(endorsement)
+	if err != nil {
+		return
+	}
+
+	es.rw.Lock()
+	defer es.rw.Unlock()
+
+	oldPubKey, ok := es.endorsements[string(endorsement.NewPublicKey)]
+	if ok && bytes.Equal(oldPubKey, endorsement.OldPublicKey) {
+		return
+	}
+	err = es.check(endorsement)
+	if err != nil {
+		return
+	}
+
+	err = es.store.SaveEndorsement(endorsement)
+	if err != nil {
+		return
+	}
+	es.endorsements[string(endorsement.NewPublicKey)] = endorsement.OldPublicKey
+	return
+}
+
+// check rejects the endorsement of a key which is endorsed by another key
+// already, or which is an older key of the same chain.
+func (es *endorsementStore) check(endorsement *Endorsement) error {
+	if _, ok := es.endorsements[string(endorsement.NewPublicKey)]; ok {
+		return errors.Join(ErrInvalidEndorsement, errors.New("Conflict Endorsement"))
+	}
+	rootKey := es.resolve(endorsement.OldPublicKey)
+	if bytes.Equal(rootKey, endorsement.NewPublicKey) {
+		return ErrInvalidEndorsement
+	}
+	return nil
+}
+
+// isEndorsed reports if the key is a key of an endorsement.
+func (es *endorsementStore) isEndorsed(pubKey []byte) bool {
+	es.rw.RLock()
+	defer es.rw.RUnlock()
+
+	if _, ok := es.endorsements[string(pubKey)]; ok {
+		return true
+	}
+	for _, oldPubKey := range es.endorsements {
+		if bytes.Equal(oldPubKey, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the first key the public key was rotated from.
+func (es *endorsementStore) Resolve(pubKey []byte) []byte {
+	es.rw.RLock()
+	defer es.rw.RUnlock()
+	return es.resolve(pubKey)
+}
+
+// resolve ...
+func (es *endorsementStore) resolve(pubKey []byte) []byte {
+	for i := 0; i < MaxEndorsementDepth; i++ {
+		oldPubKey, ok := es.endorsements[string(pubKey)]
+		if ok == false {
+			break
+		}
+		pubKey = oldPubKey
+	}
+	return pubKey
+}
+
+// newEndorsementStore ...
+func newEndorsementStore(store EndorsementStore) *endorsementStore {
+	es := new(endorsementStore)
+	es.store = store
+	es.endorsements = make(map[string][]byte)
+	es.rw = new(sync.RWMutex)
+	return es
+}
+
+type memoryEndorsementStore struct {
+	endorsements []*Endorsement
+	mu           *sync.Mutex
+}
+
+// Init ...
+func (s *memoryEndorsementStore) Init() error {
+	return nil
+}
+
+// FindEndorsements ...
+func (s *memoryEndorsementStore) FindEndorsements() (endorsements []*Endorsement, err error) {
+	s.mu.Lock()
+	endorsements = make([]*Endorsement, len(s.endorsements))
+	copy(endorsements, s.endorsements)
+	s.mu.Unlock()
+	return
+}
+
+// SaveEndorsement ...
+func (s *memoryEndorsementStore) SaveEndorsement(endorsement *Endorsement) (err error) {
+	s.mu.Lock()
+	s.endorsements = append(s.endorsements, endorsement)
+	s.mu.Unlock()
+	return
+}
+
+// NewMemoryEndorsementStore ...
+func NewMemoryEndorsementStore() EndorsementStore {
+	store := new(memoryEndorsementStore)
+	store.endorsements = make([]*Endorsement, 0)
+	store.mu = new(sync.Mutex)
+	return store
+}
+
+// EndorsementRecord is the database row of an endorsement.
+type EndorsementRecord struct {
+	ID               int64  `gorm:"primary_key;auto_increment"`
+	NewPublicKey     []byte `gorm:"uniqueIndex:idx_endorsement"`
+	OldPublicKey     []byte
+	Time             int64
+	Signature        []byte
+	Countersignature []byte
+}
+
+type gormEndorsementStore struct {
+	db *gorm.DB
+}
+
+// Init ...
+func (s *gormEndorsementStore) Init() (err error) {
+	err = s.db.AutoMigrate(&EndorsementRecord{})
+	return
+}
+
+// FindEndorsements ...
+func (s *gormEndorsementStore) FindEndorsements() (endorsements []*Endorsement, err error) {
+	records := make([]*EndorsementRecord, 0)
+	result := s.db.Find(&records)
+	err = result.Error
+	if err != nil {
+		return
+	}
+
+	endorsements = make([]*Endorsement, 0, len(records))
+	for _, record := range records {
+		endorsement := new(Endorsement)
+		endorsement.OldPublicKey = record.OldPublicKey
+		endorsement.NewPublicKey = record.NewPublicKey
+		endorsement.Time = record.Time
+		endorsement.Signature = record.Signature
+		endorsement.Countersignature = record.Countersignature
+		endorsements = append(endorsements, endorsement)
+	}
+	return
+}
+
+// SaveEndorsement ...
+func (s *gormEndorsementStore) SaveEndorsement(endorsement *Endorsement) (err error) {
+	record := new(EndorsementRecord)
+	record.NewPublicKey = endorsement.NewPublicKey
+	record.OldPublicKey = endorsement.OldPublicKey
+	record.Time = endorsement.Time
+	record.Signature = endorsement.Signature
+	record.Countersignature = endorsement.Countersignature
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	err = result.Error
+	return
+}
+
+// NewGormEndorsementStore ...
+func NewGormEndorsementStore(db *gorm.DB) EndorsementStore {
+	store := new(gormEndorsementStore)
+	store.db = db
+	return store
+}
+
+// NewEndorseHandle accepts endorsements spread by connected peers.
+func NewEndorseHandle(endorser Endorser) RPCHandle[Endorsement, emptypb.Empty] {
+	return func(ctx Context, req *Endorsement) (res *emptypb.Empty, err error) {
+		err = endorser.Endorse(req)
+		if errors.Is(err, ErrInvalidEndorsement) {
+			err = NewReponseError(BadRequestErrorCode, "Invalid Endorsement")
+		}
+		return
+	}
+}
+
+// HandleEndorse registers the Endorse method on app.
+func HandleEndorse(app core.App[Context], endorser Endorser) {
+	HandleRPC(app, []byte("Endorse"), NewEndorseHandle(endorser))
+}
+
+// Endorse spreads the endorsement to all connected peers.
+func (p *peerSt) Endorse(ctx context.Context, endorsement *Endorsement) (err error) {
+
+	body, err := proto.Marshal(endorsement)
+	if err != nil {
+		return
+	}
+
+	items := p.bucket.Items()
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		if item.Expired() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, node Node) {
+			defer wg.Done()
+			_, errs[i] = callNode[emptypb.Empty](ctx, p, node, []byte("Endorse"), body)
+		}(i, item.Value())
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	return
+}
@@ -0,0 +1,358 @@
+package peer_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"pan/core"
+	"pan/peer"
+	"testing"
+	"time"
+
+	coreMocked "pan/mocks/pan/core"
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newEndorseNode ...
+func newEndorseNode(t *testing.T, cert []byte) *mocked.MockNode {
+	x509Cert, err := core.ParseCertWithPem(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := new(mocked.MockNode)
+	node.On("Certificate").Return(x509Cert)
+	node.On("Addr").Maybe().Return([]byte("127.0.0.1:9000"))
+	return node
+}
+
+// newEndorseStream answers the Endorse request with an empty message.
+func newEndorseStream(bodies chan<- []byte) *TestNodeStream {
+	return newTestStream(func(req *peer.Request) (res *peer.Response, err error) {
+		body, _ := io.ReadAll(req.Body())
+		bodies <- body
+		header := peer.NewHeaderSegment([]byte("Content-Type"), []byte(peer.ProtobufContentType))
+		res = peer.NewReponse(0, bytes.NewReader(nil), header)
+		return
+	})
+}
+
+// TestEndorse ...
+func TestEndorse(t *testing.T) {
+
+	t.Run("NewEndorsement", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+
+		endorsement, err := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Nil(t, peer.VerifyEndorsement(endorsement), "Endorsement should be verified")
+
+		endorsement.Time++
+		assert.ErrorIs(t, peer.VerifyEndorsement(endorsement), peer.ErrInvalidEndorsement, "Changed endorsement should be invalid")
+	})
+
+	t.Run("NewEndorsement with other key", func(t *testing.T) {
+
+		_, oldCert, _, _ := newTestKeyAndCert(t)
+		otherKey, _, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+
+		endorsement, err := peer.NewEndorsement(otherKey, oldCert, newKey, newCert)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.ErrorIs(t, peer.VerifyEndorsement(endorsement), peer.ErrInvalidEndorsement, "Endorsement should be invalid")
+	})
+
+	t.Run("Generate with rotated key", func(t *testing.T) {
+
+		baseId := uuid.New()
+		firstKey, firstCert, _, _ := newTestKeyAndCert(t)
+		secondKey, secondCert, _, _ := newTestKeyAndCert(t)
+		thirdKey, thirdCert, _, _ := newTestKeyAndCert(t)
+
+		generator := peer.NewPeerIdGenerator(false)
+		peerId, err := generator.Generate(baseId[:], newEndorseNode(t, firstCert))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		endorsement, _ := peer.NewEndorsement(firstKey, firstCert, secondKey, secondCert)
+		err = generator.Endorse(endorsement)
+		assert.Nil(t, err, "Error should be nil")
+
+		endorsement, _ = peer.NewEndorsement(secondKey, secondCert, thirdKey, thirdCert)
+		err = generator.Endorse(endorsement)
+		assert.Nil(t, err, "Error should be nil")
+
+		secondPeerId, err := generator.Generate(baseId[:], newEndorseNode(t, secondCert))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peerId, secondPeerId, "PeerId of second key should be same")
+
+		thirdPeerId, err := generator.Generate(baseId[:], newEndorseNode(t, thirdCert))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peerId, thirdPeerId, "PeerId of third key should be same")
+	})
+
+	t.Run("Endorse with cycle", func(t *testing.T) {
+
+		firstKey, firstCert, _, _ := newTestKeyAndCert(t)
+		secondKey, secondCert, _, _ := newTestKeyAndCert(t)
+
+		generator := peer.NewPeerIdGenerator(false)
+		endorsement, _ := peer.NewEndorsement(firstKey, firstCert, secondKey, secondCert)
+		err := generator.Endorse(endorsement)
+		assert.Nil(t, err, "Error should be nil")
+
+		endorsement, _ = peer.NewEndorsement(secondKey, secondCert, firstKey, firstCert)
+		err = generator.Endorse(endorsement)
+		assert.ErrorIs(t, err, peer.ErrInvalidEndorsement, "Error should be invalid endorsement")
+	})
+
+	t.Run("NewEndorsement without countersignature", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		_, victimCert, _, _ := newTestKeyAndCert(t)
+		otherKey, _, _, _ := newTestKeyAndCert(t)
+
+		// the key of victimCert is not held, so it can not countersign.
+		endorsement, err := peer.NewEndorsement(oldKey, oldCert, otherKey, victimCert)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.ErrorIs(t, peer.VerifyEndorsement(endorsement), peer.ErrInvalidEndorsement, "Endorsement should be invalid")
+	})
+
+	t.Run("Endorse with conflict", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		otherKey, otherCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+
+		generator := peer.NewPeerIdGenerator(false)
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+		err := generator.Endorse(endorsement)
+		assert.Nil(t, err, "Error should be nil")
+
+		err = generator.Endorse(endorsement)
+		assert.Nil(t, err, "Same endorsement should be accepted again")
+
+		other, _ := peer.NewEndorsement(otherKey, otherCert, newKey, newCert)
+		err = generator.Endorse(other)
+		assert.ErrorIs(t, err, peer.ErrInvalidEndorsement, "Error should be invalid endorsement")
+		assert.Equal(t, endorsement.OldPublicKey, generator.Resolve(endorsement.NewPublicKey), "New key should resolve to first old key")
+	})
+
+	t.Run("Init", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+
+		store := peer.NewMemoryEndorsementStore()
+		generator := peer.NewPeerIdGenerator(false, peer.NewPeerIdGeneratorWithEndorsementStore(store))
+		err := generator.Endorse(endorsement)
+		assert.Nil(t, err, "Error should be nil")
+
+		restarted := peer.NewPeerIdGenerator(false, peer.NewPeerIdGeneratorWithEndorsementStore(store))
+		err = restarted.Init()
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, endorsement.OldPublicKey, restarted.Resolve(endorsement.NewPublicKey), "Stored endorsement should be loaded")
+	})
+
+	t.Run("HandleEndorse", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+		body, _ := proto.Marshal(endorsement)
+
+		ctx := new(mocked.MockContext)
+		ctx.On("Method").Return([]byte("Endorse"))
+		ctx.On("Header", []byte("Content-Type")).Once().Return([]byte(peer.ProtobufContentType))
+		ctx.On("Body").Once().Return(bytes.NewReader(body))
+		ctx.On("Respond", mock.Anything, mock.Anything).Once().Return(nil)
+
+		generator := peer.NewPeerIdGenerator(false)
+		app := core.New[peer.Context]()
+		peer.HandleEndorse(app, generator)
+		err := app.Run(ctx)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, endorsement.OldPublicKey, generator.Resolve(endorsement.NewPublicKey), "New key should resolve to old key")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("HandleEndorse with invalid endorsement", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+		endorsement.Signature = []byte("forged")
+		body, _ := proto.Marshal(endorsement)
+
+		ctx := new(mocked.MockContext)
+		ctx.On("Method").Return([]byte("Endorse"))
+		ctx.On("Header", []byte("Content-Type")).Once().Return([]byte(peer.ProtobufContentType))
+		ctx.On("Body").Once().Return(bytes.NewReader(body))
+
+		generator := peer.NewPeerIdGenerator(false)
+		app := core.New[peer.Context]()
+		peer.HandleEndorse(app, generator)
+		err := app.Run(ctx)
+
+		var resErr *peer.ResponseError
+		assert.ErrorAs(t, err, &resErr, "Error should be response error")
+		assert.Equal(t, peer.BadRequestErrorCode, resErr.Code(), "Error code should be bad request")
+		assert.Equal(t, endorsement.NewPublicKey, generator.Resolve(endorsement.NewPublicKey), "New key should not be endorsed")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("Endorse connected peers", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+
+		closed := make(chan struct{})
+		defer close(closed)
+		bodies := make(chan []byte, 1)
+		node := new(mocked.MockNode)
+		node.On("AcceptNodeStream", mock.Anything).Once().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-closed
+		})
+		node.On("OpenNodeStream").Once().Return(newEndorseStream(bodies), nil)
+
+		peerId := peer.PeerId(uuid.New())
+		generator := new(mocked.MockPeerIdGenerator)
+		app := new(coreMocked.MockApp[peer.Context])
+		p := peer.New(uuid.New(), nil, app, generator, 0)
+		go p.Accept(context.Background(), node, peerId)
+
+		assert.Eventually(t, func() bool {
+			return p.Stat(peerId) == peer.OnlinePeerState
+		}, time.Second, time.Millisecond, "Peer should be online after accept")
+
+		err := p.Endorse(context.Background(), endorsement)
+
+		received := new(peer.Endorsement)
+		_ = proto.Unmarshal(<-bodies, received)
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, proto.Equal(endorsement, received), "Endorsement should be sent")
+		node.AssertExpectations(t)
+	})
+
+}
+
+// TestGormEndorsementStore ...
+func TestGormEndorsementStore(t *testing.T) {
+
+	t.Run("Init", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("CREATE TABLE `endorsement_records`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_endorsement`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.MatchExpectationsInOrder(false)
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormEndorsementStore(db)
+		err = store.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("SaveEndorsement", func(t *testing.T) {
+
+		oldKey, oldCert, _, _ := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("INSERT INTO `endorsement_records` (.+) ON CONFLICT DO NOTHING").
+			WithArgs(endorsement.NewPublicKey, endorsement.OldPublicKey, endorsement.Time, endorsement.Signature, endorsement.Countersignature).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormEndorsementStore(db)
+		err = store.SaveEndorsement(endorsement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("FindEndorsements", func(t *testing.T) {
+
+		oldPubKey := []byte("old")
+		newPubKey := []byte("new")
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `endorsement_records`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "new_public_key", "old_public_key", "time", "signature", "countersignature"}).
+				AddRow(int64(1), newPubKey, oldPubKey, time.Now().Unix(), []byte("signature"), []byte("countersignature")))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormEndorsementStore(db)
+		endorsements, err := store.FindEndorsements()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Len(t, endorsements, 1, "Endorsement should be found")
+		assert.Equal(t, newPubKey, endorsements[0].NewPublicKey, "New key should be same")
+		assert.Equal(t, []byte("countersignature"), endorsements[0].Countersignature, "Countersignature should be same")
+
+	})
+}
@@ -29,3 +29,31 @@ func NewReponseError(code int, message string) *ResponseError {
 	err.message = message
 	return err
 }
+
+// AuthenticateError is returned when the remote side fails to prove its
+// identity, as opposed to transport errors while talking to it.
+type AuthenticateError struct {
+	message string
+	err     error
+}
+
+// Error ...
+func (ae *AuthenticateError) Error() string {
+	if ae.err == nil {
+		return ae.message
+	}
+	return ae.message + ": " + ae.err.Error()
+}
+
+// Unwrap ...
+func (ae *AuthenticateError) Unwrap() error {
+	return ae.err
+}
+
+// NewAuthenticateError ...
+func NewAuthenticateError(message string, err error) *AuthenticateError {
+	ae := new(AuthenticateError)
+	ae.message = message
+	ae.err = err
+	return ae
+}
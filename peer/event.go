@@ -0,0 +1,179 @@
+package peer
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType uint8
+
+const (
+	// PeerDiscoveredEvent is published by discovery for an alive peer.
+	PeerDiscoveredEvent = EventType(iota)
+	// PeerAuthenticatedEvent is published when a node proves its PeerId.
+	PeerAuthenticatedEvent
+	// NodeConnectedEvent is published when a node joins the pool.
+	NodeConnectedEvent
+	// NodeClosedEvent is published when a node leaves the pool.
+	NodeClosedEvent
+	// PeerDeadEvent is published by discovery for a verified death.
+	PeerDeadEvent
+	// AuthFailedEvent is published when a node fails to authenticate.
+	AuthFailedEvent
+)
+
+// String ...
+func (t EventType) String() string {
+	switch t {
+	case PeerDiscoveredEvent:
+		return "PeerDiscovered"
+	case PeerAuthenticatedEvent:
+		return "PeerAuthenticated"
+	case NodeConnectedEvent:
+		return "NodeConnected"
+	case NodeClosedEvent:
+		return "NodeClosed"
+	case PeerDeadEvent:
+		return "PeerDead"
+	case AuthFailedEvent:
+		return "AuthFailed"
+	}
+	return "Unknown"
+}
+
+// Event is published to the EventBus. PeerId is zero when it is unknown,
+// e.g. a node which fails to authenticate, Node is nil for discovery events.
+type Event struct {
+	Type   EventType
+	PeerId PeerId
+	Node   Node
+	Addr   []byte
+	Err    error
+	Time   time.Time
+}
+
+// NewEvent ...
+func NewEvent(eventType EventType, peerId PeerId) *Event {
+	event := new(Event)
+	event.Type = eventType
+	event.PeerId = peerId
+	event.Time = time.Now()
+	return event
+}
+
+// newNodeEvent ...
+func newNodeEvent(eventType EventType, peerId PeerId, node Node, err error) *Event {
+	event := NewEvent(eventType, peerId)
+	event.Node = node
+	event.Addr = node.Addr()
+	event.Err = err
+	return event
+}
+
+// EventBus delivers events to subscribers.
+//
+// Publish never blocks. Every subscription has its own buffer, and an event
+// which does not fit into the buffer of a slow subscriber is dropped for that
+// subscriber only, it is counted by Subscription.Dropped. Events are
+// delivered to a subscription in the order they are published.
+type EventBus interface {
+	Publish(event *Event)
+	// Subscribe returns a subscription with a channel buffered to size, no
+	// types subscribes all of them.
+	Subscribe(size int, types ...EventType) *Subscription
+	// SubscribeFn calls fn for the events on a goroutine of the
+	// subscription, so a slow fn delays and drops its own events only.
+	SubscribeFn(size int, fn func(event *Event), types ...EventType) *Subscription
+}
+
+// Subscription ...
+type Subscription struct {
+	C       <-chan *Event
+	ch      chan *Event
+	types   []EventType
+	dropped *atomic.Uint64
+	bus     *eventBusSt
+}
+
+// Dropped is the number of events dropped as the buffer is full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes its channel.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// accepts ...
+func (s *Subscription) accepts(eventType EventType) bool {
+	return len(s.types) == 0 || slices.Contains(s.types, eventType)
+}
+
+type eventBusSt struct {
+	subscriptions []*Subscription
+	rw            *sync.RWMutex
+}
+
+// Publish ...
+func (b *eventBusSt) Publish(event *Event) {
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+	for _, s := range b.subscriptions {
+		if !s.accepts(event.Type) {
+			continue
+		}
+		select {
+		case s.ch <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe ...
+func (b *eventBusSt) Subscribe(size int, types ...EventType) *Subscription {
+	s := new(Subscription)
+	s.ch = make(chan *Event, size)
+	s.C = s.ch
+	s.types = types
+	s.dropped = new(atomic.Uint64)
+	s.bus = b
+
+	b.rw.Lock()
+	b.subscriptions = append(b.subscriptions, s)
+	b.rw.Unlock()
+	return s
+}
+
+// SubscribeFn ...
+func (b *eventBusSt) SubscribeFn(size int, fn func(event *Event), types ...EventType) *Subscription {
+	s := b.Subscribe(size, types...)
+	go func() {
+		for event := range s.C {
+			fn(event)
+		}
+	}()
+	return s
+}
+
+// unsubscribe ...
+func (b *eventBusSt) unsubscribe(s *Subscription) {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+	idx := slices.Index(b.subscriptions, s)
+	if idx < 0 {
+		return
+	}
+	b.subscriptions = slices.Delete(b.subscriptions, idx, idx+1)
+	close(s.ch)
+}
+
+// NewEventBus ...
+func NewEventBus() EventBus {
+	b := new(eventBusSt)
+	b.rw = new(sync.RWMutex)
+	return b
+}
@@ -0,0 +1,88 @@
+package peer_test
+
+import (
+	"pan/peer"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEventBus ...
+func TestEventBus(t *testing.T) {
+
+	t.Run("Subscribe", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		bus := peer.NewEventBus()
+		all := bus.Subscribe(2)
+		dead := bus.Subscribe(2, peer.PeerDeadEvent)
+
+		bus.Publish(peer.NewEvent(peer.PeerDiscoveredEvent, peerId))
+		bus.Publish(peer.NewEvent(peer.PeerDeadEvent, peerId))
+
+		assert.Equal(t, peer.PeerDiscoveredEvent, (<-all.C).Type, "First event should be discovered")
+		assert.Equal(t, peer.PeerDeadEvent, (<-all.C).Type, "Second event should be dead")
+
+		event := <-dead.C
+		assert.Equal(t, peer.PeerDeadEvent, event.Type, "Only dead event should be subscribed")
+		assert.Equal(t, peerId, event.PeerId, "PeerId should be same")
+		assert.Empty(t, dead.C, "Other events should not be delivered")
+	})
+
+	t.Run("Subscribe with slow consumer", func(t *testing.T) {
+
+		bus := peer.NewEventBus()
+		slow := bus.Subscribe(1)
+		fast := bus.Subscribe(3)
+
+		for i := 0; i < 3; i++ {
+			bus.Publish(peer.NewEvent(peer.NodeConnectedEvent, peer.PeerId(uuid.New())))
+		}
+
+		assert.Len(t, slow.C, 1, "Buffer of slow consumer should be full")
+		assert.Equal(t, uint64(2), slow.Dropped(), "Events should be dropped for slow consumer")
+		assert.Len(t, fast.C, 3, "Fast consumer should get all events")
+		assert.Zero(t, fast.Dropped(), "No event should be dropped for fast consumer")
+	})
+
+	t.Run("SubscribeFn", func(t *testing.T) {
+
+		bus := peer.NewEventBus()
+		events := make(chan *peer.Event, 1)
+		sub := bus.SubscribeFn(1, func(event *peer.Event) {
+			events <- event
+		}, peer.AuthFailedEvent)
+		defer sub.Close()
+
+		bus.Publish(peer.NewEvent(peer.NodeClosedEvent, peer.PeerId{}))
+		bus.Publish(peer.NewEvent(peer.AuthFailedEvent, peer.PeerId{}))
+
+		select {
+		case event := <-events:
+			assert.Equal(t, peer.AuthFailedEvent, event.Type, "Callback should get auth failed event")
+		case <-time.After(time.Second):
+			t.Fatal("Callback should be called")
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+
+		bus := peer.NewEventBus()
+		sub := bus.Subscribe(1)
+		sub.Close()
+		sub.Close()
+
+		bus.Publish(peer.NewEvent(peer.NodeClosedEvent, peer.PeerId{}))
+
+		_, ok := <-sub.C
+		assert.False(t, ok, "Channel should be closed")
+	})
+
+	t.Run("EventType String", func(t *testing.T) {
+		assert.Equal(t, "PeerAuthenticated", peer.PeerAuthenticatedEvent.String(), "Name should be same")
+		assert.Equal(t, "Unknown", peer.EventType(100).String(), "Name should be unknown")
+	})
+
+}
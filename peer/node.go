@@ -36,3 +36,9 @@ type NodeStream interface {
 	io.Writer
 	NodeStreamCloser
 }
+
+// NodeStreamContext is implemented by streams whose context is canceled
+// as soon as the write side is closed, including by the remote side.
+type NodeStreamContext interface {
+	Context() context.Context
+}
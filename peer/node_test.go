@@ -1,7 +1,11 @@
 package peer_test
 
 import (
+	"crypto/x509"
 	"io"
+	"pan/core"
+	"pan/peer"
+	"testing"
 )
 
 type TestCloseFn func() error
@@ -16,10 +20,65 @@ type TestNodeStream struct {
 
 // CloseRead ...
 func (ns *TestNodeStream) CloseRead() error {
+	if ns.CloseReadFn == nil {
+		return nil
+	}
 	return ns.CloseReadFn()
 }
 
 // CloseWrite ...
 func (ns *TestNodeStream) CloseWrite() error {
+	if ns.CloseWriteFn == nil {
+		return nil
+	}
 	return ns.CloseWriteFn()
 }
+
+// newTestStream answers the request written to the stream with the response
+// of handle, an error of handle closes the stream with it.
+func newTestStream(handle func(req *peer.Request) (*peer.Response, error)) *TestNodeStream {
+
+	reqReader, reqWriter := io.Pipe()
+	resReader, resWriter := io.Pipe()
+	stream := new(TestNodeStream)
+	stream.Reader = resReader
+	stream.Writer = reqWriter
+	stream.Closer = reqWriter
+
+	go func() {
+		req := new(peer.Request)
+		err := peer.UnmarshalRequest(reqReader, req)
+		if err != nil {
+			resWriter.CloseWithError(err)
+			return
+		}
+		res, err := handle(req)
+		if err != nil {
+			resWriter.CloseWithError(err)
+			return
+		}
+		reader, _ := peer.MarshalResponse(res)
+		_, err = io.Copy(resWriter, reader)
+		resWriter.CloseWithError(err)
+	}()
+
+	return stream
+}
+
+// newTestKeyAndCert generates a key with its pem and parsed certificate and
+// the public key of it.
+func newTestKeyAndCert(t *testing.T) (key []byte, cert []byte, x509Cert *x509.Certificate, pubKey []byte) {
+	key, cert, err := core.GenerateKeyAndCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x509Cert, err = core.ParseCertWithPem(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err = core.ExtractPublicKeyFromCert(x509Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
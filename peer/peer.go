@@ -2,6 +2,7 @@ package peer
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"encoding/binary"
 	"errors"
@@ -10,7 +11,9 @@ import (
 	"net"
 	"pan/core"
 	"pan/memory"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -32,6 +35,10 @@ const (
 	UnknownPeerState
 )
 
+// DefaultKnownKeyCapacity is the number of keys SimplePeerIdGenerator
+// remembers for self revocations.
+const DefaultKnownKeyCapacity = 4096
+
 type PeerId uuid.UUID
 
 type PeerState uint
@@ -71,22 +78,34 @@ type Peer interface {
 	Authenticate(node Node, mode uint8) (PeerId, error)
 	AcceptAuthenticate(ctx context.Context, node Node)
 	Open(id PeerId) (Node, error)
-	Request(node Node, body io.Reader, method []byte, headers ...*HeaderSegment) (*Response, error)
+	Disconnect(id PeerId) error
+	Request(ctx context.Context, node Node, body io.Reader, method []byte, headers ...*HeaderSegment) (*Response, error)
 	AcceptServe(ctx context.Context, serve NodeServe)
 	Accept(ctx context.Context, node Node, peerId PeerId)
+	Probe(ctx context.Context)
+	Endorse(ctx context.Context, endorsement *Endorsement) error
+	Revoke(ctx context.Context, revocation *Revocation) error
 }
 
 type PeerIdGenerator interface {
 	Generate(baseId []byte, node Node) (PeerId, error)
 }
 
-type PeerPassport struct {
-	IsPeerId bool
-}
-
 type SimplePeerIdGenerator struct {
-	*memory.Bucket[*PeerPassport, uuid.UUID]
+	AccessList
+	*endorsementStore
 	defaultDeny bool
+	revocations RevocationList
+	knownKeys   map[string]*list.Element
+	knownOrder  *list.List
+	knownCap    int
+	rw          *sync.RWMutex
+}
+
+// Init loads the stored endorsements, the access list is initialized by
+// its owner.
+func (pg *SimplePeerIdGenerator) Init() error {
+	return pg.endorsementStore.Init()
 }
 
 // Generate ...
@@ -102,66 +121,142 @@ func (pg *SimplePeerIdGenerator) Generate(baseId []byte, node Node) (peerId Peer
 		return
 	}
 
-	id := uuid.NewSHA1(space, pubKey)
+	// a rotated key keeps the PeerId of the first key it was endorsed by.
+	rootKey := pg.Resolve(pubKey)
+	id := uuid.NewSHA1(space, rootKey)
 
-	pass := !pg.defaultDeny
-	items := pg.FindBlockItems(id)
-	for _, item := range items {
-		if item.Expired() {
-			continue
-		}
-		passport := item.Value()
-		if passport.IsPeerId {
-			pass = pg.defaultDeny
-			break
+	// only the presented key is checked, a revoked old key does not lock out
+	// the keys it endorsed before.
+	if pg.revocations != nil {
+		if pg.revocations.IsRevoked(PeerId(id), pubKey) {
+			err = ErrRevoked
+			return
 		}
 	}
 
-	if pass == pg.defaultDeny {
-		peerId = PeerId(id)
-		return
+	req := new(AccessRequest)
+	req.PeerId = PeerId(id)
+	req.Namespace = space
+	req.Certificate = cert
+	req.Addr = node.Addr()
+	allow, matched := pg.Check(req)
+	if matched == false {
+		allow = !pg.defaultDeny
 	}
 
-	items = pg.FindBlockItems(space)
-	for _, item := range items {
-		if item.Expired() {
-			continue
-		}
-		passport := item.Value()
-		if !passport.IsPeerId {
-			pass = pg.defaultDeny
-			break
-		}
-	}
-
-	if !pass {
+	if !allow {
 		err = errors.New("Deny Peer Id")
 		return
 	}
 
+	pg.remember(pubKey)
+
 	peerId = PeerId(id)
 	return
 }
 
-// NewPeerIdGenerator ...
-func NewPeerIdGenerator(defaultDeny bool) *SimplePeerIdGenerator {
+// remember keeps the key as known, the least recently generated key is
+// forgotten when the capacity is reached.
+func (pg *SimplePeerIdGenerator) remember(pubKey []byte) {
+
+	key := string(pubKey)
 
-	bucket := memory.NewBucket[*PeerPassport, uuid.UUID](compareUUID)
+	pg.rw.Lock()
+	defer pg.rw.Unlock()
+
+	elem, ok := pg.knownKeys[key]
+	if ok {
+		pg.knownOrder.MoveToBack(elem)
+		return
+	}
+	for pg.knownOrder.Len() >= pg.knownCap {
+		oldest := pg.knownOrder.Front()
+		pg.knownOrder.Remove(oldest)
+		delete(pg.knownKeys, oldest.Value.(string))
+	}
+	pg.knownKeys[key] = pg.knownOrder.PushBack(key)
+}
+
+// IsKnownKey reports if the key is endorsed or is mapped to a PeerId. The
+// mapped keys are kept in memory only and bounded by the capacity, after a
+// restart a key is known again once it is generated, until then a self
+// revocation of it is rejected and has to be spread again on connect. The
+// endorsed keys are kept by the endorsement store.
+func (pg *SimplePeerIdGenerator) IsKnownKey(pubKey []byte) bool {
+	pg.rw.RLock()
+	_, known := pg.knownKeys[string(pubKey)]
+	pg.rw.RUnlock()
+	return known || pg.isEndorsed(pubKey)
+}
+
+type newPeerIdGeneratorConfig struct {
+	revocations  RevocationList
+	acl          AccessList
+	endorsements EndorsementStore
+	knownCap     int
+}
+
+type NewPeerIdGeneratorWithFn func(cfg *newPeerIdGeneratorConfig)
+
+// NewPeerIdGeneratorWithRevocationList denies the revoked PeerIds and keys.
+func NewPeerIdGeneratorWithRevocationList(revocations RevocationList) NewPeerIdGeneratorWithFn {
+	return func(cfg *newPeerIdGeneratorConfig) {
+		cfg.revocations = revocations
+	}
+}
+
+// NewPeerIdGeneratorWithKnownKeyCapacity sets how many keys are remembered
+// for self revocations, a non-positive capacity is the default one.
+func NewPeerIdGeneratorWithKnownKeyCapacity(capacity int) NewPeerIdGeneratorWithFn {
+	return func(cfg *newPeerIdGeneratorConfig) {
+		cfg.knownCap = capacity
+	}
+}
+
+// NewPeerIdGeneratorWithAccessList replaces the in memory access list, the
+// list must be initialized already.
+func NewPeerIdGeneratorWithAccessList(acl AccessList) NewPeerIdGeneratorWithFn {
+	return func(cfg *newPeerIdGeneratorConfig) {
+		cfg.acl = acl
+	}
+}
+
+// NewPeerIdGeneratorWithEndorsementStore keeps the endorsements in the
+// store, they are loaded by Init.
+func NewPeerIdGeneratorWithEndorsementStore(store EndorsementStore) NewPeerIdGeneratorWithFn {
+	return func(cfg *newPeerIdGeneratorConfig) {
+		cfg.endorsements = store
+	}
+}
+
+// NewPeerIdGenerator allows or denies the peers matching no access rule
+// by defaultDeny.
+func NewPeerIdGenerator(defaultDeny bool, withFns ...NewPeerIdGeneratorWithFn) *SimplePeerIdGenerator {
+
+	cfg := new(newPeerIdGeneratorConfig)
+	cfg.acl = NewAccessList(NewMemoryAccessRuleStore())
+	cfg.endorsements = NewMemoryEndorsementStore()
+	cfg.knownCap = DefaultKnownKeyCapacity
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+	if cfg.knownCap <= 0 {
+		cfg.knownCap = DefaultKnownKeyCapacity
+	}
 
 	generator := new(SimplePeerIdGenerator)
-	generator.Bucket = bucket
+	generator.AccessList = cfg.acl
+	generator.endorsementStore = newEndorsementStore(cfg.endorsements)
 	generator.defaultDeny = defaultDeny
+	generator.revocations = cfg.revocations
+	generator.knownKeys = make(map[string]*list.Element)
+	generator.knownOrder = list.New()
+	generator.knownCap = cfg.knownCap
+	generator.rw = new(sync.RWMutex)
 
 	return generator
 }
 
-type peerRoute struct {
-	rw        *sync.RWMutex
-	NodeType  uint8
-	Addr      []byte
-	FailedNum uint8
-}
-
 type peerDialer struct {
 	dialerMap map[uint8]NodeDialer
 	rw        *sync.RWMutex
@@ -213,12 +308,28 @@ func (pd *peerDialer) Detach(dialer NodeDialer) {
 
 type peerSt struct {
 	*peerDialer
-	generator    PeerIdGenerator
-	router       *memory.Bucket[*peerRoute, PeerId]
-	bucket       *memory.Bucket[Node, PeerId]
-	baseId       uuid.UUID
-	app          core.App[Context]
-	maxFailedNum uint8
+	generator     PeerIdGenerator
+	routes        RouteStore
+	revocations   RevocationList
+	revocationsFn core.Handle[Context]
+	privateKey    []byte
+	keyErr        error
+	bucket        *memory.Bucket[Node, PeerId]
+	baseId        uuid.UUID
+	app           core.App[Context]
+	maxFailedNum  uint8
+	recover       core.Handle[Context]
+	opening       map[PeerId]*peerOpenCall
+	openMu        *sync.Mutex
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+	events        EventBus
+}
+
+type peerOpenCall struct {
+	wg   *sync.WaitGroup
+	node Node
+	err  error
 }
 
 // Stat ...
@@ -227,19 +338,34 @@ func (p *peerSt) Stat(id PeerId) PeerState {
 	if bucketItem != nil {
 		return OnlinePeerState
 	}
-	routeItem := p.router.FindBlockItem(id)
-	if routeItem != nil {
+	routes, err := p.routes.FindRoutes(id)
+	if err == nil && len(routes) > 0 {
 		return UnknownPeerState
 	}
 	return OfflinePeerState
 }
 
-// Authenticate ...
+// Authenticate runs the challenge-response handshake with the node.
+// Both sides sign the transcript of base ids and nonces, errors of the
+// handshake itself are *AuthenticateError.
 func (p *peerSt) Authenticate(node Node, mode uint8) (peerId PeerId, err error) {
 
+	defer func() {
+		var authErr *AuthenticateError
+		if errors.As(err, &authErr) {
+			p.publishNode(AuthFailedEvent, PeerId{}, node, err)
+		}
+	}()
+
+	nonce, err := newAuthenticateNonce()
+	if err != nil {
+		return
+	}
+
 	body := bytes.NewReader(p.baseId[:])
-	header := NewHeaderSegment([]byte("Mode"), []byte{mode})
-	res, err := p.Request(node, body, []byte("Authenticate"), header)
+	modeHeader := NewHeaderSegment([]byte("Mode"), []byte{mode})
+	nonceHeader := NewHeaderSegment([]byte("Nonce"), nonce)
+	res, err := p.Request(context.Background(), node, body, []byte("Authenticate"), modeHeader, nonceHeader)
 	if err != nil {
 		return
 	}
@@ -250,56 +376,103 @@ func (p *peerSt) Authenticate(node Node, mode uint8) (peerId PeerId, err error)
 	}
 
 	if res.IsError() {
-		err = NewReponseError(res.Code(), string(resBody))
+		err = NewAuthenticateError("Rejected", NewReponseError(res.Code(), string(resBody)))
+		return
+	}
+
+	resNonce := res.Header([]byte("Nonce"))
+	if len(resNonce) != AuthenticateNonceSize {
+		err = NewAuthenticateError("Invalid Nonce", nil)
+		return
+	}
+
+	transcript := authenticateTranscript(responderRole, p.baseId[:], nonce, resBody, resNonce)
+	err = verifyTranscript(node, transcript, res.Header([]byte("Signature")))
+	if err != nil {
 		return
 	}
 
 	peerId, err = p.generator.Generate(resBody, node)
+	if err == nil && p.isRevoked(peerId, node) {
+		err = ErrRevoked
+	}
 	if err != nil {
+		err = NewAuthenticateError("Deny Peer", err)
 		return
 	}
 
-	if mode != TestOnlyAuthenticateMode {
-		go p.Accept(context.Background(), node, peerId)
+	transcript = authenticateTranscript(initiatorRole, p.baseId[:], nonce, resBody, resNonce)
+	sig, err := p.signTranscript(transcript)
+	if err != nil {
+		return
+	}
+
+	sigHeader := NewHeaderSegment([]byte("Signature"), sig)
+	res, err = p.Request(context.Background(), node, nil, []byte("Verify"), sigHeader)
+	if err != nil {
+		return
 	}
 
-	if mode == OpenAuthenticateMode {
+	if res.IsError() {
+		resBody, err = io.ReadAll(res.Body())
+		if err == nil {
+			err = NewAuthenticateError("Rejected", NewReponseError(res.Code(), string(resBody)))
+		}
 		return
 	}
 
-	route := new(peerRoute)
-	route.Addr = node.Addr()
-	route.NodeType = node.Type()
-	route.FailedNum = 0
-	route.rw = new(sync.RWMutex)
-	items := p.router.FindBlockItems(peerId)
+	if mode != OpenAuthenticateMode {
+		err = p.saveRoute(peerId, node)
+		if err != nil {
+			return
+		}
+	}
 
-	notFound := true
-	if items != nil && len(items) > 0 {
+	p.publishNode(PeerAuthenticatedEvent, peerId, node, nil)
 
-		for _, item := range items {
-			if item.Expired() {
-				continue
-			}
-			r := item.Value()
-			if bytes.Equal(r.Addr, route.Addr) && r.NodeType == route.NodeType {
-				r.rw.Lock()
-				r.FailedNum = 0
-				r.rw.Unlock()
-				notFound = false
-			}
+	if mode != TestOnlyAuthenticateMode {
+		item := p.bucket.PutItem(peerId, node)
+		go p.serve(context.Background(), node, peerId, item)
+		if p.revocations != nil {
+			go p.exchangeRevocations(context.Background(), node)
 		}
-	} else {
-		notFound = false
 	}
-	if notFound {
-		p.router.PutItem(peerId, route)
+
+	return
+}
+
+// saveRoute ...
+func (p *peerSt) saveRoute(peerId PeerId, node Node) (err error) {
+
+	routes, err := p.routes.FindRoutes(peerId)
+	if err != nil {
+		return
+	}
+
+	addr := node.Addr()
+	nodeType := node.Type()
+	var route *Route
+	for _, r := range routes {
+		if r.Equal(nodeType, addr) {
+			route = r
+			break
+		}
+	}
+	if route == nil {
+		route = new(Route)
+		route.PeerId = peerId
+		route.NodeType = nodeType
+		route.Addr = addr
 	}
 
+	route.FailedNum = 0
+	route.SucceededAt = time.Now().Unix()
+	err = p.routes.SaveRoute(route)
 	return
 }
 
-// AcceptAuthenticate ...
+// AcceptAuthenticate answers the challenge of the node and then waits
+// for the node to prove its own identity.
 func (p *peerSt) AcceptAuthenticate(ctx context.Context, node Node) {
 
 	goto AcceptAuthenticate
@@ -336,22 +509,75 @@ AcceptAuthenticate:
 		goto NextAcceptAuthenticate
 	}
 
-	peerId, err := p.generator.Generate(body, node)
+	reqNonce := authCtx.Header([]byte("Nonce"))
+	if len(reqNonce) != AuthenticateNonceSize {
+		_ = authCtx.ThrowError(BadRequestErrorCode, "Bad Request")
+		goto NextAcceptAuthenticate
+	}
 
+	peerId, err := p.generator.Generate(body, node)
+	if err == nil && p.isRevoked(peerId, node) {
+		err = ErrRevoked
+	}
 	if err != nil {
+		p.publishNode(AuthFailedEvent, PeerId{}, node, err)
 		_ = authCtx.ThrowError(ForbiddenErrorCode, "Forbidden")
 		goto NextAcceptAuthenticate
 	}
 
-	_ = authCtx.Respond(bytes.NewReader(p.baseId[:]))
+	nonce, err := newAuthenticateNonce()
+	if err != nil {
+		_ = authCtx.ThrowError(InternalErrorCode, "Internal Error")
+		goto NextAcceptAuthenticate
+	}
+
+	sig, err := p.signTranscript(authenticateTranscript(responderRole, body, reqNonce, p.baseId[:], nonce))
+	if err != nil {
+		_ = authCtx.ThrowError(InternalErrorCode, "Internal Error")
+		goto NextAcceptAuthenticate
+	}
+
+	nonceHeader := NewHeaderSegment([]byte("Nonce"), nonce)
+	sigHeader := NewHeaderSegment([]byte("Signature"), sig)
+	err = authCtx.Respond(bytes.NewReader(p.baseId[:]), nonceHeader, sigHeader)
+	if err != nil {
+		goto NextAcceptAuthenticate
+	}
+
+	stream, err = node.AcceptNodeStream(ctx)
+	if err != nil {
+		if errors.Is(err, net.ErrClosed) == false {
+			node.Close()
+		}
+		return
+	}
+
+	verifyCtx, err := NewContext(stream, PeerId(p.baseId))
+	if err != nil {
+		_ = verifyCtx.ThrowError(BadRequestErrorCode, "Bad Request")
+		goto NextAcceptAuthenticate
+	}
+	if bytes.Equal([]byte("Verify"), verifyCtx.Method()) == false {
+		_ = verifyCtx.ThrowError(UnauthorizedErrorCode, "Unauthorized")
+		goto NextAcceptAuthenticate
+	}
+
+	transcript := authenticateTranscript(initiatorRole, body, reqNonce, p.baseId[:], nonce)
+	err = verifyTranscript(node, transcript, verifyCtx.Header([]byte("Signature")))
+	if err != nil {
+		p.publishNode(AuthFailedEvent, peerId, node, err)
+		_ = verifyCtx.ThrowError(UnauthorizedErrorCode, "Unauthorized")
+		goto NextAcceptAuthenticate
+	}
+
+	_ = verifyCtx.Respond(nil)
+	p.publishNode(PeerAuthenticatedEvent, peerId, node, nil)
 
 	value := authCtx.Header([]byte("Mode"))
 	if value != nil && value[0] != TestOnlyAuthenticateMode {
 		p.Accept(ctx, node, peerId)
 	}
 
-	// TODO: try salute
-
 }
 
 // Open ...
@@ -363,39 +589,87 @@ func (p *peerSt) Open(peerId PeerId) (node Node, err error) {
 		return
 	}
 
-	ritems := p.router.FindBlockItems(peerId)
-	if ritems == nil || len(ritems) <= 0 {
+	// concurrent calls for the same peer share one dial.
+	p.openMu.Lock()
+	call, ok := p.opening[peerId]
+	if ok {
+		p.openMu.Unlock()
+		call.wg.Wait()
+		return call.node, call.err
+	}
+	call = new(peerOpenCall)
+	call.wg = new(sync.WaitGroup)
+	call.wg.Add(1)
+	p.opening[peerId] = call
+	p.openMu.Unlock()
+
+	call.node, call.err = p.open(peerId)
+
+	p.openMu.Lock()
+	delete(p.opening, peerId)
+	p.openMu.Unlock()
+	call.wg.Done()
+
+	return call.node, call.err
+}
+
+// publishNode publishes the event of the node, if there is an event bus.
+func (p *peerSt) publishNode(eventType EventType, peerId PeerId, node Node, err error) {
+	if p.events != nil {
+		p.events.Publish(newNodeEvent(eventType, peerId, node, err))
+	}
+}
+
+// Disconnect closes the pooled nodes of the PeerId.
+func (p *peerSt) Disconnect(peerId PeerId) (err error) {
+	errs := make([]error, 0)
+	for _, item := range p.bucket.FindBlockItems(peerId) {
+		p.bucket.RemoveItem(item)
+		errs = append(errs, item.Value().Close())
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// open ...
+func (p *peerSt) open(peerId PeerId) (node Node, err error) {
+
+	item := p.bucket.FindBlockItem(peerId)
+	if item != nil && !item.Expired() {
+		node = item.Value()
+		return
+	}
+
+	routes, err := p.routes.FindRoutes(peerId)
+	if err != nil {
+		return
+	}
+	if len(routes) <= 0 {
 		err = errors.New("Not Found peer node")
 		return
 	}
 
-	for _, ritem := range ritems {
-		if ritem.Expired() {
-			continue
-		}
-		route := ritem.Value()
-		node, err = p.peerDialer.Connect(route.NodeType, route.Addr)
+	// QUIC routes are tried first, TCP routes are the fallback.
+	slices.SortStableFunc(routes, func(prev, next *Route) int {
+		return int(prev.NodeType) - int(next.NodeType)
+	})
+
+	for _, route := range routes {
+		node, err = p.openRoute(route, peerId)
 		if err == nil {
-			authPeerId, err := p.Authenticate(node, OpenAuthenticateMode)
-			if err == nil && bytes.Equal(authPeerId[:], peerId[:]) {
-				route.rw.Lock()
-				route.FailedNum = 0
-				route.rw.Unlock()
-				break
-			}
+			route.FailedNum = 0
+			route.SucceededAt = time.Now().Unix()
+			_ = p.routes.SaveRoute(route)
+			return
 		}
 
-		route.rw.Lock()
 		route.FailedNum++
-		route.rw.Unlock()
-
-		route.rw.RLock()
+		route.FailedAt = time.Now().Unix()
 		if route.FailedNum > p.maxFailedNum {
-			p.router.RemoveItem(ritem)
+			_ = p.routes.RemoveRoute(route)
+		} else {
+			_ = p.routes.SaveRoute(route)
 		}
-		route.rw.RUnlock()
-
-		_ = node.Close()
 	}
 
 	if node == nil && err == nil {
@@ -405,8 +679,33 @@ func (p *peerSt) Open(peerId PeerId) (node Node, err error) {
 	return
 }
 
+// openRoute ...
+func (p *peerSt) openRoute(route *Route, peerId PeerId) (node Node, err error) {
+
+	node, err = p.peerDialer.Connect(route.NodeType, route.Addr)
+	if err != nil {
+		return
+	}
+
+	authPeerId, err := p.Authenticate(node, OpenAuthenticateMode)
+	if err == nil && bytes.Equal(authPeerId[:], peerId[:]) == false {
+		err = errors.New("Mismatch peer id")
+	}
+
+	if err != nil {
+		_ = node.Close()
+		node = nil
+	}
+	return
+}
+
 // Request ...
-func (p *peerSt) Request(node Node, body io.Reader, method []byte, headers ...*HeaderSegment) (res *Response, err error) {
+func (p *peerSt) Request(ctx context.Context, node Node, body io.Reader, method []byte, headers ...*HeaderSegment) (res *Response, err error) {
+
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
 
 	stream, err := node.OpenNodeStream()
 	if err != nil {
@@ -414,41 +713,87 @@ func (p *peerSt) Request(node Node, body io.Reader, method []byte, headers ...*H
 	}
 
 	request := NewRequest(method, body, headers...)
+	deadline, ok := ctx.Deadline()
+	if ok {
+		request.SetDeadline(deadline)
+	}
 	req, err := MarshalRequest(request)
 	if err != nil {
 		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	// the stream stays cancelable while the response body is read, the
+	// callback is released when the body ends.
+	stop := context.AfterFunc(ctx, func() {
+		_ = stream.CloseRead()
+		_ = stream.CloseWrite()
+	})
 
+	// the request body keeps streaming after the response arrived, so both
+	// sides can read and write at the same time.
+	writeErr := make(chan error, 1)
 	go func() {
-		defer stream.Close()
-		defer wg.Done()
-		_, err = io.Copy(stream, req)
+		_, err := io.Copy(stream, req)
+		if err == nil {
+			err = stream.Close()
+		} else {
+			_ = stream.CloseRead()
+			_ = stream.CloseWrite()
+		}
+		writeErr <- err
 	}()
 
-	var resErr error
-	go func() {
-		defer stream.Close()
-		defer wg.Done()
-		response := new(Response)
-		resErr = UnmarshalResponse(stream, response)
-		if resErr == nil {
-			res = response
+	response := new(Response)
+	err = UnmarshalResponse(stream, response)
+	if err != nil {
+		// stop writing a request nobody answers.
+		_ = stream.CloseWrite()
+		werr := <-writeErr
+		if werr != nil {
+			err = werr
 		}
-	}()
+	} else {
+		res = response
+	}
+
+	if ctx.Err() != nil {
+		res = nil
+		err = ctx.Err()
+	}
 
-	wg.Wait()
-	if res != nil {
-		err = nil
-	} else if err == nil && resErr != nil {
-		err = resErr
+	if res == nil || res.body == nil {
+		stop()
+	} else {
+		res.body = &stopReader{Reader: res.body, stop: stop}
 	}
+	return
+}
+
+// stopReader calls stop when the reader ends, so the callback registered on
+// a long lived context does not outlive the stream.
+type stopReader struct {
+	io.Reader
+	stop func() bool
+}
 
+// Read ...
+func (r *stopReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	if err != nil {
+		r.stop()
+	}
 	return
 }
 
+// Trailers ...
+func (r *stopReader) Trailers() []*HeaderSegment {
+	body, ok := r.Reader.(trailersReader)
+	if ok {
+		return body.Trailers()
+	}
+	return nil
+}
+
 // AcceptServe ...
 func (p *peerSt) AcceptServe(ctx context.Context, serve NodeServe) {
 	for {
@@ -472,39 +817,182 @@ func (p *peerSt) Accept(ctx context.Context, node Node, peerId PeerId) {
 		panic(errors.New("Missing peer id"))
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	item := p.bucket.PutItem(peerId, node)
+	p.serve(ctx, node, peerId, item)
+}
 
-	go func() {
-		defer wg.Done()
-		for {
-			stream, err := node.AcceptNodeStream(ctx)
+// serve ...
+func (p *peerSt) serve(ctx context.Context, node Node, peerId PeerId, item *memory.BucketItem[Node, PeerId]) {
+
+	p.publishNode(NodeConnectedEvent, peerId, node, nil)
+	defer p.publishNode(NodeClosedEvent, peerId, node, nil)
+	defer p.bucket.RemoveItem(item)
+
+	for {
+		stream, err := node.AcceptNodeStream(ctx)
+		if err != nil {
+			break
+		}
+		go func() {
+			defer stream.Close()
+			c, err := NewContext(stream, peerId)
 			if err != nil {
-				break
+				return
+			}
+			if bytes.Equal([]byte("Ping"), c.Method()) {
+				_ = c.Respond(nil)
+				return
 			}
-			go func() {
-				defer stream.Close()
-				c, err := NewContext(stream, peerId)
-				if err == nil {
-					// TODO: close with error
-					_ = p.app.Run(c)
-				}
-			}()
+			if p.revocations != nil && bytes.Equal([]byte("Revocations"), c.Method()) {
+				_ = p.recover(c, func() error {
+					return p.revocationsFn(c, nil)
+				})
+				return
+			}
+			_ = p.recover(c, func() error {
+				return p.app.Run(c)
+			})
+		}()
+	}
+}
+
+// Probe ...
+func (p *peerSt) Probe(ctx context.Context) {
 
+	ticker := time.NewTicker(p.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-	}()
 
-	item := p.bucket.PutItem(peerId, node)
-	defer p.bucket.RemoveItem(item)
+		var wg sync.WaitGroup
+		for _, item := range p.bucket.Items() {
+			if item.Expired() {
+				continue
+			}
+			wg.Add(1)
+			go func(item *memory.BucketItem[Node, PeerId]) {
+				defer wg.Done()
+				p.probe(ctx, item)
+			}(item)
+		}
+		wg.Wait()
+	}
+}
+
+// probe evicts and closes the pooled node if it does not answer a ping in time.
+func (p *peerSt) probe(ctx context.Context, item *memory.BucketItem[Node, PeerId]) {
+
+	probeCtx, cancel := context.WithTimeout(ctx, p.probeTimeout)
+	defer cancel()
+
+	node := item.Value()
+	res, err := p.Request(probeCtx, node, nil, []byte("Ping"))
+	if err == nil && res.Body() != nil {
+		_, err = io.Copy(io.Discard, res.Body())
+	}
+
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	p.bucket.RemoveItem(item)
+	_ = node.Close()
+}
+
+const (
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+)
+
+type newPeerConfig struct {
+	recoverHooks  []RecoverHook
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+	routes        RouteStore
+	revocations   RevocationList
+	events        EventBus
+}
+
+// defaultPeerConfig ...
+func defaultPeerConfig() *newPeerConfig {
+	cfg := new(newPeerConfig)
+	cfg.probeInterval = defaultProbeInterval
+	cfg.probeTimeout = defaultProbeTimeout
+	cfg.routes = NewMemoryRouteStore()
+	return cfg
+}
+
+type NewPeerWithFn func(cfg *newPeerConfig)
+
+// NewPeerWithRecoverHook ...
+func NewPeerWithRecoverHook(hook RecoverHook) NewPeerWithFn {
+	return func(cfg *newPeerConfig) {
+		cfg.recoverHooks = append(cfg.recoverHooks, hook)
+	}
+}
+
+// NewPeerWithProbeInterval sets how often the pooled nodes are probed, a
+// non-positive interval is the default one.
+func NewPeerWithProbeInterval(interval time.Duration) NewPeerWithFn {
+	return func(cfg *newPeerConfig) {
+		cfg.probeInterval = interval
+	}
+}
+
+// NewPeerWithProbeTimeout sets how long a probe waits for the ping, a
+// non-positive timeout is the default one.
+func NewPeerWithProbeTimeout(timeout time.Duration) NewPeerWithFn {
+	return func(cfg *newPeerConfig) {
+		cfg.probeTimeout = timeout
+	}
+}
+
+// NewPeerWithRouteStore ...
+func NewPeerWithRouteStore(routes RouteStore) NewPeerWithFn {
+	return func(cfg *newPeerConfig) {
+		cfg.routes = routes
+	}
+}
 
-	wg.Wait()
+// NewPeerWithRevocationList rejects revoked peers and exchanges the list
+// with every authenticated peer.
+func NewPeerWithRevocationList(revocations RevocationList) NewPeerWithFn {
+	return func(cfg *newPeerConfig) {
+		cfg.revocations = revocations
+	}
+}
+
+// NewPeerWithEventBus publishes the authenticate and node events to the bus.
+func NewPeerWithEventBus(events EventBus) NewPeerWithFn {
+	return func(cfg *newPeerConfig) {
+		cfg.events = events
+	}
 }
 
-// New ...
-func New(baseId uuid.UUID, app core.App[Context], generator PeerIdGenerator, maxFailedNum uint8) Peer {
+// New creates the peer of the node whose TLS config is built from keystore,
+// the private key of keystore signs the authenticate handshake so the remote
+// side verifies it with the certificate of the node.
+func New(baseId uuid.UUID, keystore core.Keystore, app core.App[Context], generator PeerIdGenerator, maxFailedNum uint8, withFns ...NewPeerWithFn) Peer {
+
+	cfg := defaultPeerConfig()
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+	// a non-positive interval panics the ticker of Probe and a non-positive
+	// timeout evicts every node.
+	if cfg.probeInterval <= 0 {
+		cfg.probeInterval = defaultProbeInterval
+	}
+	if cfg.probeTimeout <= 0 {
+		cfg.probeTimeout = defaultProbeTimeout
+	}
 
 	bucket := memory.NewBucket[Node, PeerId](comparePeerId)
-	router := memory.NewBucket[*peerRoute, PeerId](comparePeerId)
 
 	dialer := new(peerDialer)
 	dialer.dialerMap = make(map[uint8]NodeDialer)
@@ -517,7 +1005,16 @@ func New(baseId uuid.UUID, app core.App[Context], generator PeerIdGenerator, max
 	peer.maxFailedNum = maxFailedNum
 	peer.bucket = bucket
 	peer.peerDialer = dialer
-	peer.router = router
+	peer.routes = cfg.routes
+	peer.privateKey, peer.keyErr = keystoreKey(keystore)
+	peer.revocations = cfg.revocations
+	peer.revocationsFn = NewRPCHandle(peer.handleRevocations)
+	peer.recover = NewRecoverHandle(cfg.recoverHooks...)
+	peer.opening = make(map[PeerId]*peerOpenCall)
+	peer.openMu = new(sync.Mutex)
+	peer.probeInterval = cfg.probeInterval
+	peer.probeTimeout = cfg.probeTimeout
+	peer.events = cfg.events
 
 	return peer
 }
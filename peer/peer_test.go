@@ -4,16 +4,19 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/x509"
 	"errors"
 	"net"
 
 	"sync"
+	"sync/atomic"
 
 	"io"
 	mrand "math/rand"
 	"testing"
+	"time"
 
-	// "pan/core"
+	"pan/core"
 	coreMocked "pan/mocks/pan/core"
 	mocked "pan/mocks/pan/peer"
 	"pan/peer"
@@ -38,7 +41,7 @@ func TestPeer(t *testing.T) {
 		nextDialer := new(mocked.MockNodeDialer)
 		nextDialer.On("Type").Return(peer.QUICNodeType).Times(2)
 
-		p := peer.New(baseId, app, generator, 0)
+		p := peer.New(baseId, nil, app, generator, 0)
 		err := p.Attach(dialer)
 		assert.Nil(t, err, "Error should be nil")
 		err = p.Attach(dialer)
@@ -61,68 +64,34 @@ func TestPeer(t *testing.T) {
 	t.Run("Authenticate", func(t *testing.T) {
 
 		baseId := uuid.New()
-		app := new(coreMocked.MockApp[peer.Context])
 		generator := new(mocked.MockPeerIdGenerator)
 
-		reqReader, reqWriter := io.Pipe()
-		resReader, resWriter := io.Pipe()
-		stream := new(TestNodeStream)
-		stream.Reader = resReader
-		stream.Writer = reqWriter
-		stream.Closer = reqWriter
+		resBaseId := uuid.New()
+		resPeerId := peer.PeerId(uuid.New())
+		resKey, _, resCert, _ := newTestKeyAndCert(t)
 
+		reqs := make(chan *peer.Request, 1)
 		addr := []byte("127.0.0.1:9000")
 		node := new(mocked.MockNode)
-		node.On("OpenNodeStream").Once().Return(stream, nil)
+		node.On("Certificate").Once().Return(resCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, resBaseId, resKey, reqs), nil)
+		node.On("OpenNodeStream").Once().Return(newVerifyStream(0, nil), nil)
 		node.On("Type").Once().Return(peer.QUICNodeType)
 		node.On("Addr").Once().Return(addr)
 
-		resBaseId := uuid.New()
-		resPeerId := peer.PeerId(uuid.New())
-
 		generator.On("Generate", resBaseId[:], node).Once().Return(resPeerId, nil)
 
-		var wg sync.WaitGroup
-		wg.Add(1)
-
-		var peerId peer.PeerId
-		var authErr error
-		go func() {
-			defer wg.Done()
-			p := peer.New(baseId, app, generator, 0)
-			peerId, authErr = p.Authenticate(node, peer.TestOnlyAuthenticateMode)
-		}()
-
-		req := new(peer.Request)
-		err := peer.UnmarshalRequest(reqReader, req)
-		if err != nil {
-			t.Fatal(err)
-		}
-		reqBody, err := io.ReadAll(req.Body())
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		res := peer.NewReponse(0, bytes.NewReader(resBaseId[:]))
-		reader, err := peer.MarshalResponse(res)
-		if err != nil {
-			t.Fatal(err)
-		}
-		_, err = io.Copy(resWriter, reader)
-		if err != nil {
-			t.Fatal(err)
-		}
-		resWriter.Close()
+		p := newAuthenticatePeer(t, baseId, generator, 0)
+		peerId, authErr := p.Authenticate(node, peer.TestOnlyAuthenticateMode)
 
-		wg.Wait()
+		req := <-reqs
 
 		assert.Nil(t, authErr, "Authenticate should without error")
 		assert.Equal(t, resPeerId, peerId, "Peer Id should be same")
 		assert.Equal(t, []byte("Authenticate"), req.Method(), "Request method should be same")
-		assert.Equal(t, baseId[:], reqBody, "Request base id should be same")
 		assert.Equal(t, peer.TestOnlyAuthenticateMode, req.Header([]byte("Mode"))[0], "Request mode header should be same")
+		assert.Equal(t, peer.UnknownPeerState, p.Stat(resPeerId), "Peer state should be unknown")
 
-		app.AssertExpectations(t)
 		generator.AssertExpectations(t)
 		node.AssertExpectations(t)
 
@@ -131,63 +100,54 @@ func TestPeer(t *testing.T) {
 	t.Run("Authenticate with failed", func(t *testing.T) {
 
 		baseId := uuid.New()
-		app := new(coreMocked.MockApp[peer.Context])
 		generator := new(mocked.MockPeerIdGenerator)
 
-		reqReader, reqWriter := io.Pipe()
-		resReader, resWriter := io.Pipe()
-		stream := new(TestNodeStream)
-		stream.Reader = resReader
-		stream.Writer = reqWriter
-		stream.Closer = reqWriter
-
-		node := new(mocked.MockNode)
-		node.On("OpenNodeStream").Once().Return(stream, nil)
-
 		resBaseId := uuid.New()
+		resKey, _, resCert, _ := newTestKeyAndCert(t)
 		terr := errors.New("Test Error")
 
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(resCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, resBaseId, resKey, nil), nil)
+
 		generator.On("Generate", resBaseId[:], node).Once().Return(nil, terr)
 
-		var wg sync.WaitGroup
-		wg.Add(1)
+		p := newAuthenticatePeer(t, baseId, generator, 0)
+		_, authErr := p.Authenticate(node, peer.TestOnlyAuthenticateMode)
 
-		var authErr error
-		go func() {
-			defer wg.Done()
-			p := peer.New(baseId, app, generator, 0)
-			_, authErr = p.Authenticate(node, peer.TestOnlyAuthenticateMode)
-		}()
+		var typedErr *peer.AuthenticateError
+		assert.ErrorIs(t, authErr, terr, "Authenticate should be error")
+		assert.ErrorAs(t, authErr, &typedErr, "Error should be authenticate error")
+		assert.Equal(t, peer.OfflinePeerState, p.Stat(peer.PeerId(resBaseId)), "Peer state should be offline")
 
-		req := new(peer.Request)
-		err := peer.UnmarshalRequest(reqReader, req)
-		if err != nil {
-			t.Fatal(err)
-		}
-		reqBody, err := io.ReadAll(req.Body())
-		if err != nil {
-			t.Fatal(err)
-		}
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
 
-		res := peer.NewReponse(0, bytes.NewReader(resBaseId[:]))
-		reader, err := peer.MarshalResponse(res)
-		if err != nil {
-			t.Fatal(err)
-		}
-		_, err = io.Copy(resWriter, reader)
-		if err != nil {
-			t.Fatal(err)
-		}
-		resWriter.Close()
+	})
 
-		wg.Wait()
+	t.Run("Authenticate with failed event", func(t *testing.T) {
 
-		assert.ErrorIs(t, terr, authErr, "Authenticate should be error")
-		assert.Equal(t, []byte("Authenticate"), req.Method(), "Request method should be same")
-		assert.Equal(t, baseId[:], reqBody, "Request base id should be same")
-		assert.Equal(t, peer.TestOnlyAuthenticateMode, req.Header([]byte("Mode"))[0], "Request mode header should be same")
+		generator := new(mocked.MockPeerIdGenerator)
 
-		app.AssertExpectations(t)
+		resBaseId := uuid.New()
+		resKey, _, resCert, _ := newTestKeyAndCert(t)
+		terr := errors.New("Test Error")
+
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(resCert)
+		node.On("OpenNodeStream").Once().Return(newAuthenticateStream(t, resBaseId, resKey, nil), nil)
+		node.On("Addr").Once().Return([]byte("127.0.0.1:9000"))
+
+		generator.On("Generate", resBaseId[:], node).Once().Return(nil, terr)
+
+		bus := peer.NewEventBus()
+		sub := bus.Subscribe(1)
+		p := newAuthenticatePeer(t, uuid.New(), generator, 0, peer.NewPeerWithEventBus(bus))
+		_, _ = p.Authenticate(node, peer.TestOnlyAuthenticateMode)
+
+		event := <-sub.C
+		assert.Equal(t, peer.AuthFailedEvent, event.Type, "Event should be auth failed")
+		assert.ErrorIs(t, event.Err, terr, "Event error should be same")
 		generator.AssertExpectations(t)
 		node.AssertExpectations(t)
 
@@ -196,7 +156,7 @@ func TestPeer(t *testing.T) {
 	t.Run("AcceptAuthenticate", func(t *testing.T) {
 
 		baseId := uuid.New()
-		app := new(coreMocked.MockApp[peer.Context])
+		key, _, cert, _ := newTestKeyAndCert(t)
 		generator := new(mocked.MockPeerIdGenerator)
 
 		reqReader, reqWriter := io.Pipe()
@@ -206,12 +166,22 @@ func TestPeer(t *testing.T) {
 		stream.Writer = resWriter
 		stream.Closer = resWriter
 
-		ctx := context.Background()
-		node := new(mocked.MockNode)
-		node.On("AcceptNodeStream", ctx).Once().Return(stream, nil)
+		verifyReqReader, verifyReqWriter := io.Pipe()
+		verifyResReader, verifyResWriter := io.Pipe()
+		verifyStream := new(TestNodeStream)
+		verifyStream.Reader = verifyReqReader
+		verifyStream.Writer = verifyResWriter
+		verifyStream.Closer = verifyResWriter
 
 		reqBaseId := uuid.New()
 		reqPeerId := peer.PeerId(uuid.New())
+		reqKey, _, reqCert, _ := newTestKeyAndCert(t)
+
+		ctx := context.Background()
+		node := new(mocked.MockNode)
+		node.On("AcceptNodeStream", ctx).Once().Return(stream, nil)
+		node.On("AcceptNodeStream", ctx).Once().Return(verifyStream, nil)
+		node.On("Certificate").Once().Return(reqCert)
 
 		generator.On("Generate", reqBaseId[:], node).Once().Return(reqPeerId, nil)
 
@@ -219,12 +189,15 @@ func TestPeer(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			p := peer.New(baseId, app, generator, 0)
+			p := peer.New(baseId, newAuthenticateKeystore(t, key, cert), nil, generator, 0)
 			p.AcceptAuthenticate(ctx, node)
 		}()
 
+		reqNonce := make([]byte, peer.AuthenticateNonceSize)
+		rand.Read(reqNonce)
 		header := peer.NewHeaderSegment([]byte("Mode"), []byte{peer.TestOnlyAuthenticateMode})
-		req := peer.NewRequest([]byte("Authenticate"), bytes.NewReader(reqBaseId[:]), header)
+		nonceHeader := peer.NewHeaderSegment([]byte("Nonce"), reqNonce)
+		req := peer.NewRequest([]byte("Authenticate"), bytes.NewReader(reqBaseId[:]), header, nonceHeader)
 		reader, err := peer.MarshalRequest(req)
 		if err != nil {
 			t.Fatal(err)
@@ -247,12 +220,35 @@ func TestPeer(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		resNonce := res.Header([]byte("Nonce"))
+		sig := res.Header([]byte("Signature"))
+		sigErr := verifyAuthenticateTranscript(cert, sig, "Responder", reqBaseId[:], reqNonce, resBody, resNonce)
+
+		sig = signAuthenticateTranscript(t, reqKey, "Initiator", reqBaseId[:], reqNonce, resBody, resNonce)
+		req = peer.NewRequest([]byte("Verify"), nil, peer.NewHeaderSegment([]byte("Signature"), sig))
+		reader, err = peer.MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(verifyReqWriter, reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyReqWriter.Close()
+		verifyRes := new(peer.Response)
+		err = peer.UnmarshalResponse(verifyResReader, verifyRes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		wg.Wait()
 
 		assert.Equal(t, 0, res.Code(), "Response code should be same")
 		assert.Equal(t, baseId[:], resBody, "Response base id should be same")
+		assert.Len(t, resNonce, peer.AuthenticateNonceSize, "Response nonce size should be same")
+		assert.Nil(t, sigErr, "Response signature should be valid")
+		assert.Equal(t, 0, verifyRes.Code(), "Verify response code should be same")
 
-		app.AssertExpectations(t)
 		generator.AssertExpectations(t)
 		node.AssertExpectations(t)
 
@@ -264,7 +260,7 @@ func TestPeer(t *testing.T) {
 		app := new(coreMocked.MockApp[peer.Context])
 		generator := new(mocked.MockPeerIdGenerator)
 
-		p := peer.New(baseId, app, generator, 0)
+		p := peer.New(baseId, nil, app, generator, 0)
 		node, err := p.Open(peer.PeerId(baseId))
 
 		assert.Nil(t, node, "Node should be nil")
@@ -274,6 +270,139 @@ func TestPeer(t *testing.T) {
 		generator.AssertExpectations(t)
 	})
 
+	t.Run("Open with fallback", func(t *testing.T) {
+
+		baseId := uuid.New()
+		remoteBaseId := uuid.New()
+		peerId := peer.PeerId(uuid.New())
+		app := new(coreMocked.MockApp[peer.Context])
+		generator := new(mocked.MockPeerIdGenerator)
+
+		p := newAuthenticatePeer(t, baseId, generator, 1)
+
+		quicAddr := []byte("127.0.0.1:9000")
+		tcpAddr := []byte("127.0.0.1:9001")
+		routes := map[uint8][]byte{peer.TCPNodeType: tcpAddr, peer.QUICNodeType: quicAddr}
+		for nodeType, addr := range routes {
+			node := new(mocked.MockNode)
+			mockAuthenticate(t, node, remoteBaseId)
+			node.On("Type").Once().Return(nodeType)
+			node.On("Addr").Once().Return(addr)
+			generator.On("Generate", remoteBaseId[:], node).Once().Return(peerId, nil)
+
+			_, err := p.Authenticate(node, peer.TestOnlyAuthenticateMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			node.AssertExpectations(t)
+		}
+
+		quicDialer := new(mocked.MockNodeDialer)
+		quicDialer.On("Type").Return(peer.QUICNodeType)
+		quicDialer.On("Connect", quicAddr).Once().Return(nil, errors.New("UDP Blocked"))
+
+		tcpNode := new(mocked.MockNode)
+		mockAuthenticate(t, tcpNode, remoteBaseId)
+		tcpNode.On("AcceptNodeStream", mock.Anything).Maybe().Return(nil, net.ErrClosed)
+		generator.On("Generate", remoteBaseId[:], tcpNode).Once().Return(peerId, nil)
+
+		tcpDialer := new(mocked.MockNodeDialer)
+		tcpDialer.On("Type").Return(peer.TCPNodeType)
+		tcpDialer.On("Connect", tcpAddr).Once().Return(tcpNode, nil)
+
+		err := p.Attach(quicDialer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.Attach(tcpDialer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		node, err := p.Open(peerId)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, tcpNode, node, "Node should fall back to tcp")
+
+		app.AssertExpectations(t)
+		generator.AssertExpectations(t)
+		quicDialer.AssertExpectations(t)
+		tcpDialer.AssertExpectations(t)
+	})
+
+	t.Run("Open with single flight", func(t *testing.T) {
+
+		baseId := uuid.New()
+		remoteBaseId := uuid.New()
+		peerId := peer.PeerId(uuid.New())
+		app := new(coreMocked.MockApp[peer.Context])
+		generator := new(mocked.MockPeerIdGenerator)
+
+		p := newAuthenticatePeer(t, baseId, generator, 0)
+
+		addr := []byte("127.0.0.1:9000")
+		routeNode := new(mocked.MockNode)
+		mockAuthenticate(t, routeNode, remoteBaseId)
+		routeNode.On("Type").Once().Return(peer.QUICNodeType)
+		routeNode.On("Addr").Once().Return(addr)
+		generator.On("Generate", remoteBaseId[:], routeNode).Once().Return(peerId, nil)
+		_, err := p.Authenticate(routeNode, peer.TestOnlyAuthenticateMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the node stays online until the test is done.
+		closed := make(chan struct{})
+		defer close(closed)
+		node := new(mocked.MockNode)
+		mockAuthenticate(t, node, remoteBaseId)
+		node.On("AcceptNodeStream", mock.Anything).Maybe().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-closed
+		})
+		generator.On("Generate", remoteBaseId[:], node).Once().Return(peerId, nil)
+
+		connecting := make(chan struct{})
+		release := make(chan struct{})
+		dialer := new(mocked.MockNodeDialer)
+		dialer.On("Type").Return(peer.QUICNodeType)
+		dialer.On("Connect", addr).Once().Return(node, nil).Run(func(args mock.Arguments) {
+			close(connecting)
+			<-release
+		})
+		err = p.Attach(dialer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total := 4
+		nodes := make([]peer.Node, total)
+		errs := make([]error, total)
+		var wg sync.WaitGroup
+		wg.Add(total)
+		go func() {
+			defer wg.Done()
+			nodes[0], errs[0] = p.Open(peerId)
+		}()
+		<-connecting
+		for i := 1; i < total; i++ {
+			go func(i int) {
+				defer wg.Done()
+				nodes[i], errs[i] = p.Open(peerId)
+			}(i)
+		}
+		close(release)
+		wg.Wait()
+
+		for i := 0; i < total; i++ {
+			assert.Nil(t, errs[i], "Error should be nil")
+			assert.Equal(t, node, nodes[i], "Node should be shared")
+		}
+
+		app.AssertExpectations(t)
+		generator.AssertExpectations(t)
+		dialer.AssertExpectations(t)
+	})
+
 	t.Run("Request", func(t *testing.T) {
 
 		method := make([]byte, 32)
@@ -315,8 +444,8 @@ func TestPeer(t *testing.T) {
 		var rresBody []byte
 		go func() {
 			defer wg.Done()
-			p := peer.New(baseId, app, generator, 0)
-			response, err := p.Request(node, bodyReader, method)
+			p := peer.New(baseId, nil, app, generator, 0)
+			response, err := p.Request(context.Background(), node, bodyReader, method)
 			if err != nil {
 				t.Fatal(t)
 			}
@@ -388,18 +517,18 @@ func TestPeer(t *testing.T) {
 		app := new(coreMocked.MockApp[peer.Context])
 		generator := new(mocked.MockPeerIdGenerator)
 
-		p := peer.New(baseId, app, generator, 0)
+		p := peer.New(baseId, nil, app, generator, 0)
 
 		var wg sync.WaitGroup
 		wg.Add(1)
-		var res peer.Response
+		var res *peer.Response
 		go func() {
 			defer wg.Done()
-			response, err := p.Request(node, bodyReader, method)
+			response, err := p.Request(context.Background(), node, bodyReader, method)
 			if err != nil {
 				t.Fatal(t)
 			}
-			res = *response
+			res = response
 		}()
 
 		wg.Wait()
@@ -419,6 +548,181 @@ func TestPeer(t *testing.T) {
 		generator.AssertExpectations(t)
 	})
 
+	t.Run("Request with bidirectional stream", func(t *testing.T) {
+
+		c2sReader, c2sWriter := io.Pipe()
+		s2cReader, s2cWriter := io.Pipe()
+
+		stream := new(TestNodeStream)
+		stream.Reader = s2cReader
+		stream.Writer = c2sWriter
+		stream.Closer = c2sWriter
+
+		serverStream := new(TestNodeStream)
+		serverStream.Reader = c2sReader
+		serverStream.Writer = s2cWriter
+		serverStream.Closer = s2cWriter
+
+		node := new(mocked.MockNode)
+		node.On("OpenNodeStream").Once().Return(stream, nil)
+
+		// the handler echoes the request body while it is received.
+		go func() {
+			ctx, err := peer.NewContext(serverStream, peer.PeerId(uuid.New()))
+			if err != nil {
+				return
+			}
+			echoReader, echoWriter := io.Pipe()
+			go func() {
+				_, err := io.Copy(echoWriter, ctx.Body())
+				echoWriter.CloseWithError(err)
+			}()
+			_ = ctx.Respond(echoReader)
+		}()
+
+		bodyReader, bodyWriter := io.Pipe()
+		p := peer.New(uuid.New(), nil, nil, nil, 0)
+		res, err := p.Request(context.Background(), node, bodyReader, []byte("echo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echo := make([]byte, 4)
+		for _, msg := range []string{"ping", "pong"} {
+			_, err = bodyWriter.Write([]byte(msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.ReadFull(res.Body(), echo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, msg, string(echo), "Echo should be received before request body ends")
+		}
+
+		bodyWriter.Close()
+		rest, err := io.ReadAll(res.Body())
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Empty(t, rest, "Response body should end with request body")
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Request releases context after body", func(t *testing.T) {
+
+		reqReader, reqWriter := io.Pipe()
+		resReader, resWriter := io.Pipe()
+
+		var canceled atomic.Bool
+		stream := new(TestNodeStream)
+		stream.Reader = resReader
+		stream.Writer = reqWriter
+		stream.Closer = reqWriter
+		stream.CloseReadFn = func() error {
+			canceled.Store(true)
+			return nil
+		}
+		stream.CloseWriteFn = func() error {
+			canceled.Store(true)
+			return nil
+		}
+
+		node := new(mocked.MockNode)
+		node.On("OpenNodeStream").Once().Return(stream, nil)
+
+		go func() {
+			req := new(peer.Request)
+			_ = peer.UnmarshalRequest(reqReader, req)
+			_, _ = io.ReadAll(req.Body())
+			reader, _ := peer.MarshalResponse(peer.NewReponse(0, bytes.NewReader([]byte("body"))))
+			_, err := io.Copy(resWriter, reader)
+			resWriter.CloseWithError(err)
+		}()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p := peer.New(uuid.New(), nil, new(coreMocked.MockApp[peer.Context]), new(mocked.MockPeerIdGenerator), 0)
+		res, err := p.Request(ctx, node, bytes.NewReader([]byte("request")), []byte("method"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resBody, err := io.ReadAll(res.Body())
+
+		// the long lived context ends after the body, the stream is done
+		// already and must not be closed by it.
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []byte("body"), resBody, "Response body should be same")
+		assert.False(t, canceled.Load(), "Stream should not be canceled after body")
+		node.AssertExpectations(t)
+	})
+
+	t.Run("Request with canceled context", func(t *testing.T) {
+
+		method := []byte("method")
+		reqReader, reqWriter := io.Pipe()
+		resReader, resWriter := io.Pipe()
+
+		var closeWg sync.WaitGroup
+		var closeReadOnce, closeWriteOnce sync.Once
+		closeWg.Add(2)
+		stream := new(TestNodeStream)
+		stream.Reader = resReader
+		stream.Writer = reqWriter
+		stream.Closer = reqWriter
+		stream.CloseReadFn = func() error {
+			closeReadOnce.Do(closeWg.Done)
+			return resWriter.CloseWithError(errors.New("Stream Canceled"))
+		}
+		stream.CloseWriteFn = func() error {
+			closeWriteOnce.Do(closeWg.Done)
+			return reqWriter.Close()
+		}
+
+		node := new(mocked.MockNode)
+		node.On("OpenNodeStream").Once().Return(stream, nil)
+
+		baseId := uuid.New()
+		app := new(coreMocked.MockApp[peer.Context])
+		generator := new(mocked.MockPeerIdGenerator)
+
+		deadline := time.Now().Add(time.Millisecond * 50)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		var res *peer.Response
+		var resErr error
+		go func() {
+			defer wg.Done()
+			p := peer.New(baseId, nil, app, generator, 0)
+			res, resErr = p.Request(ctx, node, nil, method)
+		}()
+
+		req := new(peer.Request)
+		err := peer.UnmarshalRequest(reqReader, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqDeadline, ok := req.Deadline()
+
+		wg.Wait()
+		closeWg.Wait()
+
+		assert.True(t, ok, "Request deadline should be set")
+		assert.WithinDuration(t, deadline, reqDeadline, 10*time.Millisecond, "Request deadline should be near")
+		assert.Nil(t, res, "Response should be nil")
+		assert.ErrorIs(t, resErr, context.DeadlineExceeded, "Error should be deadline exceeded")
+
+		node.AssertExpectations(t)
+		app.AssertExpectations(t)
+		generator.AssertExpectations(t)
+	})
+
 	t.Run("AcceptServe", func(t *testing.T) {
 
 		var wg sync.WaitGroup
@@ -436,7 +740,7 @@ func TestPeer(t *testing.T) {
 		serve.On("Accept", ctx).Once().Return(node, nil)
 		serve.On("Accept", ctx).Once().Return(nil, net.ErrClosed)
 
-		p := peer.New(baseId, app, generator, 0)
+		p := peer.New(baseId, nil, app, generator, 0)
 		p.AcceptServe(ctx, serve)
 
 		wg.Wait()
@@ -486,7 +790,7 @@ func TestPeer(t *testing.T) {
 			appCtx = args.Get(0).(peer.Context)
 		}).Return(nil)
 
-		p := peer.New(baseId, app, generator, 0)
+		p := peer.New(baseId, nil, app, generator, 0)
 		ctx := context.Background()
 		p.Accept(ctx, node, peerId)
 
@@ -501,4 +805,251 @@ func TestPeer(t *testing.T) {
 		mockStream.AssertExpectations(t)
 
 	})
+
+	t.Run("Accept with panic", func(t *testing.T) {
+
+		generator := new(mocked.MockPeerIdGenerator)
+		node := new(mocked.MockNode)
+		app := new(coreMocked.MockApp[peer.Context])
+		baseId := uuid.New()
+		peerId := peer.PeerId(uuid.New())
+
+		req := peer.NewRequest([]byte("method"), bytes.NewReader([]byte("body")))
+		reader, err := peer.MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resReader, resWriter := io.Pipe()
+		stream := new(TestNodeStream)
+		stream.Reader = reader
+		stream.Writer = resWriter
+		stream.Closer = resWriter
+
+		node.On("AcceptNodeStream", mock.Anything).Once().Return(stream, nil)
+		node.On("AcceptNodeStream", mock.Anything).Maybe().Return(nil, errors.New("Test Error"))
+
+		terr := errors.New("Test Error")
+		app.On("Run", mock.Anything).Once().Run(func(args mock.Arguments) {
+			panic(terr)
+		}).Return(nil)
+
+		var hookErr error
+		hook := func(ctx peer.Context, err error) {
+			hookErr = err
+		}
+
+		p := peer.New(baseId, nil, app, generator, 0, peer.NewPeerWithRecoverHook(hook))
+		go p.Accept(context.Background(), node, peerId)
+
+		res := new(peer.Response)
+		err = peer.UnmarshalResponse(resReader, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resBody, err := io.ReadAll(res.Body())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, peer.InternalErrorCode, res.Code(), "Response code should be internal error")
+		assert.Equal(t, "Internal Error", string(resBody), "Response body should be error message")
+		assert.ErrorIs(t, hookErr, terr, "Hook should get panic error")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Accept Ping", func(t *testing.T) {
+
+		generator := new(mocked.MockPeerIdGenerator)
+		node := new(mocked.MockNode)
+		app := new(coreMocked.MockApp[peer.Context])
+		baseId := uuid.New()
+		peerId := peer.PeerId(uuid.New())
+
+		req := peer.NewRequest([]byte("Ping"), nil)
+		reader, err := peer.MarshalRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resReader, resWriter := io.Pipe()
+		stream := new(TestNodeStream)
+		stream.Reader = reader
+		stream.Writer = resWriter
+		stream.Closer = resWriter
+
+		node.On("AcceptNodeStream", mock.Anything).Once().Return(stream, nil)
+		node.On("AcceptNodeStream", mock.Anything).Maybe().Return(nil, errors.New("Test Error"))
+
+		p := peer.New(baseId, nil, app, generator, 0)
+		go p.Accept(context.Background(), node, peerId)
+
+		res := new(peer.Response)
+		err = peer.UnmarshalResponse(resReader, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, 0, res.Code(), "Response code should be 0")
+		assert.Nil(t, res.Body(), "Response body should be nil")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Probe", func(t *testing.T) {
+
+		generator := new(mocked.MockPeerIdGenerator)
+		app := new(coreMocked.MockApp[peer.Context])
+		baseId := uuid.New()
+		peerId := peer.PeerId(uuid.New())
+
+		closed := make(chan struct{})
+		node := new(mocked.MockNode)
+		node.On("AcceptNodeStream", mock.Anything).Once().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-closed
+		})
+		node.On("OpenNodeStream").Once().Return(nil, errors.New("Dead Node"))
+		node.On("Close").Once().Return(nil).Run(func(args mock.Arguments) {
+			close(closed)
+		})
+
+		p := peer.New(baseId, nil, app, generator, 0, peer.NewPeerWithProbeInterval(time.Millisecond*10))
+		go p.Accept(context.Background(), node, peerId)
+
+		assert.Eventually(t, func() bool {
+			return p.Stat(peerId) == peer.OnlinePeerState
+		}, time.Second, time.Millisecond, "Peer should be online after accept")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Probe(ctx)
+
+		<-closed
+		assert.Equal(t, peer.OfflinePeerState, p.Stat(peerId), "Peer should be offline after probe")
+
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Probe with non-positive interval", func(t *testing.T) {
+
+		generator := new(mocked.MockPeerIdGenerator)
+		app := new(coreMocked.MockApp[peer.Context])
+
+		p := peer.New(uuid.New(), nil, app, generator, 0, peer.NewPeerWithProbeInterval(0), peer.NewPeerWithProbeTimeout(-time.Second))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.NotPanics(t, func() {
+			p.Probe(ctx)
+		}, "Probe should not panic")
+
+		generator.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+
+		generator := new(mocked.MockPeerIdGenerator)
+		app := new(coreMocked.MockApp[peer.Context])
+		peerId := peer.PeerId(uuid.New())
+
+		closed := make(chan struct{})
+		node := new(mocked.MockNode)
+		node.On("AcceptNodeStream", mock.Anything).Once().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-closed
+		})
+		node.On("Close").Once().Return(nil).Run(func(args mock.Arguments) {
+			close(closed)
+		})
+
+		p := peer.New(uuid.New(), nil, app, generator, 0)
+		go p.Accept(context.Background(), node, peerId)
+
+		assert.Eventually(t, func() bool {
+			return p.Stat(peerId) == peer.OnlinePeerState
+		}, time.Second, time.Millisecond, "Peer should be online after accept")
+
+		err := p.Disconnect(peerId)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peer.OfflinePeerState, p.Stat(peerId), "Peer should be offline after disconnect")
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+
+	t.Run("Accept with event bus", func(t *testing.T) {
+
+		generator := new(mocked.MockPeerIdGenerator)
+		app := new(coreMocked.MockApp[peer.Context])
+		peerId := peer.PeerId(uuid.New())
+
+		closed := make(chan struct{})
+		node := new(mocked.MockNode)
+		node.On("AcceptNodeStream", mock.Anything).Once().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-closed
+		})
+		node.On("Addr").Return([]byte("127.0.0.1:9000"))
+
+		bus := peer.NewEventBus()
+		sub := bus.Subscribe(2)
+		p := peer.New(uuid.New(), nil, app, generator, 0, peer.NewPeerWithEventBus(bus))
+		go p.Accept(context.Background(), node, peerId)
+
+		event := <-sub.C
+		assert.Equal(t, peer.NodeConnectedEvent, event.Type, "Event should be node connected")
+		assert.Equal(t, peerId, event.PeerId, "PeerId should be same")
+		assert.Equal(t, []byte("127.0.0.1:9000"), event.Addr, "Addr should be same")
+
+		close(closed)
+		event = <-sub.C
+		assert.Equal(t, peer.NodeClosedEvent, event.Type, "Event should be node closed")
+		assert.Equal(t, node, event.Node, "Node should be same")
+		generator.AssertExpectations(t)
+		node.AssertExpectations(t)
+		app.AssertExpectations(t)
+
+	})
+}
+
+// TestPeerIdGenerator ...
+func TestPeerIdGenerator(t *testing.T) {
+
+	t.Run("Generate with Ed25519", func(t *testing.T) {
+
+		_, certPem, err := core.GenerateKeyAndCert(core.GenerateKeyAndCertWithAlgorithm(x509.Ed25519))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := core.ParseCertWithPem(certPem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey, _ := core.ExtractPublicKeyFromCert(cert)
+
+		baseId := uuid.New()
+		node := new(mocked.MockNode)
+		node.On("Certificate").Once().Return(cert)
+		node.On("Addr").Once().Return([]byte("127.0.0.1:9000"))
+
+		generator := peer.NewPeerIdGenerator(false)
+		peerId, err := generator.Generate(baseId[:], node)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, peer.PeerId(uuid.NewSHA1(baseId, pubKey)), peerId, "PeerId should be derived from public key")
+		node.AssertExpectations(t)
+	})
+
 }
@@ -53,6 +53,9 @@ func (n *quicNodeSt) Addr() []byte {
 // Certificate ...
 func (n *quicNodeSt) Certificate() *x509.Certificate {
 	state := n.conn.ConnectionState()
+	if len(state.TLS.PeerCertificates) == 0 {
+		return nil
+	}
 	return state.TLS.PeerCertificates[0]
 }
 
@@ -0,0 +1,49 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"pan/core"
+)
+
+type RecoverHook func(ctx Context, err error)
+
+// NewRecoverHandle recovers panics of the following handlers and turns
+// returned errors into error responses.
+func NewRecoverHandle(hooks ...RecoverHook) core.Handle[Context] {
+	return func(ctx Context, next core.Next) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverError(r)
+			}
+			if err == nil {
+				return
+			}
+			for _, hook := range hooks {
+				hook(ctx, err)
+			}
+			err = throwError(ctx, err)
+		}()
+
+		err = next()
+		return
+	}
+}
+
+// recoverError ...
+func recoverError(r any) error {
+	err, ok := r.(error)
+	if ok {
+		return fmt.Errorf("Panic: %w", err)
+	}
+	return fmt.Errorf("Panic: %v", r)
+}
+
+// throwError ...
+func throwError(ctx Context, err error) error {
+	var resErr *ResponseError
+	if errors.As(err, &resErr) {
+		return ctx.ThrowError(resErr.Code(), resErr.Error())
+	}
+	return ctx.ThrowError(InternalErrorCode, "Internal Error")
+}
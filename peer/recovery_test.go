@@ -0,0 +1,85 @@
+package peer_test
+
+import (
+	"errors"
+	"testing"
+
+	mocked "pan/mocks/pan/peer"
+	"pan/peer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRecoverHandle ...
+func TestRecoverHandle(t *testing.T) {
+
+	t.Run("Without error", func(t *testing.T) {
+
+		ctx := new(mocked.MockContext)
+		hookCalled := false
+		handle := peer.NewRecoverHandle(func(ctx peer.Context, err error) {
+			hookCalled = true
+		})
+
+		err := handle(ctx, func() error { return nil })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.False(t, hookCalled, "Hook should not be called")
+		ctx.AssertExpectations(t)
+
+	})
+
+	t.Run("With panic", func(t *testing.T) {
+
+		terr := errors.New("Test Error")
+		ctx := new(mocked.MockContext)
+		ctx.On("ThrowError", peer.InternalErrorCode, "Internal Error").Once().Return(nil)
+
+		var hookErr error
+		handle := peer.NewRecoverHandle(func(hookCtx peer.Context, err error) {
+			assert.Equal(t, ctx, hookCtx, "Hook context should be same")
+			hookErr = err
+		})
+
+		err := handle(ctx, func() error { panic(terr) })
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.ErrorIs(t, hookErr, terr, "Hook should get panic error")
+		ctx.AssertExpectations(t)
+
+	})
+
+	t.Run("With response error", func(t *testing.T) {
+
+		terr := peer.NewReponseError(peer.ForbiddenErrorCode, "Forbidden")
+		ctx := new(mocked.MockContext)
+		ctx.On("ThrowError", peer.ForbiddenErrorCode, "Forbidden").Once().Return(nil)
+
+		handle := peer.NewRecoverHandle()
+		err := handle(ctx, func() error { return terr })
+
+		assert.Nil(t, err, "Error should be nil")
+		ctx.AssertExpectations(t)
+
+	})
+
+	t.Run("With other error", func(t *testing.T) {
+
+		terr := errors.New("Test Error")
+		throwErr := errors.New("Throw Error")
+		ctx := new(mocked.MockContext)
+		ctx.On("ThrowError", peer.InternalErrorCode, "Internal Error").Once().Return(throwErr)
+
+		var hookErr error
+		handle := peer.NewRecoverHandle(func(ctx peer.Context, err error) {
+			hookErr = err
+		})
+		err := handle(ctx, func() error { return terr })
+
+		assert.Equal(t, throwErr, err, "Error should be throw error")
+		assert.Equal(t, terr, hookErr, "Hook should get original error")
+		ctx.AssertExpectations(t)
+
+	})
+
+}
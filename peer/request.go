@@ -2,14 +2,20 @@ package peer
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
+	"sync"
+	"time"
 )
 
 type Request struct {
-	method  []byte
-	headers []*HeaderSegment
-	body    io.Reader
+	method   []byte
+	headers  []*HeaderSegment
+	body     io.Reader
+	deadline time.Time
+	trailers []*HeaderSegment
+	mu       sync.Mutex
 }
 
 // Method ...
@@ -24,22 +30,55 @@ func (r *Request) Headers() []*HeaderSegment {
 
 // Header ...
 func (r *Request) Header(name []byte) (value []byte) {
-	if r.headers != nil {
-		for _, header := range r.headers {
-			if bytes.Equal(header.Name(), name) {
-				value = header.Value()
-				break
-			}
-		}
+	value = findHeader(r.headers, name)
+	return
+}
+
+// Trailers returns the trailers received after the body, or the trailers
+// to send after the body.
+func (r *Request) Trailers() []*HeaderSegment {
+	body, ok := r.body.(*BodySegmentReader)
+	if ok {
+		return body.Trailers()
 	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.trailers
+}
+
+// Trailer ...
+func (r *Request) Trailer(name []byte) (value []byte) {
+	value = findHeader(r.Trailers(), name)
 	return
 }
 
+// SetTrailers sets the trailers to send, they may be set until the body
+// reaches EOF.
+func (r *Request) SetTrailers(trailers ...*HeaderSegment) {
+	r.mu.Lock()
+	r.trailers = trailers
+	r.mu.Unlock()
+}
+
 // Body ...
 func (r *Request) Body() io.Reader {
 	return r.body
 }
 
+// Deadline is on the clock of this side, the remaining time is sent over
+// the wire and a received deadline is rebuilt from it on arrival.
+func (r *Request) Deadline() (deadline time.Time, ok bool) {
+	deadline = r.deadline
+	ok = !deadline.IsZero()
+	return
+}
+
+// SetDeadline ...
+func (r *Request) SetDeadline(deadline time.Time) {
+	r.deadline = deadline
+}
+
 // NewRequest ...
 func NewRequest(method []byte, body io.Reader, headers ...*HeaderSegment) *Request {
 	req := new(Request)
@@ -67,6 +106,11 @@ func UnmarshalRequest(reader io.Reader, request *Request) (err error) {
 			request.method = header.Value()
 			continue
 		}
+		if bytes.Equal([]byte("Timeout"), header.Name()) && len(header.Value()) == 8 {
+			timeout := time.Duration(binary.BigEndian.Uint64(header.Value()))
+			request.deadline = time.Now().Add(max(timeout, 0))
+			continue
+		}
 
 		headers = append(headers, header)
 
@@ -77,7 +121,7 @@ func UnmarshalRequest(reader io.Reader, request *Request) (err error) {
 	}
 
 	if ntype == BodySegmentType {
-		request.body = reader
+		request.body = ParseBodySegment(reader)
 	}
 
 	return
@@ -97,6 +141,17 @@ func MarshalRequest(request *Request) (reader io.Reader, err error) {
 	readers = append(readers, mstr)
 	readers = append(readers, msrs...)
 
+	deadline, ok := request.Deadline()
+	if ok {
+		// the remaining time does not depend on the clocks of both sides
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(max(time.Until(deadline), 0)))
+		dstr := CreateSegmentType(HeaderSegmentType)
+		dsrs := CreateHeaderSegment(&HeaderSegment{name: []byte("Timeout"), value: value})
+		readers = append(readers, dstr)
+		readers = append(readers, dsrs...)
+	}
+
 	headers := request.Headers()
 	if headers != nil {
 		for _, header := range headers {
@@ -110,7 +165,7 @@ func MarshalRequest(request *Request) (reader io.Reader, err error) {
 	body := request.Body()
 	if body != nil {
 		bstr := CreateSegmentType(BodySegmentType)
-		readers = append(readers, bstr, body)
+		readers = append(readers, bstr, CreateBodySegment(body, request.Trailers))
 	}
 
 	reader = io.MultiReader(readers...)
@@ -3,9 +3,11 @@ package peer_test
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"io"
 	"pan/peer"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -49,4 +51,106 @@ func TestRequest(t *testing.T) {
 		assert.Equal(t, body, rBody, "Body Should be same")
 
 	})
+
+	t.Run("MarshalRequest and UnmarshalRequest with deadline", func(t *testing.T) {
+
+		method := []byte("method")
+		deadline := time.Now().Add(time.Minute)
+		request := peer.NewRequest(method, nil)
+		request.SetDeadline(deadline)
+
+		reader, err := peer.MarshalRequest(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := new(peer.Request)
+		err = peer.UnmarshalRequest(reader, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rDeadline, ok := req.Deadline()
+
+		assert.Equal(t, method, req.Method(), "Method Should be same")
+		assert.Nil(t, req.Headers(), "Deadline Should not be in headers")
+		assert.True(t, ok, "Deadline Should be set")
+		assert.WithinDuration(t, deadline, rDeadline, time.Second, "Deadline Should be near")
+
+	})
+
+	t.Run("MarshalRequest and UnmarshalRequest with passed deadline", func(t *testing.T) {
+
+		request := peer.NewRequest([]byte("method"), nil)
+		request.SetDeadline(time.Now().Add(-time.Hour))
+
+		reader, err := peer.MarshalRequest(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := new(peer.Request)
+		err = peer.UnmarshalRequest(reader, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rDeadline, ok := req.Deadline()
+		assert.True(t, ok, "Deadline Should be set")
+		assert.WithinDuration(t, time.Now(), rDeadline, time.Second, "Passed deadline Should be rebuilt on arrival")
+
+	})
+
+	t.Run("UnmarshalRequest with timeout", func(t *testing.T) {
+
+		// a timeout is relative, so the deadline is on the clock of the receiver
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(time.Minute))
+		data := bytes.NewBuffer(nil)
+		for _, header := range []*peer.HeaderSegment{
+			peer.NewHeaderSegment([]byte("Method"), []byte("method")),
+			peer.NewHeaderSegment([]byte("Timeout"), value),
+		} {
+			_, _ = io.Copy(data, peer.CreateSegmentType(peer.HeaderSegmentType))
+			for _, segment := range peer.CreateHeaderSegment(header) {
+				_, _ = io.Copy(data, segment)
+			}
+		}
+
+		req := new(peer.Request)
+		err := peer.UnmarshalRequest(data, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rDeadline, ok := req.Deadline()
+		assert.True(t, ok, "Deadline Should be set")
+		assert.WithinDuration(t, time.Now().Add(time.Minute), rDeadline, time.Second, "Deadline Should be after timeout")
+
+	})
+
+	t.Run("MarshalRequest and UnmarshalRequest with trailers", func(t *testing.T) {
+
+		body := []byte("body")
+		request := peer.NewRequest([]byte("method"), bytes.NewReader(body))
+		trailer := peer.NewHeaderSegment([]byte("Checksum"), []byte("abc"))
+		request.SetTrailers(trailer)
+
+		reader, err := peer.MarshalRequest(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := new(peer.Request)
+		err = peer.UnmarshalRequest(reader, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rBody, err := io.ReadAll(req.Body())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, body, rBody, "Body Should be same")
+		assert.Nil(t, req.Headers(), "Trailers Should not be in headers")
+		assert.Equal(t, trailer.Value(), req.Trailer([]byte("Checksum")), "Trailer Should be same")
+
+	})
 }
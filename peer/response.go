@@ -3,14 +3,23 @@ package peer
 import (
 	"bytes"
 	"encoding/binary"
+	"sync"
 
 	"io"
 )
 
+// trailersReader is a body which receives the trailers after it.
+type trailersReader interface {
+	io.Reader
+	Trailers() []*HeaderSegment
+}
+
 type Response struct {
-	code    int
-	headers []*HeaderSegment
-	body    io.Reader
+	code     int
+	headers  []*HeaderSegment
+	body     io.Reader
+	trailers []*HeaderSegment
+	mu       sync.Mutex
 }
 
 // IsError ...
@@ -30,17 +39,37 @@ func (r *Response) Headers() []*HeaderSegment {
 
 // Header ...
 func (r *Response) Header(name []byte) (value []byte) {
-	if r.headers != nil {
-		for _, header := range r.headers {
-			if bytes.Equal(header.Name(), name) {
-				value = header.Value()
-				break
-			}
-		}
+	value = findHeader(r.headers, name)
+	return
+}
+
+// Trailers returns the trailers received after the body, or the trailers
+// to send after the body.
+func (r *Response) Trailers() []*HeaderSegment {
+	body, ok := r.body.(trailersReader)
+	if ok {
+		return body.Trailers()
 	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.trailers
+}
+
+// Trailer ...
+func (r *Response) Trailer(name []byte) (value []byte) {
+	value = findHeader(r.Trailers(), name)
 	return
 }
 
+// SetTrailers sets the trailers to send, they may be set until the body
+// reaches EOF.
+func (r *Response) SetTrailers(trailers ...*HeaderSegment) {
+	r.mu.Lock()
+	r.trailers = trailers
+	r.mu.Unlock()
+}
+
 // Body ...
 func (r *Response) Body() io.Reader {
 	return r.body
@@ -59,9 +88,16 @@ func NewReponse(code int, body io.Reader, headers ...*HeaderSegment) *Response {
 func UnmarshalResponse(reader io.Reader, response *Response) (err error) {
 	headers := make([]*HeaderSegment, 0)
 	var ntype uint8
+	segments := 0
 	for {
-		headerType, err := ParseSegmentType(reader)
-		if err != nil || headerType != HeaderSegmentType {
+		headerType, typeErr := ParseSegmentType(reader)
+		if typeErr != nil && segments <= 0 {
+			// an empty stream carries no response at all.
+			err = typeErr
+			return
+		}
+		segments++
+		if typeErr != nil || headerType != HeaderSegmentType {
 			ntype = headerType
 			break
 		}
@@ -86,7 +122,7 @@ func UnmarshalResponse(reader io.Reader, response *Response) (err error) {
 	}
 
 	if ntype == BodySegmentType {
-		response.body = reader
+		response.body = ParseBodySegment(reader)
 	}
 
 	return
@@ -94,6 +130,12 @@ func UnmarshalResponse(reader io.Reader, response *Response) (err error) {
 
 // MarshalResponse
 func MarshalResponse(response *Response) (reader io.Reader, err error) {
+	reader, err = marshalResponse(response, response.Trailers)
+	return
+}
+
+// marshalResponse ...
+func marshalResponse(response *Response, trailers func() []*HeaderSegment) (reader io.Reader, err error) {
 
 	readers := make([]io.Reader, 0)
 	code := make([]byte, 4)
@@ -116,7 +158,7 @@ func MarshalResponse(response *Response) (reader io.Reader, err error) {
 	body := response.Body()
 	if body != nil {
 		bstr := CreateSegmentType(BodySegmentType)
-		readers = append(readers, bstr, body)
+		readers = append(readers, bstr, CreateBodySegment(body, trailers))
 	}
 
 	reader = io.MultiReader(readers...)
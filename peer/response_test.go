@@ -48,4 +48,30 @@ func TestResponse(t *testing.T) {
 		assert.Equal(t, body, rBody, "Body Should be same")
 
 	})
+
+	t.Run("UnmarshalResponse and MarshalResponse with trailers", func(t *testing.T) {
+		body := []byte("body")
+		response := peer.NewReponse(0, bytes.NewReader(body))
+		trailer := peer.NewHeaderSegment([]byte("Checksum"), []byte("abc"))
+		response.SetTrailers(trailer)
+
+		reader, err := peer.MarshalResponse(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := new(peer.Response)
+		err = peer.UnmarshalResponse(reader, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, res.Trailers(), "Trailers Should be nil before body is read")
+		rBody, err := io.ReadAll(res.Body())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, body, rBody, "Body Should be same")
+		assert.Equal(t, trailer.Value(), res.Trailer([]byte("Checksum")), "Trailer Should be same")
+
+	})
 }
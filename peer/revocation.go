@@ -0,0 +1,528 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"pan/core"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const revocationHash = crypto.SHA256
+
+const (
+	// DefaultRevocationMaxAge is the age after which a new revocation is
+	// stale, the revocations known already are kept.
+	DefaultRevocationMaxAge = 30 * 24 * time.Hour
+	// DefaultMaxIssuerRevocations is the max revocations one issuer adds.
+	DefaultMaxIssuerRevocations = 1024
+	revocationClockSkew         = 5 * time.Minute
+)
+
+var (
+	ErrInvalidRevocation = errors.New("Invalid Revocation")
+	ErrRevoked           = errors.New("Revoked")
+)
+
+// NewPeerIdRevocation revokes the PeerId, it is signed with the pem key of
+// cert, which must be trusted by the receivers.
+func NewPeerIdRevocation(key, cert []byte, peerId PeerId) (*Revocation, error) {
+	revocation := new(Revocation)
+	revocation.PeerId = peerId[:]
+	return signRevocation(revocation, key, cert)
+}
+
+// NewPublicKeyRevocation revokes the public key, a key may revoke itself.
+func NewPublicKeyRevocation(key, cert []byte, pubKey []byte) (*Revocation, error) {
+	revocation := new(Revocation)
+	revocation.PublicKey = pubKey
+	return signRevocation(revocation, key, cert)
+}
+
+// signRevocation ...
+func signRevocation(revocation *Revocation, key, cert []byte) (_ *Revocation, err error) {
+
+	revocation.Issuer, err = extractPublicKeyWithPem(cert)
+	if err != nil {
+		return
+	}
+
+	revocation.Time = time.Now().Unix()
+	revocation.Signature, err = core.SignWithPrivateKey(key, revocationSignData(revocation), revocationHash)
+	if err != nil {
+		return
+	}
+	return revocation, nil
+}
+
+// revocationSignData ...
+func revocationSignData(revocation *Revocation) []byte {
+	data := []byte("Revocation")
+	for _, field := range [][]byte{revocation.PeerId, revocation.PublicKey, revocation.Issuer} {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(field)))
+		data = append(data, field...)
+	}
+	data = binary.BigEndian.AppendUint64(data, uint64(revocation.Time))
+	return data
+}
+
+// RevocationStore keeps the revocations, so that they survive restart.
+type RevocationStore interface {
+	Init() error
+	FindRevocations() ([]*Revocation, error)
+	SaveRevocation(revocation *Revocation) error
+}
+
+// RevocationList is the revoked PeerIds and public keys shared between
+// peers. Only revocations of trusted issuers, or of a known key by itself,
+// are accepted.
+type RevocationList interface {
+	Init() error
+	Revoke(revocation *Revocation) (bool, error)
+	IsRevoked(peerId PeerId, pubKey []byte) bool
+	Revocations() []*Revocation
+}
+
+type revocationListSt struct {
+	store       RevocationStore
+	trustedKeys [][]byte
+	knownKey    func(pubKey []byte) bool
+	maxAge      time.Duration
+	maxIssued   int
+	revocations []*Revocation
+	peerIds     map[PeerId]struct{}
+	pubKeys     map[string]struct{}
+	issued      map[string]int
+	rw          *sync.RWMutex
+}
+
+// Init loads the stored revocations.
+func (rl *revocationListSt) Init() (err error) {
+
+	err = rl.store.Init()
+	if err != nil {
+		return
+	}
+
+	revocations, err := rl.store.FindRevocations()
+	if err != nil {
+		return
+	}
+
+	rl.rw.Lock()
+	for _, revocation := range revocations {
+		if rl.verify(revocation) == nil {
+			rl.put(revocation)
+		}
+	}
+	rl.rw.Unlock()
+	return
+}
+
+// Revoke verifies and stores the revocation, added is false if it is
+// revoked already.
+func (rl *revocationListSt) Revoke(revocation *Revocation) (added bool, err error) {
+
+	err = rl.verify(revocation)
+	if err != nil {
+		return
+	}
+
+	rl.rw.Lock()
+	defer rl.rw.Unlock()
+
+	if rl.isRevoked(revocation) {
+		return
+	}
+
+	err = rl.check(revocation)
+	if err != nil {
+		return
+	}
+
+	err = rl.store.SaveRevocation(revocation)
+	if err != nil {
+		return
+	}
+	rl.put(revocation)
+	added = true
+	return
+}
+
+// IsRevoked ...
+func (rl *revocationListSt) IsRevoked(peerId PeerId, pubKey []byte) (revoked bool) {
+
+	rl.rw.RLock()
+	_, revoked = rl.peerIds[peerId]
+	if revoked == false && pubKey != nil {
+		_, revoked = rl.pubKeys[string(pubKey)]
+	}
+	rl.rw.RUnlock()
+	return
+}
+
+// Revocations ...
+func (rl *revocationListSt) Revocations() (revocations []*Revocation) {
+	rl.rw.RLock()
+	revocations = make([]*Revocation, len(rl.revocations))
+	copy(revocations, rl.revocations)
+	rl.rw.RUnlock()
+	return
+}
+
+// verify ...
+func (rl *revocationListSt) verify(revocation *Revocation) (err error) {
+
+	hasPeerId := len(revocation.PeerId) == len(PeerId{})
+	hasPubKey := len(revocation.PublicKey) > 0
+	if hasPeerId == hasPubKey || (len(revocation.PeerId) > 0 && hasPeerId == false) {
+		err = ErrInvalidRevocation
+		return
+	}
+
+	trusted := hasPubKey && bytes.Equal(revocation.PublicKey, revocation.Issuer)
+	if trusted == false && rl.isTrusted(revocation.Issuer) == false {
+		err = errors.Join(ErrInvalidRevocation, errors.New("Untrusted Issuer"))
+		return
+	}
+
+	err = core.VerifyWithPublicKey(revocation.Issuer, revocationSignData(revocation), revocation.Signature, revocationHash)
+	if err != nil {
+		err = errors.Join(ErrInvalidRevocation, err)
+	}
+	return
+}
+
+// check rejects the new revocations which are issued in the future or are
+// stale, the self revocations of unknown keys and the revocations of an
+// issuer beyond its limit.
+func (rl *revocationListSt) check(revocation *Revocation) error {
+
+	now := time.Now()
+	issuedAt := time.Unix(revocation.Time, 0)
+	if issuedAt.After(now.Add(revocationClockSkew)) {
+		return errors.Join(ErrInvalidRevocation, errors.New("Future Revocation"))
+	}
+	if issuedAt.Before(now.Add(-rl.maxAge)) {
+		return errors.Join(ErrInvalidRevocation, errors.New("Stale Revocation"))
+	}
+
+	if rl.isTrusted(revocation.Issuer) == false {
+		if rl.knownKey == nil || rl.knownKey(revocation.PublicKey) == false {
+			return errors.Join(ErrInvalidRevocation, errors.New("Unknown Public Key"))
+		}
+	}
+
+	if rl.issued[string(revocation.Issuer)] >= rl.maxIssued {
+		return errors.Join(ErrInvalidRevocation, errors.New("Too Many Revocations"))
+	}
+	return nil
+}
+
+// isTrusted ...
+func (rl *revocationListSt) isTrusted(issuer []byte) bool {
+	for _, key := range rl.trustedKeys {
+		if bytes.Equal(key, issuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRevoked ...
+func (rl *revocationListSt) isRevoked(revocation *Revocation) (revoked bool) {
+	if len(revocation.PeerId) > 0 {
+		_, revoked = rl.peerIds[PeerId(revocation.PeerId)]
+		return
+	}
+	_, revoked = rl.pubKeys[string(revocation.PublicKey)]
+	return
+}
+
+// put ...
+func (rl *revocationListSt) put(revocation *Revocation) {
+	if rl.isRevoked(revocation) {
+		return
+	}
+	if len(revocation.PeerId) > 0 {
+		rl.peerIds[PeerId(revocation.PeerId)] = struct{}{}
+	} else {
+		rl.pubKeys[string(revocation.PublicKey)] = struct{}{}
+	}
+	rl.issued[string(revocation.Issuer)]++
+	rl.revocations = append(rl.revocations, revocation)
+}
+
+type newRevocationListConfig struct {
+	knownKey  func(pubKey []byte) bool
+	maxAge    time.Duration
+	maxIssued int
+}
+
+type NewRevocationListWithFn func(cfg *newRevocationListConfig)
+
+// NewRevocationListWithKnownKey accepts the self revocation of a key only
+// if knownKey reports it, usually SimplePeerIdGenerator.IsKnownKey. Self
+// revocations are rejected without it.
+func NewRevocationListWithKnownKey(knownKey func(pubKey []byte) bool) NewRevocationListWithFn {
+	return func(cfg *newRevocationListConfig) {
+		cfg.knownKey = knownKey
+	}
+}
+
+// NewRevocationListWithMaxAge ...
+func NewRevocationListWithMaxAge(maxAge time.Duration) NewRevocationListWithFn {
+	return func(cfg *newRevocationListConfig) {
+		cfg.maxAge = maxAge
+	}
+}
+
+// NewRevocationListWithMaxIssuerRevocations ...
+func NewRevocationListWithMaxIssuerRevocations(max int) NewRevocationListWithFn {
+	return func(cfg *newRevocationListConfig) {
+		cfg.maxIssued = max
+	}
+}
+
+// NewRevocationList trusts the revocations signed by one of the trusted
+// public keys, usually the key of the local CA.
+func NewRevocationList(store RevocationStore, trustedKeys [][]byte, withFns ...NewRevocationListWithFn) RevocationList {
+
+	cfg := new(newRevocationListConfig)
+	cfg.maxAge = DefaultRevocationMaxAge
+	cfg.maxIssued = DefaultMaxIssuerRevocations
+	for _, withFn := range withFns {
+		withFn(cfg)
+	}
+
+	rl := new(revocationListSt)
+	rl.store = store
+	rl.trustedKeys = trustedKeys
+	rl.knownKey = cfg.knownKey
+	rl.maxAge = cfg.maxAge
+	rl.maxIssued = cfg.maxIssued
+	rl.revocations = make([]*Revocation, 0)
+	rl.peerIds = make(map[PeerId]struct{})
+	rl.pubKeys = make(map[string]struct{})
+	rl.issued = make(map[string]int)
+	rl.rw = new(sync.RWMutex)
+	return rl
+}
+
+type memoryRevocationStore struct {
+	revocations []*Revocation
+	mu          *sync.Mutex
+}
+
+// Init ...
+func (s *memoryRevocationStore) Init() error {
+	return nil
+}
+
+// FindRevocations ...
+func (s *memoryRevocationStore) FindRevocations() (revocations []*Revocation, err error) {
+	s.mu.Lock()
+	revocations = make([]*Revocation, len(s.revocations))
+	copy(revocations, s.revocations)
+	s.mu.Unlock()
+	return
+}
+
+// SaveRevocation ...
+func (s *memoryRevocationStore) SaveRevocation(revocation *Revocation) (err error) {
+	s.mu.Lock()
+	s.revocations = append(s.revocations, revocation)
+	s.mu.Unlock()
+	return
+}
+
+// NewMemoryRevocationStore ...
+func NewMemoryRevocationStore() RevocationStore {
+	store := new(memoryRevocationStore)
+	store.revocations = make([]*Revocation, 0)
+	store.mu = new(sync.Mutex)
+	return store
+}
+
+// RevocationRecord is the database row of a revocation.
+type RevocationRecord struct {
+	ID        int64  `gorm:"primary_key;auto_increment"`
+	PeerId    []byte `gorm:"size:16;uniqueIndex:idx_revocation"`
+	PublicKey []byte `gorm:"uniqueIndex:idx_revocation"`
+	Time      int64
+	Issuer    []byte
+	Signature []byte
+}
+
+type gormRevocationStore struct {
+	db *gorm.DB
+}
+
+// Init ...
+func (s *gormRevocationStore) Init() (err error) {
+	err = s.db.AutoMigrate(&RevocationRecord{})
+	return
+}
+
+// FindRevocations ...
+func (s *gormRevocationStore) FindRevocations() (revocations []*Revocation, err error) {
+	records := make([]*RevocationRecord, 0)
+	result := s.db.Find(&records)
+	err = result.Error
+	if err != nil {
+		return
+	}
+
+	revocations = make([]*Revocation, 0, len(records))
+	for _, record := range records {
+		revocation := new(Revocation)
+		revocation.PeerId = record.PeerId
+		revocation.PublicKey = record.PublicKey
+		revocation.Time = record.Time
+		revocation.Issuer = record.Issuer
+		revocation.Signature = record.Signature
+		revocations = append(revocations, revocation)
+	}
+	return
+}
+
+// SaveRevocation ...
+func (s *gormRevocationStore) SaveRevocation(revocation *Revocation) (err error) {
+	record := new(RevocationRecord)
+	record.PeerId = revocation.PeerId
+	record.PublicKey = revocation.PublicKey
+	record.Time = revocation.Time
+	record.Issuer = revocation.Issuer
+	record.Signature = revocation.Signature
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	err = result.Error
+	return
+}
+
+// NewGormRevocationStore ...
+func NewGormRevocationStore(db *gorm.DB) RevocationStore {
+	store := new(gormRevocationStore)
+	store.db = db
+	return store
+}
+
+// Revoke adds the revocation, closes the revoked nodes and spreads it to
+// all connected peers.
+func (p *peerSt) Revoke(ctx context.Context, revocation *Revocation) (err error) {
+
+	if p.revocations == nil {
+		err = errors.New("Missing Revocation List")
+		return
+	}
+
+	added, err := p.revocations.Revoke(revocation)
+	if err != nil || added == false {
+		return
+	}
+
+	p.closeRevoked()
+	err = p.spreadRevocations(ctx)
+	return
+}
+
+// isRevoked ...
+func (p *peerSt) isRevoked(peerId PeerId, node Node) bool {
+	if p.revocations == nil {
+		return false
+	}
+	var pubKey []byte
+	cert := node.Certificate()
+	if cert != nil {
+		pubKey, _ = core.ExtractPublicKeyFromCert(cert)
+	}
+	return p.revocations.IsRevoked(peerId, pubKey)
+}
+
+// closeRevoked closes the pooled nodes of revoked PeerIds and keys.
+func (p *peerSt) closeRevoked() {
+	for _, item := range p.bucket.Items() {
+		if item.Expired() {
+			continue
+		}
+		node := item.Value()
+		peerId, ok := item.BlockId()
+		if ok && p.isRevoked(peerId, node) {
+			p.bucket.RemoveItem(item)
+			_ = node.Close()
+		}
+	}
+}
+
+// exchangeRevocations sends the own revocations to the node and merges the
+// revocations it answers.
+func (p *peerSt) exchangeRevocations(ctx context.Context, node Node) (err error) {
+
+	req := new(Revocations)
+	req.Revocations = p.revocations.Revocations()
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	res, err := callNode[Revocations](ctx, p, node, []byte("Revocations"), body)
+	if err != nil {
+		return
+	}
+
+	p.mergeRevocations(res.Revocations)
+	return
+}
+
+// handleRevocations answers the own revocations and merges the received.
+func (p *peerSt) handleRevocations(ctx Context, req *Revocations) (res *Revocations, err error) {
+	res = new(Revocations)
+	res.Revocations = p.revocations.Revocations()
+	p.mergeRevocations(req.Revocations)
+	return
+}
+
+// mergeRevocations drops the invalid revocations, new ones are spread
+// again, so a revocation reaches the whole network in one round.
+func (p *peerSt) mergeRevocations(revocations []*Revocation) {
+
+	added := false
+	for _, revocation := range revocations {
+		ok, err := p.revocations.Revoke(revocation)
+		added = added || (ok && err == nil)
+	}
+
+	if added {
+		p.closeRevoked()
+		go p.spreadRevocations(context.Background())
+	}
+}
+
+// spreadRevocations ...
+func (p *peerSt) spreadRevocations(ctx context.Context) (err error) {
+
+	items := p.bucket.Items()
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		if item.Expired() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, node Node) {
+			defer wg.Done()
+			errs[i] = p.exchangeRevocations(ctx, node)
+		}(i, item.Value())
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	return
+}
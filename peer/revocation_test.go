@@ -0,0 +1,469 @@
+package peer_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/binary"
+	"io"
+	"net"
+	"pan/core"
+	"pan/peer"
+	"testing"
+	"time"
+
+	coreMocked "pan/mocks/pan/core"
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// signRevocationAt signs the PeerId revocation with the issue time at.
+func signRevocationAt(t *testing.T, key []byte, issuer []byte, peerId peer.PeerId, at time.Time) *peer.Revocation {
+	revocation := new(peer.Revocation)
+	revocation.PeerId = peerId[:]
+	revocation.Issuer = issuer
+	revocation.Time = at.Unix()
+
+	data := []byte("Revocation")
+	for _, field := range [][]byte{revocation.PeerId, revocation.PublicKey, revocation.Issuer} {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(field)))
+		data = append(data, field...)
+	}
+	data = binary.BigEndian.AppendUint64(data, uint64(revocation.Time))
+
+	sig, err := core.SignWithPrivateKey(key, data, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocation.Signature = sig
+	return revocation
+}
+
+// newRevocationsStream answers the Revocations request with revocations.
+func newRevocationsStream(reqs chan<- *peer.Revocations, revocations ...*peer.Revocation) *TestNodeStream {
+	return newTestStream(func(req *peer.Request) (res *peer.Response, err error) {
+		body, _ := io.ReadAll(req.Body())
+		received := new(peer.Revocations)
+		_ = proto.Unmarshal(body, received)
+		reqs <- received
+
+		msg := new(peer.Revocations)
+		msg.Revocations = revocations
+		resBody, _ := proto.Marshal(msg)
+		header := peer.NewHeaderSegment([]byte("Content-Type"), []byte(peer.ProtobufContentType))
+		res = peer.NewReponse(0, bytes.NewReader(resBody), header)
+		return
+	})
+}
+
+// TestRevocationList ...
+func TestRevocationList(t *testing.T) {
+
+	t.Run("Revoke PeerId", func(t *testing.T) {
+
+		key, cert, _, issuer := newTestKeyAndCert(t)
+		peerId := peer.PeerId(uuid.New())
+		revocation, err := peer.NewPeerIdRevocation(key, cert, peerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{issuer})
+		added, err := rl.Revoke(revocation)
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, added, "Revocation should be added")
+
+		added, err = rl.Revoke(revocation)
+		assert.Nil(t, err, "Error should be nil")
+		assert.False(t, added, "Revocation should not be added twice")
+
+		assert.True(t, rl.IsRevoked(peerId, nil), "PeerId should be revoked")
+		assert.False(t, rl.IsRevoked(peer.PeerId(uuid.New()), nil), "Other PeerId should not be revoked")
+		assert.Len(t, rl.Revocations(), 1, "Revocations should have one")
+	})
+
+	t.Run("Revoke PublicKey by itself", func(t *testing.T) {
+
+		key, cert, _, pubKey := newTestKeyAndCert(t)
+		revocation, err := peer.NewPublicKeyRevocation(key, cert, pubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		knownKey := func(key []byte) bool {
+			return bytes.Equal(key, pubKey)
+		}
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), nil, peer.NewRevocationListWithKnownKey(knownKey))
+		added, err := rl.Revoke(revocation)
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, added, "Revocation should be added")
+		assert.True(t, rl.IsRevoked(peer.PeerId(uuid.New()), pubKey), "PublicKey should be revoked")
+	})
+
+	t.Run("Revoke unknown PublicKey by itself", func(t *testing.T) {
+
+		key, cert, _, pubKey := newTestKeyAndCert(t)
+		revocation, _ := peer.NewPublicKeyRevocation(key, cert, pubKey)
+
+		knownKey := func(key []byte) bool {
+			return false
+		}
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), nil, peer.NewRevocationListWithKnownKey(knownKey))
+		added, err := rl.Revoke(revocation)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Error should be invalid revocation")
+		assert.False(t, added, "Revocation should not be added")
+
+		rl = peer.NewRevocationList(peer.NewMemoryRevocationStore(), nil)
+		_, err = rl.Revoke(revocation)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Error should be invalid revocation without known keys")
+		assert.False(t, rl.IsRevoked(peer.PeerId(uuid.New()), pubKey), "PublicKey should not be revoked")
+	})
+
+	t.Run("Revoke with future or stale time", func(t *testing.T) {
+
+		key, _, _, issuer := newTestKeyAndCert(t)
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{issuer}, peer.NewRevocationListWithMaxAge(time.Hour))
+
+		future := signRevocationAt(t, key, issuer, peer.PeerId(uuid.New()), time.Now().Add(time.Hour))
+		_, err := rl.Revoke(future)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Future revocation should be invalid")
+
+		stale := signRevocationAt(t, key, issuer, peer.PeerId(uuid.New()), time.Now().Add(-2*time.Hour))
+		_, err = rl.Revoke(stale)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Stale revocation should be invalid")
+
+		recent := signRevocationAt(t, key, issuer, peer.PeerId(uuid.New()), time.Now().Add(-time.Minute))
+		added, err := rl.Revoke(recent)
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, added, "Recent revocation should be added")
+		assert.Len(t, rl.Revocations(), 1, "Revocations should have one")
+	})
+
+	t.Run("Revoke beyond issuer limit", func(t *testing.T) {
+
+		key, cert, _, issuer := newTestKeyAndCert(t)
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{issuer}, peer.NewRevocationListWithMaxIssuerRevocations(2))
+
+		for i := 0; i < 2; i++ {
+			revocation, _ := peer.NewPeerIdRevocation(key, cert, peer.PeerId(uuid.New()))
+			added, err := rl.Revoke(revocation)
+			assert.Nil(t, err, "Error should be nil")
+			assert.True(t, added, "Revocation should be added")
+		}
+
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, peer.PeerId(uuid.New()))
+		added, err := rl.Revoke(revocation)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Error should be invalid revocation")
+		assert.False(t, added, "Revocation should not be added")
+		assert.Len(t, rl.Revocations(), 2, "Revocations should have two")
+	})
+
+	t.Run("Revoke with untrusted issuer", func(t *testing.T) {
+
+		_, _, _, trusted := newTestKeyAndCert(t)
+		key, cert, _, _ := newTestKeyAndCert(t)
+		peerId := peer.PeerId(uuid.New())
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, peerId)
+
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{trusted})
+		added, err := rl.Revoke(revocation)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Error should be invalid revocation")
+		assert.False(t, added, "Revocation should not be added")
+		assert.False(t, rl.IsRevoked(peerId, nil), "PeerId should not be revoked")
+	})
+
+	t.Run("Revoke with forged signature", func(t *testing.T) {
+
+		key, cert, _, issuer := newTestKeyAndCert(t)
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, peer.PeerId(uuid.New()))
+		otherPeerId := uuid.New()
+		revocation.PeerId = otherPeerId[:]
+
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{issuer})
+		_, err := rl.Revoke(revocation)
+		assert.ErrorIs(t, err, peer.ErrInvalidRevocation, "Error should be invalid revocation")
+	})
+
+	t.Run("Init", func(t *testing.T) {
+
+		key, cert, _, issuer := newTestKeyAndCert(t)
+		peerId := peer.PeerId(uuid.New())
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, peerId)
+
+		store := peer.NewMemoryRevocationStore()
+		_ = store.SaveRevocation(revocation)
+
+		rl := peer.NewRevocationList(store, [][]byte{issuer})
+		err := rl.Init()
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, rl.IsRevoked(peerId, nil), "Stored PeerId should be revoked")
+	})
+
+	t.Run("Generate with revoked PeerId", func(t *testing.T) {
+
+		key, cert, _, issuer := newTestKeyAndCert(t)
+		_, nodeCert, _, _ := newTestKeyAndCert(t)
+		node := newEndorseNode(t, nodeCert)
+		baseId := uuid.New()
+
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{issuer})
+		generator := peer.NewPeerIdGenerator(false, peer.NewPeerIdGeneratorWithRevocationList(rl))
+		peerId, err := generator.Generate(baseId[:], node)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, peerId)
+		_, _ = rl.Revoke(revocation)
+
+		_, err = generator.Generate(baseId[:], node)
+		assert.ErrorIs(t, err, peer.ErrRevoked, "Error should be revoked")
+	})
+
+	t.Run("Generate with rotated key after old key revoked", func(t *testing.T) {
+
+		oldKey, oldCert, _, oldPubKey := newTestKeyAndCert(t)
+		newKey, newCert, _, _ := newTestKeyAndCert(t)
+		baseId := uuid.New()
+
+		var generator *peer.SimplePeerIdGenerator
+		knownKey := func(pubKey []byte) bool {
+			return generator.IsKnownKey(pubKey)
+		}
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), nil, peer.NewRevocationListWithKnownKey(knownKey))
+		generator = peer.NewPeerIdGenerator(false, peer.NewPeerIdGeneratorWithRevocationList(rl))
+		peerId, err := generator.Generate(baseId[:], newEndorseNode(t, oldCert))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		endorsement, _ := peer.NewEndorsement(oldKey, oldCert, newKey, newCert)
+		err = generator.Endorse(endorsement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		revocation, _ := peer.NewPublicKeyRevocation(oldKey, oldCert, oldPubKey)
+		added, err := rl.Revoke(revocation)
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, added, "Revocation should be added")
+
+		_, err = generator.Generate(baseId[:], newEndorseNode(t, oldCert))
+		assert.ErrorIs(t, err, peer.ErrRevoked, "Error should be revoked for old key")
+
+		newPeerId, err := generator.Generate(baseId[:], newEndorseNode(t, newCert))
+		assert.Nil(t, err, "Error should be nil for endorsed new key")
+		assert.Equal(t, peerId, newPeerId, "PeerId of new key should be same")
+	})
+
+	t.Run("Generator IsKnownKey", func(t *testing.T) {
+
+		_, nodeCert, _, _ := newTestKeyAndCert(t)
+		node := newEndorseNode(t, nodeCert)
+		x509Cert, _ := core.ParseCertWithPem(nodeCert)
+		pubKey, _ := core.ExtractPublicKeyFromCert(x509Cert)
+		baseId := uuid.New()
+
+		generator := peer.NewPeerIdGenerator(false)
+		assert.False(t, generator.IsKnownKey(pubKey), "Key should not be known before Generate")
+
+		_, err := generator.Generate(baseId[:], node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, generator.IsKnownKey(pubKey), "Key should be known after Generate")
+	})
+
+	t.Run("Generator IsKnownKey with capacity", func(t *testing.T) {
+
+		_, firstCert, _, firstPubKey := newTestKeyAndCert(t)
+		_, secondCert, _, secondPubKey := newTestKeyAndCert(t)
+		baseId := uuid.New()
+
+		generator := peer.NewPeerIdGenerator(false, peer.NewPeerIdGeneratorWithKnownKeyCapacity(1))
+		_, err := generator.Generate(baseId[:], newEndorseNode(t, firstCert))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = generator.Generate(baseId[:], newEndorseNode(t, secondCert))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.False(t, generator.IsKnownKey(firstPubKey), "Least recently generated key should be forgotten")
+		assert.True(t, generator.IsKnownKey(secondPubKey), "Last generated key should be known")
+	})
+
+}
+
+// TestGormRevocationStore ...
+func TestGormRevocationStore(t *testing.T) {
+
+	t.Run("Init", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("CREATE TABLE `revocation_records`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_revocation`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.MatchExpectationsInOrder(false)
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRevocationStore(db)
+		err = store.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("SaveRevocation", func(t *testing.T) {
+
+		key, cert, _, _ := newTestKeyAndCert(t)
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, peer.PeerId(uuid.New()))
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("INSERT INTO `revocation_records` (.+) ON CONFLICT DO NOTHING").
+			WithArgs(revocation.PeerId, revocation.PublicKey, revocation.Time, revocation.Issuer, revocation.Signature).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRevocationStore(db)
+		err = store.SaveRevocation(revocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("FindRevocations", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		issuer := []byte("issuer")
+		signature := []byte("signature")
+		revokedAt := time.Now().Unix()
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `revocation_records`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id", "public_key", "time", "issuer", "signature"}).
+				AddRow(1, peerId[:], nil, revokedAt, issuer, signature))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRevocationStore(db)
+		revocations, err := store.FindRevocations()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Len(t, revocations, 1, "Should find one revocation")
+		assert.Equal(t, peerId[:], revocations[0].PeerId, "PeerId should be same")
+		assert.Equal(t, revokedAt, revocations[0].Time, "Time should be same")
+		assert.Equal(t, issuer, revocations[0].Issuer, "Issuer should be same")
+		assert.Equal(t, signature, revocations[0].Signature, "Signature should be same")
+
+	})
+
+}
+
+// TestPeerRevoke ...
+func TestPeerRevoke(t *testing.T) {
+
+	t.Run("Revoke closes revoked and spreads to others", func(t *testing.T) {
+
+		key, cert, _, issuer := newTestKeyAndCert(t)
+		_, revokedCert, _, _ := newTestKeyAndCert(t)
+		_, otherCert, _, _ := newTestKeyAndCert(t)
+		revokedPeerId := peer.PeerId(uuid.New())
+		otherPeerId := peer.PeerId(uuid.New())
+
+		closed := make(chan struct{})
+		defer close(closed)
+
+		revokedNode := newEndorseNode(t, revokedCert)
+		revokedClosed := make(chan struct{})
+		revokedNode.On("AcceptNodeStream", mock.Anything).Once().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-revokedClosed
+		})
+		revokedNode.On("Close").Once().Return(nil).Run(func(args mock.Arguments) {
+			close(revokedClosed)
+		})
+
+		reqs := make(chan *peer.Revocations, 1)
+		otherNode := newEndorseNode(t, otherCert)
+		otherNode.On("AcceptNodeStream", mock.Anything).Once().Return(nil, net.ErrClosed).Run(func(args mock.Arguments) {
+			<-closed
+		})
+		otherNode.On("OpenNodeStream").Once().Return(newRevocationsStream(reqs), nil)
+
+		rl := peer.NewRevocationList(peer.NewMemoryRevocationStore(), [][]byte{issuer})
+		generator := new(mocked.MockPeerIdGenerator)
+		app := new(coreMocked.MockApp[peer.Context])
+		p := peer.New(uuid.New(), nil, app, generator, 0, peer.NewPeerWithRevocationList(rl))
+		go p.Accept(context.Background(), revokedNode, revokedPeerId)
+		go p.Accept(context.Background(), otherNode, otherPeerId)
+
+		assert.Eventually(t, func() bool {
+			return p.Stat(revokedPeerId) == peer.OnlinePeerState && p.Stat(otherPeerId) == peer.OnlinePeerState
+		}, time.Second, time.Millisecond, "Peers should be online after accept")
+
+		revocation, _ := peer.NewPeerIdRevocation(key, cert, revokedPeerId)
+		err := p.Revoke(context.Background(), revocation)
+
+		received := <-reqs
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, received.Revocations, 1, "Revocation should be spread")
+		assert.True(t, proto.Equal(revocation, received.Revocations[0]), "Revocation should be same")
+		assert.Eventually(t, func() bool {
+			return p.Stat(revokedPeerId) == peer.OfflinePeerState
+		}, time.Second, time.Millisecond, "Revoked peer should be offline")
+		revokedNode.AssertExpectations(t)
+		otherNode.AssertExpectations(t)
+	})
+
+}
@@ -0,0 +1,163 @@
+package peer
+
+import (
+	"bytes"
+	"pan/memory"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Route is a known address of a peer with its dial history.
+type Route struct {
+	PeerId      PeerId
+	NodeType    uint8
+	Addr        []byte
+	FailedNum   uint8
+	SucceededAt int64
+	FailedAt    int64
+}
+
+// Equal ...
+func (r *Route) Equal(nodeType uint8, addr []byte) bool {
+	return r.NodeType == nodeType && bytes.Equal(r.Addr, addr)
+}
+
+// RouteStore keeps the routes of peers, so that known peers can be
+// opened again after restart.
+type RouteStore interface {
+	Init() error
+	FindRoutes(peerId PeerId) ([]*Route, error)
+	SaveRoute(route *Route) error
+	RemoveRoute(route *Route) error
+}
+
+type memoryRouteStore struct {
+	bucket *memory.Bucket[*Route, PeerId]
+}
+
+// Init ...
+func (s *memoryRouteStore) Init() error {
+	return nil
+}
+
+// FindRoutes ...
+func (s *memoryRouteStore) FindRoutes(peerId PeerId) (routes []*Route, err error) {
+	items := s.bucket.FindBlockItems(peerId)
+	routes = make([]*Route, 0, len(items))
+	for _, item := range items {
+		if item.Expired() {
+			continue
+		}
+		route := *item.Value()
+		routes = append(routes, &route)
+	}
+	return
+}
+
+// SaveRoute ...
+func (s *memoryRouteStore) SaveRoute(route *Route) (err error) {
+	s.removeRoute(route)
+	value := *route
+	s.bucket.PutItem(route.PeerId, &value)
+	return
+}
+
+// RemoveRoute ...
+func (s *memoryRouteStore) RemoveRoute(route *Route) (err error) {
+	s.removeRoute(route)
+	return
+}
+
+// removeRoute ...
+func (s *memoryRouteStore) removeRoute(route *Route) {
+	items := s.bucket.FindBlockItems(route.PeerId)
+	for _, item := range items {
+		if item.Expired() == false && item.Value().Equal(route.NodeType, route.Addr) {
+			s.bucket.RemoveItem(item)
+		}
+	}
+}
+
+// NewMemoryRouteStore ...
+func NewMemoryRouteStore() RouteStore {
+	store := new(memoryRouteStore)
+	store.bucket = memory.NewBucket[*Route, PeerId](comparePeerId)
+	return store
+}
+
+// RouteRecord is the database row of a route.
+type RouteRecord struct {
+	ID          int64  `gorm:"primary_key;auto_increment"`
+	PeerId      []byte `gorm:"size:16;uniqueIndex:idx_route"`
+	NodeType    uint8  `gorm:"uniqueIndex:idx_route"`
+	Addr        []byte `gorm:"uniqueIndex:idx_route"`
+	FailedNum   uint8
+	SucceededAt int64
+	FailedAt    int64
+}
+
+type gormRouteStore struct {
+	db *gorm.DB
+}
+
+// Init ...
+func (s *gormRouteStore) Init() (err error) {
+	err = s.db.AutoMigrate(&RouteRecord{})
+	return
+}
+
+// FindRoutes ...
+func (s *gormRouteStore) FindRoutes(peerId PeerId) (routes []*Route, err error) {
+	records := make([]*RouteRecord, 0)
+	result := s.db.Where("peer_id = ?", peerId[:]).Find(&records)
+	err = result.Error
+	if err != nil {
+		return
+	}
+
+	routes = make([]*Route, 0, len(records))
+	for _, record := range records {
+		route := new(Route)
+		route.PeerId = peerId
+		route.NodeType = record.NodeType
+		route.Addr = record.Addr
+		route.FailedNum = record.FailedNum
+		route.SucceededAt = record.SucceededAt
+		route.FailedAt = record.FailedAt
+		routes = append(routes, route)
+	}
+	return
+}
+
+// SaveRoute ...
+func (s *gormRouteStore) SaveRoute(route *Route) (err error) {
+	record := new(RouteRecord)
+	record.PeerId = route.PeerId[:]
+	record.NodeType = route.NodeType
+	record.Addr = route.Addr
+	record.FailedNum = route.FailedNum
+	record.SucceededAt = route.SucceededAt
+	record.FailedAt = route.FailedAt
+
+	result := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "peer_id"}, {Name: "node_type"}, {Name: "addr"}},
+		DoUpdates: clause.AssignmentColumns([]string{"failed_num", "succeeded_at", "failed_at"}),
+	}).Create(record)
+	err = result.Error
+	return
+}
+
+// RemoveRoute ...
+func (s *gormRouteStore) RemoveRoute(route *Route) (err error) {
+	result := s.db.Where("peer_id = ? AND node_type = ? AND addr = ?", route.PeerId[:], route.NodeType, route.Addr).Delete(&RouteRecord{})
+	err = result.Error
+	return
+}
+
+// NewGormRouteStore ...
+func NewGormRouteStore(db *gorm.DB) RouteStore {
+	store := new(gormRouteStore)
+	store.db = db
+	return store
+}
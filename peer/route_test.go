@@ -0,0 +1,305 @@
+package peer_test
+
+import (
+	"errors"
+	"net"
+	"pan/peer"
+	"testing"
+	"time"
+
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestRoute ...
+func newTestRoute(peerId peer.PeerId, nodeType uint8, addr string) *peer.Route {
+	route := new(peer.Route)
+	route.PeerId = peerId
+	route.NodeType = nodeType
+	route.Addr = []byte(addr)
+	return route
+}
+
+// TestMemoryRouteStore ...
+func TestMemoryRouteStore(t *testing.T) {
+
+	t.Run("Save and Find", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		store := peer.NewMemoryRouteStore()
+		err := store.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		route := newTestRoute(peerId, peer.QUICNodeType, "127.0.0.1:9000")
+		err = store.SaveRoute(route)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		route.FailedNum = 2
+		routes, err := store.FindRoutes(peerId)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, routes, 1, "Should find one route")
+		assert.Equal(t, uint8(0), routes[0].FailedNum, "Saved route should be a copy")
+
+		err = store.SaveRoute(route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes, err = store.FindRoutes(peerId)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, routes, 1, "Same route should be replaced")
+		assert.Equal(t, uint8(2), routes[0].FailedNum, "FailedNum should be updated")
+
+		routes, err = store.FindRoutes(peer.PeerId(uuid.New()))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Empty(t, routes, "Unknown peer should have no routes")
+
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		store := peer.NewMemoryRouteStore()
+
+		quicRoute := newTestRoute(peerId, peer.QUICNodeType, "127.0.0.1:9000")
+		tcpRoute := newTestRoute(peerId, peer.TCPNodeType, "127.0.0.1:9000")
+		_ = store.SaveRoute(quicRoute)
+		_ = store.SaveRoute(tcpRoute)
+
+		err := store.RemoveRoute(quicRoute)
+		assert.Nil(t, err, "Error should be nil")
+
+		routes, err := store.FindRoutes(peerId)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, routes, 1, "Should keep one route")
+		assert.Equal(t, peer.TCPNodeType, routes[0].NodeType, "Tcp route should be kept")
+
+	})
+
+}
+
+// TestGormRouteStore ...
+func TestGormRouteStore(t *testing.T) {
+
+	t.Run("Init", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("CREATE TABLE `route_records`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE UNIQUE INDEX `idx_route`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.MatchExpectationsInOrder(false)
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRouteStore(db)
+		err = store.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("SaveRoute", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		route := newTestRoute(peerId, peer.TCPNodeType, "127.0.0.1:9000")
+		route.SucceededAt = time.Now().Unix()
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("INSERT INTO `route_records` (.+) ON CONFLICT").
+			WithArgs(peerId[:], route.NodeType, route.Addr, route.FailedNum, route.SucceededAt, route.FailedAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRouteStore(db)
+		err = store.SaveRoute(route)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+	t.Run("FindRoutes", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		addr := []byte("127.0.0.1:9000")
+		failedAt := time.Now().Unix()
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectQuery("SELECT (.+) FROM `route_records` WHERE peer_id = ?").
+			WithArgs(peerId[:]).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "peer_id", "node_type", "addr", "failed_num", "succeeded_at", "failed_at"}).
+				AddRow(1, peerId[:], peer.QUICNodeType, addr, 1, 0, failedAt))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRouteStore(db)
+		routes, err := store.FindRoutes(peerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+		assert.Len(t, routes, 1, "Should find one route")
+		assert.Equal(t, peerId, routes[0].PeerId, "PeerId should be same")
+		assert.Equal(t, peer.QUICNodeType, routes[0].NodeType, "NodeType should be same")
+		assert.Equal(t, addr, routes[0].Addr, "Addr should be same")
+		assert.Equal(t, uint8(1), routes[0].FailedNum, "FailedNum should be same")
+		assert.Equal(t, failedAt, routes[0].FailedAt, "FailedAt should be same")
+
+	})
+
+	t.Run("RemoveRoute", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		route := newTestRoute(peerId, peer.TCPNodeType, "127.0.0.1:9000")
+
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mockDB.Close()
+
+		mock.ExpectQuery("select sqlite_version()").WillReturnRows(sqlmock.NewRows([]string{""}).AddRow("3.8.10"))
+		mock.ExpectExec("DELETE FROM `route_records`").
+			WithArgs(peerId[:], route.NodeType, route.Addr).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		db, err := gorm.Open(sqlite.Dialector{Conn: mockDB}, &gorm.Config{SkipDefaultTransaction: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store := peer.NewGormRouteStore(db)
+		err = store.RemoveRoute(route)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+
+	})
+
+}
+
+// TestPeerWithRouteStore ...
+func TestPeerWithRouteStore(t *testing.T) {
+
+	t.Run("Open with known route", func(t *testing.T) {
+
+		baseId := uuid.New()
+		remoteBaseId := uuid.New()
+		peerId := peer.PeerId(uuid.New())
+		addr := []byte("127.0.0.1:9000")
+
+		store := peer.NewMemoryRouteStore()
+		_ = store.SaveRoute(newTestRoute(peerId, peer.TCPNodeType, string(addr)))
+
+		generator := new(mocked.MockPeerIdGenerator)
+		p := newAuthenticatePeer(t, baseId, generator, 1, peer.NewPeerWithRouteStore(store))
+
+		node := new(mocked.MockNode)
+		mockAuthenticate(t, node, remoteBaseId)
+		node.On("AcceptNodeStream", mock.Anything).Maybe().Return(nil, net.ErrClosed)
+		generator.On("Generate", remoteBaseId[:], node).Once().Return(peerId, nil)
+
+		dialer := new(mocked.MockNodeDialer)
+		dialer.On("Type").Return(peer.TCPNodeType)
+		dialer.On("Connect", addr).Once().Return(node, nil)
+		_ = p.Attach(dialer)
+
+		assert.Equal(t, peer.UnknownPeerState, p.Stat(peerId), "Known peer should be unknown state")
+
+		opened, err := p.Open(peerId)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, node, opened, "Node should be opened")
+
+		routes, _ := store.FindRoutes(peerId)
+		assert.Len(t, routes, 1, "Route should be kept")
+		assert.NotZero(t, routes[0].SucceededAt, "SucceededAt should be updated")
+
+		generator.AssertExpectations(t)
+		dialer.AssertExpectations(t)
+	})
+
+	t.Run("Open with failed route", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		addr := []byte("127.0.0.1:9000")
+
+		store := peer.NewMemoryRouteStore()
+		_ = store.SaveRoute(newTestRoute(peerId, peer.TCPNodeType, string(addr)))
+
+		p := peer.New(uuid.New(), nil, nil, nil, 1, peer.NewPeerWithRouteStore(store))
+
+		dialer := new(mocked.MockNodeDialer)
+		dialer.On("Type").Return(peer.TCPNodeType)
+		dialer.On("Connect", addr).Twice().Return(nil, errors.New("Refused"))
+		_ = p.Attach(dialer)
+
+		_, err := p.Open(peerId)
+		assert.NotNil(t, err, "Error should not be nil")
+
+		routes, _ := store.FindRoutes(peerId)
+		assert.Len(t, routes, 1, "Route should be kept")
+		assert.Equal(t, uint8(1), routes[0].FailedNum, "FailedNum should be increased")
+		assert.NotZero(t, routes[0].FailedAt, "FailedAt should be updated")
+
+		_, err = p.Open(peerId)
+		assert.NotNil(t, err, "Error should not be nil")
+
+		routes, _ = store.FindRoutes(peerId)
+		assert.Empty(t, routes, "Route should be removed after max failed num")
+
+		dialer.AssertExpectations(t)
+	})
+
+}
@@ -0,0 +1,137 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"pan/core"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const ProtobufContentType = "application/x-protobuf"
+
+type protoMessage[T any] interface {
+	*T
+	proto.Message
+}
+
+type RPCHandle[T any, R any] func(ctx Context, req *T) (*R, error)
+
+// NewRPCHandle wraps a typed handle, the request body is decoded into T
+// and the returned R is encoded as response body. Errors are returned to
+// the following handlers, so a *ResponseError keeps its code.
+func NewRPCHandle[T any, R any, PT protoMessage[T], PR protoMessage[R]](handle RPCHandle[T, R]) core.Handle[Context] {
+	return func(ctx Context, next core.Next) (err error) {
+
+		if isProtobufContentType(ctx.Header([]byte("Content-Type"))) == false {
+			err = NewReponseError(BadRequestErrorCode, "Unsupported Content Type")
+			return
+		}
+
+		body, err := readBody(ctx.Body())
+		if err != nil {
+			return
+		}
+
+		req := new(T)
+		err = proto.Unmarshal(body, PT(req))
+		if err != nil {
+			err = NewReponseError(BadRequestErrorCode, "Bad Request")
+			return
+		}
+
+		res, err := handle(ctx, req)
+		if err != nil {
+			return
+		}
+		if res == nil {
+			res = new(R)
+		}
+
+		resBody, err := proto.Marshal(PR(res))
+		if err != nil {
+			return
+		}
+
+		err = ctx.Respond(bytes.NewReader(resBody), newProtobufContentTypeHeader())
+		return
+	}
+}
+
+// HandleRPC registers the typed handle of method on app.
+func HandleRPC[T any, R any, PT protoMessage[T], PR protoMessage[R]](app core.App[Context], method []byte, handle RPCHandle[T, R]) {
+	app.UseFn(method, NewRPCHandle[T, R, PT, PR](handle))
+}
+
+// Call opens the peer and calls the typed handle of method.
+func Call[T any, R any, PT protoMessage[T], PR protoMessage[R]](p Peer, peerId PeerId, method []byte, req *T) (*R, error) {
+	return CallWithContext[T, R, PT, PR](context.Background(), p, peerId, method, req)
+}
+
+// CallWithContext is Call with the deadline and cancellation of ctx.
+func CallWithContext[T any, R any, PT protoMessage[T], PR protoMessage[R]](ctx context.Context, p Peer, peerId PeerId, method []byte, req *T) (res *R, err error) {
+
+	body, err := proto.Marshal(PT(req))
+	if err != nil {
+		return
+	}
+
+	node, err := p.Open(peerId)
+	if err != nil {
+		return
+	}
+
+	res, err = callNode[R, PR](ctx, p, node, method, body)
+	return
+}
+
+// callNode ...
+func callNode[R any, PR protoMessage[R]](ctx context.Context, p Peer, node Node, method []byte, body []byte) (res *R, err error) {
+
+	response, err := p.Request(ctx, node, bytes.NewReader(body), method, newProtobufContentTypeHeader())
+	if err != nil {
+		return
+	}
+
+	resBody, err := readBody(response.Body())
+	if err != nil {
+		return
+	}
+
+	if response.IsError() {
+		err = NewReponseError(response.Code(), string(resBody))
+		return
+	}
+
+	if isProtobufContentType(response.Header([]byte("Content-Type"))) == false {
+		err = errors.New("Unsupported Content Type")
+		return
+	}
+
+	res = new(R)
+	err = proto.Unmarshal(resBody, PR(res))
+	if err != nil {
+		res = nil
+	}
+	return
+}
+
+// newProtobufContentTypeHeader ...
+func newProtobufContentTypeHeader() *HeaderSegment {
+	return NewHeaderSegment([]byte("Content-Type"), []byte(ProtobufContentType))
+}
+
+// isProtobufContentType ...
+func isProtobufContentType(value []byte) bool {
+	return bytes.Equal(value, []byte(ProtobufContentType))
+}
+
+// readBody reads the whole body, a missing body is empty.
+func readBody(body io.Reader) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	return io.ReadAll(body)
+}
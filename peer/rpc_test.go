@@ -0,0 +1,173 @@
+package peer_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"pan/core"
+	"pan/peer"
+	"testing"
+
+	mocked "pan/mocks/pan/peer"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newRPCBody ...
+func newRPCBody(t *testing.T, value string) io.Reader {
+	body, err := proto.Marshal(wrapperspb.String(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(body)
+}
+
+// echoRPCHandle ...
+func echoRPCHandle(ctx peer.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	return wrapperspb.String("echo:" + req.GetValue()), nil
+}
+
+// TestRPC ...
+func TestRPC(t *testing.T) {
+
+	t.Run("Handle", func(t *testing.T) {
+
+		var resBody []byte
+		var resHeader *peer.HeaderSegment
+		ctx := new(mocked.MockContext)
+		ctx.On("Header", []byte("Content-Type")).Once().Return([]byte(peer.ProtobufContentType))
+		ctx.On("Body").Once().Return(newRPCBody(t, "hello"))
+		ctx.On("Respond", mock.Anything, mock.Anything).Once().Return(nil).Run(func(args mock.Arguments) {
+			resBody, _ = io.ReadAll(args.Get(0).(io.Reader))
+			resHeader = args.Get(1).(*peer.HeaderSegment)
+		})
+
+		handle := peer.NewRPCHandle(echoRPCHandle)
+		err := handle(ctx, func() error { return nil })
+
+		res := new(wrapperspb.StringValue)
+		_ = proto.Unmarshal(resBody, res)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "echo:hello", res.GetValue(), "Response value should be same")
+		assert.Equal(t, []byte("Content-Type"), resHeader.Name(), "Header name should be content type")
+		assert.Equal(t, []byte(peer.ProtobufContentType), resHeader.Value(), "Header value should be protobuf")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("Handle with unsupported content type", func(t *testing.T) {
+
+		ctx := new(mocked.MockContext)
+		ctx.On("Header", []byte("Content-Type")).Once().Return([]byte("text/plain"))
+
+		handle := peer.NewRPCHandle(echoRPCHandle)
+		err := handle(ctx, func() error { return nil })
+
+		var resErr *peer.ResponseError
+		assert.ErrorAs(t, err, &resErr, "Error should be response error")
+		assert.Equal(t, peer.BadRequestErrorCode, resErr.Code(), "Error code should be bad request")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("Handle with error", func(t *testing.T) {
+
+		terr := peer.NewReponseError(peer.ForbiddenErrorCode, "Forbidden")
+		ctx := new(mocked.MockContext)
+		ctx.On("Header", []byte("Content-Type")).Once().Return([]byte(peer.ProtobufContentType))
+		ctx.On("Body").Once().Return(newRPCBody(t, "hello"))
+
+		handle := peer.NewRPCHandle(func(ctx peer.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+			return nil, terr
+		})
+		err := handle(ctx, func() error { return nil })
+
+		assert.Equal(t, terr, err, "Error should be handle error")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("HandleRPC", func(t *testing.T) {
+
+		method := []byte("echo")
+		ctx := new(mocked.MockContext)
+		ctx.On("Method").Return(method)
+		ctx.On("Header", []byte("Content-Type")).Once().Return([]byte(peer.ProtobufContentType))
+		ctx.On("Body").Once().Return(newRPCBody(t, "hello"))
+		ctx.On("Respond", mock.Anything, mock.Anything).Once().Return(nil)
+
+		app := core.New[peer.Context]()
+		peer.HandleRPC(app, method, echoRPCHandle)
+		err := app.Run(ctx)
+
+		assert.Nil(t, err, "Error should be nil")
+		ctx.AssertExpectations(t)
+	})
+
+	t.Run("Call", func(t *testing.T) {
+
+		method := []byte("echo")
+		peerId := peer.PeerId(uuid.New())
+		node := new(mocked.MockNode)
+
+		var reqBody []byte
+		var reqHeader *peer.HeaderSegment
+		header := peer.NewHeaderSegment([]byte("Content-Type"), []byte(peer.ProtobufContentType))
+		response := peer.NewReponse(0, newRPCBody(t, "world"), header)
+		p := new(mocked.MockPeer)
+		p.On("Open", peerId).Once().Return(node, nil)
+		p.On("Request", mock.Anything, node, mock.Anything, method, mock.Anything).Once().Return(response, nil).Run(func(args mock.Arguments) {
+			reqBody, _ = io.ReadAll(args.Get(2).(io.Reader))
+			reqHeader = args.Get(4).(*peer.HeaderSegment)
+		})
+
+		res, err := peer.Call[wrapperspb.StringValue, wrapperspb.StringValue](p, peerId, method, wrapperspb.String("hello"))
+
+		req := new(wrapperspb.StringValue)
+		_ = proto.Unmarshal(reqBody, req)
+
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "world", res.GetValue(), "Response value should be same")
+		assert.Equal(t, "hello", req.GetValue(), "Request value should be same")
+		assert.Equal(t, []byte(peer.ProtobufContentType), reqHeader.Value(), "Request content type should be protobuf")
+		p.AssertExpectations(t)
+	})
+
+	t.Run("Call with response error", func(t *testing.T) {
+
+		method := []byte("echo")
+		peerId := peer.PeerId(uuid.New())
+		node := new(mocked.MockNode)
+
+		response := peer.NewReponse(peer.ForbiddenErrorCode, bytes.NewReader([]byte("Forbidden")))
+		p := new(mocked.MockPeer)
+		p.On("Open", peerId).Once().Return(node, nil)
+		p.On("Request", mock.Anything, node, mock.Anything, method, mock.Anything).Once().Return(response, nil)
+
+		res, err := peer.Call[wrapperspb.StringValue, wrapperspb.StringValue](p, peerId, method, wrapperspb.String("hello"))
+
+		var resErr *peer.ResponseError
+		assert.Nil(t, res, "Response should be nil")
+		assert.ErrorAs(t, err, &resErr, "Error should be response error")
+		assert.Equal(t, peer.ForbiddenErrorCode, resErr.Code(), "Error code should be same")
+		assert.Equal(t, "Forbidden", resErr.Error(), "Error message should be same")
+		p.AssertExpectations(t)
+	})
+
+	t.Run("Call with open error", func(t *testing.T) {
+
+		peerId := peer.PeerId(uuid.New())
+		terr := errors.New("Test Error")
+		p := new(mocked.MockPeer)
+		p.On("Open", peerId).Once().Return(nil, terr)
+
+		res, err := peer.Call[wrapperspb.StringValue, wrapperspb.StringValue](p, peerId, []byte("echo"), wrapperspb.String("hello"))
+
+		assert.Nil(t, res, "Response should be nil")
+		assert.Equal(t, terr, err, "Error should be open error")
+		p.AssertExpectations(t)
+	})
+
+}
@@ -3,14 +3,19 @@ package peer
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
 const (
 	HeaderSegmentType = uint8(iota)
 	BodySegmentType
+	TrailerSegmentType
 )
 
+// MaxBodyChunkSize is the max data size of one body chunk.
+const MaxBodyChunkSize = 32 * 1024
+
 type HeaderSegment struct {
 	name  []byte
 	value []byte
@@ -113,3 +118,184 @@ func CreateHeaderSegmentField(data []byte) (sr io.Reader, dr io.Reader) {
 
 	return
 }
+
+// CreateBodySegment encodes body as chunks of [size uint32][data], a zero
+// size chunk ends the body and is followed by trailer segments. trailers is
+// called once the body reached EOF, so trailers computed while streaming
+// the body are sent too.
+//
+// The encoder holds at most one chunk and reads the next chunk from body
+// only after the previous one was consumed, so there is no flow control
+// frame in the body segment: the windows of the node stream (the per-stream
+// window of TCP, the stream flow control of QUIC) hold back a writer whose
+// peer doesn't read.
+func CreateBodySegment(body io.Reader, trailers func() []*HeaderSegment) io.Reader {
+	encoder := new(bodySegmentEncoder)
+	encoder.body = body
+	encoder.trailers = trailers
+	encoder.buf = make([]byte, 4+MaxBodyChunkSize)
+	return encoder
+}
+
+type bodySegmentEncoder struct {
+	body     io.Reader
+	trailers func() []*HeaderSegment
+	buf      []byte
+	pending  io.Reader
+	done     bool
+}
+
+// Read ...
+func (e *bodySegmentEncoder) Read(p []byte) (n int, err error) {
+	for {
+		if e.pending != nil {
+			n, err = e.pending.Read(p)
+			if err == io.EOF {
+				e.pending = nil
+				err = nil
+			}
+			if n > 0 || err != nil {
+				return
+			}
+			continue
+		}
+
+		if e.done {
+			err = io.EOF
+			return
+		}
+
+		e.pending, err = e.next()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next ...
+func (e *bodySegmentEncoder) next() (chunk io.Reader, err error) {
+
+	num, err := e.body.Read(e.buf[4:])
+	if num > 0 {
+		binary.BigEndian.PutUint32(e.buf, uint32(num))
+		chunk = bytes.NewReader(e.buf[:4+num])
+		err = nil
+		return
+	}
+
+	if err == nil {
+		chunk = bytes.NewReader(nil)
+		return
+	}
+
+	if err != io.EOF {
+		return
+	}
+
+	e.done = true
+	err = nil
+	readers := []io.Reader{bytes.NewReader(make([]byte, 4))}
+	if e.trailers != nil {
+		for _, trailer := range e.trailers() {
+			readers = append(readers, CreateSegmentType(TrailerSegmentType))
+			readers = append(readers, CreateHeaderSegment(trailer)...)
+		}
+	}
+	chunk = io.MultiReader(readers...)
+	return
+}
+
+type BodySegmentReader struct {
+	reader   io.Reader
+	remain   int
+	trailers []*HeaderSegment
+	err      error
+}
+
+// Read ...
+func (r *BodySegmentReader) Read(p []byte) (n int, err error) {
+
+	if r.err != nil {
+		err = r.err
+		return
+	}
+
+	for r.remain <= 0 {
+		size := uint32(0)
+		err = binary.Read(r.reader, binary.BigEndian, &size)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			r.err = err
+			return
+		}
+		if size == 0 {
+			r.err = r.parseTrailers()
+			err = r.err
+			return
+		}
+		r.remain = int(size)
+	}
+
+	if len(p) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err = r.reader.Read(p)
+	r.remain -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		r.err = err
+	}
+	return
+}
+
+// Trailers returns the trailers, they are available once the body is read
+// to EOF.
+func (r *BodySegmentReader) Trailers() []*HeaderSegment {
+	return r.trailers
+}
+
+// parseTrailers ...
+func (r *BodySegmentReader) parseTrailers() (err error) {
+	trailers := make([]*HeaderSegment, 0)
+	for {
+		segmentType, typeErr := ParseSegmentType(r.reader)
+		if typeErr != nil {
+			break
+		}
+		if segmentType != TrailerSegmentType {
+			return errors.New("Invalid Trailer Segment")
+		}
+		trailer, err := ParseHeaderSegment(r.reader)
+		if err != nil {
+			return err
+		}
+		trailers = append(trailers, trailer)
+	}
+
+	if len(trailers) > 0 {
+		r.trailers = trailers
+	}
+	return io.EOF
+}
+
+// ParseBodySegment decodes the chunks that follow a BodySegmentType.
+func ParseBodySegment(reader io.Reader) *BodySegmentReader {
+	body := new(BodySegmentReader)
+	body.reader = reader
+	return body
+}
+
+// findHeader ...
+func findHeader(headers []*HeaderSegment, name []byte) (value []byte) {
+	for _, header := range headers {
+		if bytes.Equal(header.Name(), name) {
+			value = header.Value()
+			break
+		}
+	}
+	return
+}
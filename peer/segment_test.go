@@ -78,4 +78,97 @@ func TestSegment(t *testing.T) {
 		assert.Equal(t, field, pField, "Field Should be same")
 	})
 
+	t.Run("CreateBodySegment and ParseBodySegment", func(t *testing.T) {
+		body := make([]byte, peer.MaxBodyChunkSize*2+64)
+		rand.Read(body)
+		trailer := peer.NewHeaderSegment([]byte("Checksum"), []byte("abc"))
+
+		reader := peer.CreateBodySegment(bytes.NewReader(body), func() []*peer.HeaderSegment {
+			return []*peer.HeaderSegment{trailer}
+		})
+		bodyReader := peer.ParseBodySegment(reader)
+		assert.Nil(t, bodyReader.Trailers(), "Trailers Should be nil before EOF")
+
+		pBody, err := io.ReadAll(bodyReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trailers := bodyReader.Trailers()
+		assert.Equal(t, body, pBody, "Body Should be same")
+		assert.Len(t, trailers, 1, "Trailers Should has one")
+		assert.Equal(t, trailer.Name(), trailers[0].Name(), "Trailer Name Should be same")
+		assert.Equal(t, trailer.Value(), trailers[0].Value(), "Trailer Value Should be same")
+	})
+
+	t.Run("ParseBodySegment with end of body", func(t *testing.T) {
+		body := []byte("body")
+		encoded, err := io.ReadAll(peer.CreateBodySegment(bytes.NewReader(body), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := []byte("next")
+		reader := bytes.NewReader(append(encoded, next...))
+
+		bodyReader := peer.ParseBodySegment(io.LimitReader(reader, int64(len(encoded))))
+		pBody, err := io.ReadAll(bodyReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest, _ := io.ReadAll(reader)
+
+		assert.Equal(t, body, pBody, "Body Should be same")
+		assert.Nil(t, bodyReader.Trailers(), "Trailers Should be nil")
+		assert.Equal(t, next, rest, "Data after the body Should not be read")
+	})
+
+	t.Run("ParseBodySegment with truncated body", func(t *testing.T) {
+		body := make([]byte, 64)
+		rand.Read(body)
+		encoded, err := io.ReadAll(peer.CreateBodySegment(bytes.NewReader(body), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodyReader := peer.ParseBodySegment(bytes.NewReader(encoded[:32]))
+		_, err = io.ReadAll(bodyReader)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "Error Should be unexpected EOF")
+	})
+
+	t.Run("CreateBodySegment reads body chunk by chunk", func(t *testing.T) {
+		content := make([]byte, peer.MaxBodyChunkSize*4)
+		rand.Read(content)
+		body := &countReader{Reader: bytes.NewReader(content)}
+
+		reader := peer.CreateBodySegment(body, nil)
+		buf := make([]byte, 16)
+		_, err := io.ReadFull(reader, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, body.reads, "Body should be read one chunk only")
+		assert.Equal(t, peer.MaxBodyChunkSize, body.total, "Body should be read no more than one chunk")
+
+		rest, err := io.ReadAll(peer.ParseBodySegment(io.MultiReader(bytes.NewReader(buf), reader)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, content, rest, "Body content should be same")
+
+	})
+
+}
+
+type countReader struct {
+	io.Reader
+	reads int
+	total int
+}
+
+// Read ...
+func (r *countReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	r.reads++
+	r.total += n
+	return
 }
@@ -0,0 +1,616 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	tcpOpenFrameType = uint8(iota)
+	tcpDataFrameType
+	tcpFinFrameType
+	tcpResetFrameType
+	tcpStopFrameType
+	tcpWindowFrameType
+)
+
+const (
+	tcpFrameHeaderSize     = 7
+	tcpMaxFramePayload     = 16 * 1024
+	tcpStreamWindow        = 256 * 1024
+	tcpAcceptBacklog       = 64
+	tcpHandshakeTimeout    = 10 * time.Second
+	tcpClientFirstStreamId = uint32(1)
+	tcpServeFirstStreamId  = uint32(2)
+)
+
+var (
+	errTCPStreamReset   = errors.New("Stream Reset")
+	errTCPStreamStopped = errors.New("Stream Stopped")
+	errTCPStreamClosed  = errors.New("Stream Closed")
+	errTCPStreamRefused = errors.New("Stream Refused")
+	errTCPFlowControl   = errors.New("Flow Control Error")
+)
+
+type tcpNodeServeSt struct {
+	listener net.Listener
+	nodes    chan Node
+	done     chan struct{}
+	once     *sync.Once
+}
+
+// Accept ...
+func (ns *tcpNodeServeSt) Accept(ctx context.Context) (Node, error) {
+	select {
+	case node := <-ns.nodes:
+		return node, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-ns.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close ...
+func (ns *tcpNodeServeSt) Close() (err error) {
+	ns.once.Do(func() {
+		close(ns.done)
+		err = ns.listener.Close()
+	})
+	return
+}
+
+// serve ...
+func (ns *tcpNodeServeSt) serve() {
+	for {
+		conn, err := ns.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			continue
+		}
+		go ns.handshake(conn.(*tls.Conn))
+	}
+}
+
+// handshake ...
+func (ns *tcpNodeServeSt) handshake(conn *tls.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), tcpHandshakeTimeout)
+	defer cancel()
+
+	err := conn.HandshakeContext(ctx)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	node := newTCPNode(conn, tcpServeFirstStreamId)
+	select {
+	case ns.nodes <- node:
+	case <-ns.done:
+		_ = node.Close()
+	}
+}
+
+type tcpNodeSt struct {
+	conn    *tls.Conn
+	streams map[uint32]*tcpNodeStreamSt
+	accepts chan *tcpNodeStreamSt
+	nextId  uint32
+	rw      *sync.RWMutex
+	wmu     *sync.Mutex
+	done    chan struct{}
+	once    *sync.Once
+	err     error
+}
+
+// Type ...
+func (n *tcpNodeSt) Type() uint8 {
+	return TCPNodeType
+}
+
+// Addr ...
+func (n *tcpNodeSt) Addr() []byte {
+	addr := n.conn.RemoteAddr()
+	tcpAddr, _ := net.ResolveTCPAddr(addr.Network(), addr.String())
+	return MarshalTCPAddr(tcpAddr)
+}
+
+// Certificate ...
+func (n *tcpNodeSt) Certificate() *x509.Certificate {
+	state := n.conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// AcceptNodeStream ...
+func (n *tcpNodeSt) AcceptNodeStream(ctx context.Context) (NodeStream, error) {
+	select {
+	case stream := <-n.accepts:
+		return stream, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-n.done:
+		return nil, n.err
+	}
+}
+
+// OpenNodeStream ...
+func (n *tcpNodeSt) OpenNodeStream() (NodeStream, error) {
+
+	n.rw.Lock()
+	select {
+	case <-n.done:
+		n.rw.Unlock()
+		return nil, n.err
+	default:
+	}
+	stream := newTCPNodeStream(n, n.nextId)
+	n.streams[stream.id] = stream
+	n.nextId += 2
+	n.rw.Unlock()
+
+	err := n.writeFrame(tcpOpenFrameType, stream.id, nil)
+	if err != nil {
+		n.release(stream.id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Close ...
+func (n *tcpNodeSt) Close() error {
+	n.shutdown(net.ErrClosed)
+	return nil
+}
+
+// shutdown ...
+func (n *tcpNodeSt) shutdown(err error) {
+	n.once.Do(func() {
+		n.rw.Lock()
+		n.err = err
+		close(n.done)
+		streams := n.streams
+		n.streams = make(map[uint32]*tcpNodeStreamSt)
+		n.rw.Unlock()
+
+		_ = n.conn.Close()
+		for _, stream := range streams {
+			stream.abort(err)
+		}
+	})
+}
+
+// serve ...
+func (n *tcpNodeSt) serve() {
+	header := make([]byte, tcpFrameHeaderSize)
+	for {
+		_, err := io.ReadFull(n.conn, header)
+		if err != nil {
+			n.shutdown(net.ErrClosed)
+			return
+		}
+
+		frameType := header[0]
+		id := binary.BigEndian.Uint32(header[1:5])
+		size := binary.BigEndian.Uint16(header[5:])
+
+		var payload []byte
+		if size > 0 {
+			payload = make([]byte, size)
+			_, err = io.ReadFull(n.conn, payload)
+			if err != nil {
+				n.shutdown(net.ErrClosed)
+				return
+			}
+		}
+
+		if frameType == tcpOpenFrameType {
+			n.accept(id)
+			continue
+		}
+
+		n.rw.RLock()
+		stream, ok := n.streams[id]
+		n.rw.RUnlock()
+		if ok == false {
+			continue
+		}
+
+		switch frameType {
+		case tcpDataFrameType:
+			stream.push(payload)
+		case tcpWindowFrameType:
+			if len(payload) == 4 {
+				stream.grow(int(binary.BigEndian.Uint32(payload)))
+			}
+		case tcpFinFrameType:
+			stream.finishRead(io.EOF)
+		case tcpResetFrameType:
+			stream.finishRead(errTCPStreamReset)
+		case tcpStopFrameType:
+			stream.finishWrite(errTCPStreamStopped)
+		}
+	}
+}
+
+// accept queues the stream opened by the remote side. The read loop never
+// waits for AcceptNodeStream, a stream is refused when the queue is full, so
+// the other streams of the connection keep flowing.
+func (n *tcpNodeSt) accept(id uint32) {
+	stream := newTCPNodeStream(n, id)
+
+	n.rw.Lock()
+	_, existed := n.streams[id]
+	if existed {
+		n.rw.Unlock()
+		return
+	}
+	select {
+	case n.accepts <- stream:
+		n.streams[id] = stream
+	default:
+		stream = nil
+	}
+	n.rw.Unlock()
+
+	if stream == nil {
+		go n.refuse(id)
+	}
+}
+
+// refuse resets both sides of the stream, the remote side reads and writes
+// errTCPStreamReset and errTCPStreamStopped.
+func (n *tcpNodeSt) refuse(id uint32) {
+	if n.writeFrame(tcpResetFrameType, id, nil) == nil {
+		_ = n.writeFrame(tcpStopFrameType, id, nil)
+	}
+}
+
+// release ...
+func (n *tcpNodeSt) release(id uint32) {
+	n.rw.Lock()
+	delete(n.streams, id)
+	n.rw.Unlock()
+}
+
+// writeFrame ...
+func (n *tcpNodeSt) writeFrame(frameType uint8, id uint32, payload []byte) (err error) {
+	frame := make([]byte, tcpFrameHeaderSize+len(payload))
+	frame[0] = frameType
+	binary.BigEndian.PutUint32(frame[1:5], id)
+	binary.BigEndian.PutUint16(frame[5:tcpFrameHeaderSize], uint16(len(payload)))
+	copy(frame[tcpFrameHeaderSize:], payload)
+
+	n.wmu.Lock()
+	_, err = n.conn.Write(frame)
+	n.wmu.Unlock()
+
+	if err != nil {
+		n.shutdown(net.ErrClosed)
+	}
+	return
+}
+
+// newTCPNode ...
+func newTCPNode(conn *tls.Conn, firstStreamId uint32) *tcpNodeSt {
+	node := new(tcpNodeSt)
+	node.conn = conn
+	node.streams = make(map[uint32]*tcpNodeStreamSt)
+	node.accepts = make(chan *tcpNodeStreamSt, tcpAcceptBacklog)
+	node.nextId = firstStreamId
+	node.rw = new(sync.RWMutex)
+	node.wmu = new(sync.Mutex)
+	node.done = make(chan struct{})
+	node.once = new(sync.Once)
+
+	go node.serve()
+	return node
+}
+
+// tcpNodeStreamSt is a stream with credit based flow control. The receive
+// buffer holds at most tcpStreamWindow bytes, the reader grants the consumed
+// bytes back to the writer by window frames, and the writer waits while its
+// window is empty.
+type tcpNodeStreamSt struct {
+	id           uint32
+	node         *tcpNodeSt
+	mu           *sync.Mutex
+	buf          *bytes.Buffer
+	notify       chan struct{}
+	readErr      error
+	writeErr     error
+	sendWindow   int
+	consumed     int
+	windowNotify chan struct{}
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+// Read ...
+func (ns *tcpNodeStreamSt) Read(p []byte) (int, error) {
+	for {
+		ns.mu.Lock()
+		if ns.buf.Len() > 0 {
+			num, _ := ns.buf.Read(p)
+			ns.consumed += num
+			var increment int
+			if ns.consumed >= tcpStreamWindow/2 && ns.readErr == nil {
+				increment = ns.consumed
+				ns.consumed = 0
+			}
+			ns.mu.Unlock()
+
+			if increment > 0 {
+				payload := binary.BigEndian.AppendUint32(nil, uint32(increment))
+				_ = ns.node.writeFrame(tcpWindowFrameType, ns.id, payload)
+			}
+			return num, nil
+		}
+		err := ns.readErr
+		ns.mu.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+		<-ns.notify
+	}
+}
+
+// Write waits for the window of the remote side, so a slow reader holds
+// back the writer instead of buffering without limit.
+func (ns *tcpNodeStreamSt) Write(p []byte) (total int, err error) {
+	for len(p) > 0 {
+		ns.mu.Lock()
+		err = ns.writeErr
+		window := ns.sendWindow
+		size := min(len(p), tcpMaxFramePayload, window)
+		ns.sendWindow -= size
+		ns.mu.Unlock()
+		if err != nil {
+			return
+		}
+		if size == 0 {
+			<-ns.windowNotify
+			continue
+		}
+
+		err = ns.node.writeFrame(tcpDataFrameType, ns.id, p[:size])
+		if err != nil {
+			return
+		}
+		total += size
+		p = p[size:]
+	}
+	return
+}
+
+// Context ...
+func (ns *tcpNodeStreamSt) Context() context.Context {
+	return ns.ctx
+}
+
+// Close ...
+func (ns *tcpNodeStreamSt) Close() error {
+	return ns.closeWrite(tcpFinFrameType)
+}
+
+// CloseWrite ...
+func (ns *tcpNodeStreamSt) CloseWrite() error {
+	return ns.closeWrite(tcpResetFrameType)
+}
+
+// CloseRead ...
+func (ns *tcpNodeStreamSt) CloseRead() error {
+	ns.mu.Lock()
+	if ns.readErr != nil {
+		ns.mu.Unlock()
+		return nil
+	}
+	ns.readErr = errTCPStreamClosed
+	ns.buf.Reset()
+	ns.mu.Unlock()
+
+	ns.signal()
+	ns.releaseIfDone()
+	return ns.node.writeFrame(tcpStopFrameType, ns.id, nil)
+}
+
+// closeWrite ...
+func (ns *tcpNodeStreamSt) closeWrite(frameType uint8) error {
+	ns.mu.Lock()
+	if ns.writeErr != nil {
+		ns.mu.Unlock()
+		return nil
+	}
+	ns.writeErr = errTCPStreamClosed
+	ns.mu.Unlock()
+
+	ns.cancel()
+	ns.releaseIfDone()
+	return ns.node.writeFrame(frameType, ns.id, nil)
+}
+
+// push buffers the payload, a remote side which writes beyond the window
+// breaks the flow control and the stream is reset.
+func (ns *tcpNodeStreamSt) push(payload []byte) {
+	ns.mu.Lock()
+	overflow := ns.buf.Len()+len(payload) > tcpStreamWindow
+	if ns.readErr == nil && overflow == false {
+		ns.buf.Write(payload)
+	}
+	ns.mu.Unlock()
+
+	if overflow {
+		ns.finishRead(errTCPFlowControl)
+		go ns.node.refuse(ns.id)
+		return
+	}
+	ns.signal()
+}
+
+// grow adds the bytes granted by the remote side to the window.
+func (ns *tcpNodeStreamSt) grow(increment int) {
+	ns.mu.Lock()
+	ns.sendWindow += increment
+	ns.mu.Unlock()
+	ns.signalWindow()
+}
+
+// finishRead ...
+func (ns *tcpNodeStreamSt) finishRead(err error) {
+	ns.mu.Lock()
+	if ns.readErr == nil {
+		ns.readErr = err
+	}
+	ns.mu.Unlock()
+	ns.signal()
+	ns.releaseIfDone()
+}
+
+// finishWrite ...
+func (ns *tcpNodeStreamSt) finishWrite(err error) {
+	ns.mu.Lock()
+	if ns.writeErr == nil {
+		ns.writeErr = err
+	}
+	ns.mu.Unlock()
+	ns.cancel()
+	ns.signalWindow()
+	ns.releaseIfDone()
+}
+
+// abort ...
+func (ns *tcpNodeStreamSt) abort(err error) {
+	ns.mu.Lock()
+	if ns.readErr == nil {
+		ns.readErr = err
+	}
+	if ns.writeErr == nil {
+		ns.writeErr = err
+	}
+	ns.mu.Unlock()
+	ns.cancel()
+	ns.signal()
+	ns.signalWindow()
+}
+
+// signal ...
+func (ns *tcpNodeStreamSt) signal() {
+	select {
+	case ns.notify <- struct{}{}:
+	default:
+	}
+}
+
+// signalWindow wakes up the writer waiting for the window.
+func (ns *tcpNodeStreamSt) signalWindow() {
+	select {
+	case ns.windowNotify <- struct{}{}:
+	default:
+	}
+}
+
+// releaseIfDone ...
+func (ns *tcpNodeStreamSt) releaseIfDone() {
+	ns.mu.Lock()
+	done := ns.readErr != nil && ns.writeErr != nil
+	ns.mu.Unlock()
+
+	if done {
+		ns.node.release(ns.id)
+	}
+}
+
+// newTCPNodeStream ...
+func newTCPNodeStream(node *tcpNodeSt, id uint32) *tcpNodeStreamSt {
+	stream := new(tcpNodeStreamSt)
+	stream.id = id
+	stream.node = node
+	stream.mu = new(sync.Mutex)
+	stream.buf = new(bytes.Buffer)
+	stream.notify = make(chan struct{}, 1)
+	stream.sendWindow = tcpStreamWindow
+	stream.windowNotify = make(chan struct{}, 1)
+	stream.ctx, stream.cancel = context.WithCancel(context.Background())
+	return stream
+}
+
+type tcpNodeDialerSt struct {
+	tls *tls.Config
+	ctx context.Context
+}
+
+// Type ...
+func (nd *tcpNodeDialerSt) Type() uint8 {
+	return TCPNodeType
+}
+
+// Connect ...
+func (nd *tcpNodeDialerSt) Connect(addr []byte) (node Node, err error) {
+	tcpAddr, err := UnmarshalTCPAddr(addr)
+	if err == nil {
+		node, err = DialTCPNode(tcpAddr, nd.tls, nd.ctx)
+	}
+	return
+}
+
+// NewTCPNodeDialer ...
+func NewTCPNodeDialer(tls *tls.Config, ctx context.Context) NodeDialer {
+	dialer := new(tcpNodeDialerSt)
+	dialer.tls = tls
+	dialer.ctx = ctx
+	return dialer
+}
+
+// ServeTCPNode ...
+func ServeTCPNode(addr *net.TCPAddr, tlsConf *tls.Config) (NodeServe, error) {
+	tcpListener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	serve := new(tcpNodeServeSt)
+	serve.listener = tls.NewListener(tcpListener, tlsConf)
+	serve.nodes = make(chan Node)
+	serve.done = make(chan struct{})
+	serve.once = new(sync.Once)
+
+	go serve.serve()
+	return serve, nil
+}
+
+// DialTCPNode ...
+func DialTCPNode(addr *net.TCPAddr, tlsConf *tls.Config, ctx context.Context) (Node, error) {
+	dialer := &tls.Dialer{Config: tlsConf}
+	conn, err := dialer.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return newTCPNode(conn.(*tls.Conn), tcpClientFirstStreamId), nil
+}
+
+// MarshalTCPAddr ...
+func MarshalTCPAddr(addr *net.TCPAddr) []byte {
+	addrstr := addr.String()
+	return []byte(addrstr)
+}
+
+// UnmarshalTCPAddr ...
+func UnmarshalTCPAddr(payload []byte) (addr *net.TCPAddr, err error) {
+	addrstr := string(payload)
+	addr, err = net.ResolveTCPAddr("tcp", addrstr)
+	return
+}
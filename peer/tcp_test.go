@@ -0,0 +1,388 @@
+package peer_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"pan/peer"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveAndDialTCPNode ...
+func serveAndDialTCPNode(t *testing.T, addr *net.TCPAddr) (serve peer.NodeServe, node peer.Node, dialNode peer.Node) {
+
+	serveTlsConf, _ := newTLSConf(false)
+	serve, err := peer.ServeTCPNode(addr, serveTlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	var acceptErr error
+	go func() {
+		defer wg.Done()
+		node, acceptErr = serve.Accept(context.Background())
+	}()
+
+	clientTlsConf, _ := newTLSConf(true)
+	timeOutCtx, timeOutCancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer timeOutCancel()
+	dialNode, err = peer.DialTCPNode(addr, clientTlsConf, timeOutCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Wait()
+	if acceptErr != nil {
+		t.Fatal(acceptErr)
+	}
+	return
+}
+
+// TestTCPNode ...
+func TestTCPNode(t *testing.T) {
+
+	t.Run("Serve and Dial success", func(t *testing.T) {
+		serveTlsConf, serveCert := newTLSConf(false)
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, err := peer.ServeTCPNode(addr, serveTlsConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		var node peer.Node
+		var acceptErr error
+		go func() {
+			defer wg.Done()
+			node, acceptErr = serve.Accept(context.Background())
+		}()
+
+		clientTlsConf, clientCert := newTLSConf(true)
+		timeOutCtx, timeOutCancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer timeOutCancel()
+		dialNode, err := peer.DialTCPNode(addr, clientTlsConf, timeOutCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialNode.Close()
+
+		wg.Wait()
+		if acceptErr != nil {
+			t.Fatal(acceptErr)
+		}
+		defer node.Close()
+
+		nodeCert := node.Certificate()
+		dialNodeCert := dialNode.Certificate()
+
+		assert.Equal(t, peer.TCPNodeType, node.Type(), "Node type should be tcp")
+		assert.Equal(t, peer.TCPNodeType, dialNode.Type(), "Dial node type should be tcp")
+		assert.Equal(t, peer.MarshalTCPAddr(addr), dialNode.Addr(), "Dial node addr should be serve addr")
+		assert.Equal(t, serveCert.PublicKey, dialNodeCert.PublicKey, "Serve public key should be same")
+		assert.Equal(t, serveCert.Signature, dialNodeCert.Signature, "Serve signature should be same")
+		assert.Equal(t, clientCert.PublicKey, nodeCert.PublicKey, "Client public key should be same")
+		assert.Equal(t, clientCert.Signature, nodeCert.Signature, "Client signature should be same")
+
+		wg = sync.WaitGroup{}
+		wg.Add(1)
+		var stream peer.NodeStream
+		go func() {
+			defer wg.Done()
+			stream, acceptErr = node.AcceptNodeStream(context.Background())
+		}()
+
+		dialStream, err := dialNode.OpenNodeStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content := "Request Content"
+		io.WriteString(dialStream, content)
+		err = dialStream.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Wait()
+		if acceptErr != nil {
+			t.Fatal(acceptErr)
+		}
+
+		buf, err := io.ReadAll(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, content, string(buf), "Stream request content should be same")
+
+		resContent := "Response Content"
+		io.WriteString(stream, resContent)
+		err = stream.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resBuf, err := io.ReadAll(dialStream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, resContent, string(resBuf), "Stream response content should be same")
+
+	})
+
+	t.Run("Multiplex streams", func(t *testing.T) {
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, node, dialNode := serveAndDialTCPNode(t, addr)
+		defer serve.Close()
+		defer node.Close()
+		defer dialNode.Close()
+
+		go func() {
+			for {
+				stream, err := node.AcceptNodeStream(context.Background())
+				if err != nil {
+					return
+				}
+				go func() {
+					buf, _ := io.ReadAll(stream)
+					stream.Write(buf)
+					stream.Close()
+				}()
+			}
+		}()
+
+		total := 8
+		results := make([][]byte, total)
+		wg := sync.WaitGroup{}
+		wg.Add(total)
+		for i := 0; i < total; i++ {
+			go func(i int) {
+				defer wg.Done()
+				stream, err := dialNode.OpenNodeStream()
+				if err != nil {
+					return
+				}
+				content := fmt.Sprintf("Stream Content %d", i)
+				for j := 0; j < 1024; j++ {
+					io.WriteString(stream, content)
+				}
+				stream.Close()
+				results[i], _ = io.ReadAll(stream)
+			}(i)
+		}
+		wg.Wait()
+
+		for i, result := range results {
+			content := fmt.Sprintf("Stream Content %d", i)
+			assert.Equal(t, len(content)*1024, len(result), "Stream content size should be same")
+			assert.Equal(t, content, string(result[:len(content)]), "Stream content should be same")
+		}
+
+	})
+
+	t.Run("MarshalTCPAddr and UnmarshalTCPAddr", func(t *testing.T) {
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload := peer.MarshalTCPAddr(addr)
+		tcpAddr, err := peer.UnmarshalTCPAddr(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, addr.Network(), tcpAddr.Network(), "Network should be tcp")
+		assert.Equal(t, addr.String(), tcpAddr.String(), "Addr should be same")
+
+	})
+
+	t.Run("NodeDialer", func(t *testing.T) {
+		serveTlsConf, _ := newTLSConf(false)
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, err := peer.ServeTCPNode(addr, serveTlsConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serve.Close()
+
+		clientTlsConf, _ := newTLSConf(true)
+		timeOutCtx, timeOutCancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer timeOutCancel()
+		dialer := peer.NewTCPNodeDialer(clientTlsConf, timeOutCtx)
+
+		dialNode, err := dialer.Connect(peer.MarshalTCPAddr(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialNode.Close()
+
+		node, err := serve.Accept(timeOutCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer node.Close()
+
+		assert.Equal(t, peer.TCPNodeType, dialer.Type(), "Dialer type should be tcp")
+		assert.NotNil(t, node, "Node should not be nil")
+
+	})
+
+	t.Run("NodeStream CloseRead", func(t *testing.T) {
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, node, dialNode := serveAndDialTCPNode(t, addr)
+		defer serve.Close()
+		defer node.Close()
+		defer dialNode.Close()
+
+		dialStream, err := dialNode.OpenNodeStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream, err := node.AcceptNodeStream(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = stream.CloseRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Eventually(t, func() bool {
+			_, err := io.WriteString(dialStream, "reader header")
+			return err != nil
+		}, time.Second, time.Millisecond*10, "Write should fail after remote CloseRead")
+
+		streamCtx, ok := dialStream.(peer.NodeStreamContext)
+		assert.True(t, ok, "Stream should have context")
+		assert.ErrorIs(t, streamCtx.Context().Err(), context.Canceled, "Stream context should be canceled")
+
+	})
+
+	t.Run("Window backpressure", func(t *testing.T) {
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, node, dialNode := serveAndDialTCPNode(t, addr)
+		defer serve.Close()
+		defer node.Close()
+		defer dialNode.Close()
+
+		dialStream, err := dialNode.OpenNodeStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content := make([]byte, 1024*1024)
+		written := make(chan error, 1)
+		go func() {
+			_, err := dialStream.Write(content)
+			dialStream.Close()
+			written <- err
+		}()
+
+		stream, err := node.AcceptNodeStream(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-written:
+			t.Fatal("Write should wait for the window of the reader")
+		case <-time.After(time.Millisecond * 200):
+		}
+
+		buf, err := io.ReadAll(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, <-written, "Write should succeed after read")
+		assert.Equal(t, len(content), len(buf), "Stream content size should be same")
+
+	})
+
+	t.Run("Refuse stream when accept queue is full", func(t *testing.T) {
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, node, dialNode := serveAndDialTCPNode(t, addr)
+		defer serve.Close()
+		defer node.Close()
+		defer dialNode.Close()
+
+		var dialStream peer.NodeStream
+		for i := 0; i <= 64; i++ {
+			dialStream, err = dialNode.OpenNodeStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		assert.Eventually(t, func() bool {
+			_, err := io.WriteString(dialStream, "refused")
+			return err != nil
+		}, time.Second, time.Millisecond*10, "Write should fail after the stream is refused")
+
+		_, err = io.ReadAll(dialStream)
+		assert.NotNil(t, err, "Read should fail after the stream is refused")
+
+		stream, err := node.AcceptNodeStream(context.Background())
+		assert.Nil(t, err, "Queued stream should be accepted")
+		assert.NotNil(t, stream, "Queued stream should not be nil")
+
+	})
+
+	t.Run("Close node", func(t *testing.T) {
+		addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serve, node, dialNode := serveAndDialTCPNode(t, addr)
+		defer serve.Close()
+		defer node.Close()
+
+		err = dialNode.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = node.AcceptNodeStream(context.Background())
+		assert.ErrorIs(t, err, net.ErrClosed, "Accept should fail with closed error")
+
+		_, err = dialNode.OpenNodeStream()
+		assert.ErrorIs(t, err, net.ErrClosed, "Open should fail with closed error")
+
+	})
+
+}